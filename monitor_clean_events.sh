@@ -11,7 +11,7 @@ read -p "Enter choice (1-4): " choice
 
 case $choice in
     1) 
-        echo "📊 Monitoring Database Events: db@orderplaced, db@orderupdated, db@trade, db@ticker"
+        echo "📊 Monitoring Database Events: db@orderplaced, db@orderupdated, db@ticker (trades and balances use the db_funds list)"
         docker exec -i orbix-broker-1 redis-cli PSUBSCRIBE "db@*"
         ;;
     2) 
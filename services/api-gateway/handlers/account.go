@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/api-gateway/types"
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccountHandler serves trading settings that live in the engine, and the fee
+// tier the database service works out from trading volume
+type AccountHandler struct {
+	db     *gorm.DB
+	broker *broker.Broker
+}
+
+func NewAccountHandler(db *gorm.DB, brokerClient *broker.Broker) *AccountHandler {
+	return &AccountHandler{db: db, broker: brokerClient}
+}
+
+// SetSelfTradePrevention picks what happens when the user's orders would trade
+// with each other. Orders can still override it with self-trade-prevention.
+func (h *AccountHandler) SetSelfTradePrevention(c *gin.Context) {
+	var req struct {
+		Mode string `json:"mode" binding:"required,oneof=CANCEL_NEWEST CANCEL_OLDEST CANCEL_BOTH DECREMENT_AND_CANCEL"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	response, err := h.broker.SetSelfTradePrevention(&messages.SelfTradePreventionRequest{
+		UserID: userID,
+		Mode:   models.SelfTradePrevention(req.Mode),
+	})
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to update self-trade prevention"})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(400, gin.H{"error": response.Message})
+		return
+	}
+
+	c.JSON(200, gin.H{"self_trade_prevention": response.Mode})
+}
+
+// GetFees shows the user's fee tier, the 30-day quote volume it was earned with
+// and how much more volume the next tier needs. Volume is recomputed periodically,
+// not after every trade.
+func (h *AccountHandler) GetFees(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to load fee tier"})
+		return
+	}
+
+	var tiers []models.FeeTier
+	if err := h.db.Order("min_volume ASC").Find(&tiers).Error; err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to load fee tiers"})
+		return
+	}
+
+	response := types.AccountFeesResponse{
+		Tier:      user.FeeTier,
+		Volume30d: user.Volume30d.String(),
+	}
+
+	if user.VolumeUpdatedAt != nil {
+		response.UpdatedAt = user.VolumeUpdatedAt.Format(time.RFC3339)
+	}
+
+	for _, tier := range tiers {
+		if tier.Tier == user.FeeTier {
+			response.TierName = tier.Name
+		}
+
+		if response.NextTier == nil && tier.MinVolume.GreaterThan(user.Volume30d) {
+			next := tier.Tier
+			response.NextTier = &next
+			response.NextTierName = tier.Name
+			response.NextTierVolume = tier.MinVolume.String()
+			response.VolumeToNextTier = tier.MinVolume.Sub(user.Volume30d).String()
+		}
+	}
+
+	c.JSON(200, response)
+}
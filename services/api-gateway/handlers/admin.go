@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/api-gateway/types"
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AdminHandler serves operator commands for the engine and the market listing
+type AdminHandler struct {
+	db     *gorm.DB
+	broker *broker.Broker
+}
+
+func NewAdminHandler(db *gorm.DB, brokerClient *broker.Broker) *AdminHandler {
+	return &AdminHandler{db: db, broker: brokerClient}
+}
+
+// Snapshot forces every market to write a snapshot and reports the sequence
+// number of the last journaled command each one covers
+func (h *AdminHandler) Snapshot(c *gin.Context) {
+	response, err := h.broker.Snapshot()
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to take snapshot"})
+		return
+	}
+
+	status := 200
+	if !response.Success {
+		status = 500
+	}
+
+	c.JSON(status, gin.H{"message": response.Message, "snapshots": response.Snapshots})
+}
+
+// marketBody is a market's parameters. Every field is optional when changing a
+// market; only the ones sent are changed.
+type marketBody struct {
+	Name              *string `json:"name"`
+	PricePrecision    *int    `json:"price-precision" binding:"omitempty,min=0,max=8"`
+	QuantityPrecision *int    `json:"quantity-precision" binding:"omitempty,min=0,max=8"`
+	MinPrice          *string `json:"min-price"`
+	MinQuantity       *string `json:"min-quantity"`
+	MaxQuantity       *string `json:"max-quantity"` // 0 = no limit
+	MinNotional       *string `json:"min-notional"`
+	Active            *bool   `json:"active"`
+
+	// Circuit breaker
+	PriceBand        *string `json:"price-band"`                                  // Fraction, e.g. 0.1 = ±10%; 0 turns it off
+	PriceBandWindow  *int    `json:"price-band-window" binding:"omitempty,min=1"` // Seconds
+	HaltCooldown     *int    `json:"halt-cooldown" binding:"omitempty,min=1"`     // Seconds
+	ReopeningAuction *int    `json:"reopening-auction" binding:"omitempty,min=0"` // Seconds, 0 = reopen without an auction
+
+	// Fees, as fractions of what each side of a trade receives. Sent fee tiers
+	// replace all of the market's old ones.
+	MakerFee *string       `json:"maker-fee"`
+	TakerFee *string       `json:"taker-fee"`
+	FeeTiers []feeTierBody `json:"fee-tiers"`
+}
+
+// feeTierBody is the rates users in a fee tier pay instead of the tier 0 ones
+type feeTierBody struct {
+	Tier     int    `json:"tier"`
+	MakerFee string `json:"maker-fee"`
+	TakerFee string `json:"taker-fee"`
+}
+
+// applyTo validates the body and copies the fields that were sent onto the market.
+// The returned error message is safe to show to the client.
+func (req marketBody) applyTo(market *models.Market) error {
+	if req.Name != nil {
+		market.Name = *req.Name
+	}
+	if req.PricePrecision != nil {
+		market.PricePrecision = *req.PricePrecision
+	}
+	if req.QuantityPrecision != nil {
+		market.QuantityPrecision = *req.QuantityPrecision
+	}
+	if req.Active != nil {
+		market.IsActive = *req.Active
+	}
+	if req.PriceBandWindow != nil {
+		market.PriceBandWindowSeconds = *req.PriceBandWindow
+	}
+	if req.HaltCooldown != nil {
+		market.HaltCooldownSeconds = *req.HaltCooldown
+	}
+	if req.ReopeningAuction != nil {
+		market.ReopeningAuctionSeconds = *req.ReopeningAuction
+	}
+	if req.PriceBand != nil {
+		band, err := decimal.NewFromString(*req.PriceBand)
+		if err != nil || band.IsNegative() || band.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			return errors.New("price-band must be at least 0 and below 1")
+		}
+		market.PriceBand = band
+	}
+
+	if req.MakerFee != nil {
+		rate, err := parseFeeRate(*req.MakerFee, "maker-fee")
+		if err != nil {
+			return err
+		}
+		market.MakerFee = rate
+	}
+	if req.TakerFee != nil {
+		rate, err := parseFeeRate(*req.TakerFee, "taker-fee")
+		if err != nil {
+			return err
+		}
+		market.TakerFee = rate
+	}
+	if req.FeeTiers != nil {
+		fees := []models.MarketFee{}
+		seen := make(map[int]bool)
+		for _, tier := range req.FeeTiers {
+			if tier.Tier < 1 || seen[tier.Tier] {
+				return errors.New("fee-tiers must be distinct tiers of 1 and above")
+			}
+			seen[tier.Tier] = true
+
+			makerFee, err := parseFeeRate(tier.MakerFee, "maker-fee")
+			if err != nil {
+				return err
+			}
+			takerFee, err := parseFeeRate(tier.TakerFee, "taker-fee")
+			if err != nil {
+				return err
+			}
+			fees = append(fees, models.MarketFee{MarketID: market.ID, Tier: tier.Tier, MakerFee: makerFee, TakerFee: takerFee})
+		}
+		market.Fees = fees
+	}
+
+	amounts := []struct {
+		value    *string
+		field    *decimal.Decimal
+		name     string
+		positive bool
+	}{
+		{req.MinPrice, &market.MinPrice, "min-price", true},
+		{req.MinQuantity, &market.MinQuantity, "min-quantity", true},
+		{req.MaxQuantity, &market.MaxQuantity, "max-quantity", false},
+		{req.MinNotional, &market.MinNotional, "min-notional", false},
+	}
+	for _, amount := range amounts {
+		if amount.value == nil {
+			continue
+		}
+		d, err := decimal.NewFromString(*amount.value)
+		if err != nil || d.IsNegative() || (amount.positive && d.IsZero()) {
+			return errors.New("Invalid " + amount.name)
+		}
+		*amount.field = d
+	}
+
+	if market.MaxQuantity.IsPositive() && market.MaxQuantity.LessThan(market.MinQuantity) {
+		return errors.New("max-quantity must not be below min-quantity")
+	}
+	return nil
+}
+
+// parseFeeRate reads a fee rate, which must be at least 0 and below 1
+func parseFeeRate(value, name string) (decimal.Decimal, error) {
+	rate, err := decimal.NewFromString(value)
+	if err != nil || rate.IsNegative() || rate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return rate, errors.New(name + " must be at least 0 and below 1")
+	}
+	return rate, nil
+}
+
+// ListMarkets returns every market, including inactive and delisted ones
+func (h *AdminHandler) ListMarkets(c *gin.Context) {
+	var markets []models.Market
+	if err := h.db.Preload("Fees").Order("id ASC").Find(&markets).Error; err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to load markets"})
+		return
+	}
+
+	response := make([]types.MarketResponse, len(markets))
+	for i, market := range markets {
+		response[i] = toMarketResponse(market)
+	}
+	c.JSON(200, response)
+}
+
+// CreateMarket lists a new market. The engine starts its orderbook straight away;
+// an inactive market is listed but takes no orders until it is activated.
+func (h *AdminHandler) CreateMarket(c *gin.Context) {
+	var req struct {
+		BaseAsset  string `json:"base-asset" binding:"required,alphanum,max=10"`
+		QuoteAsset string `json:"quote-asset" binding:"required,alphanum,max=10"`
+		marketBody
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	market := models.Market{
+		BaseAsset:         strings.ToUpper(req.BaseAsset),
+		QuoteAsset:        strings.ToUpper(req.QuoteAsset),
+		PricePrecision:    8,
+		QuantityPrecision: 8,
+		IsActive:          true,
+		Status:            models.MARKET_OPEN,
+		LastUpdateTime:    time.Now(),
+		// Halt for five minutes on a move of more than 10% within five minutes, then
+		// reopen with a one minute auction
+		PriceBand:               decimal.New(1, -1),
+		PriceBandWindowSeconds:  300,
+		HaltCooldownSeconds:     300,
+		ReopeningAuctionSeconds: 60,
+		// 0.1% for makers, 0.2% for takers
+		MakerFee: decimal.New(1, -3),
+		TakerFee: decimal.New(2, -3),
+	}
+	market.ID = market.BaseAsset + market.QuoteAsset
+
+	if err := req.marketBody.applyTo(&market); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Unless given, the smallest price and quantity are one tick and one step
+	if req.MinPrice == nil {
+		market.MinPrice = decimal.New(1, -int32(market.PricePrecision))
+	}
+	if req.MinQuantity == nil {
+		market.MinQuantity = decimal.New(1, -int32(market.QuantityPrecision))
+	}
+
+	var existing int64
+	h.db.Model(&models.Market{}).Where("id = ?", market.ID).Count(&existing)
+	if existing > 0 {
+		c.JSON(409, gin.H{"error": "Market already exists"})
+		return
+	}
+
+	// Select("*") so an inactive market isn't stored with the column default. Its
+	// fee tiers are created with it.
+	if err := h.db.Select("*").Create(&market).Error; err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to create market"})
+		return
+	}
+
+	h.pushMarket(c, market, 201)
+}
+
+// UpdateMarket changes a listed market's parameters or turns it on or off.
+// Resting orders are kept as they are; new rules apply to orders from now on.
+func (h *AdminHandler) UpdateMarket(c *gin.Context) {
+	var req marketBody
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	market, found := h.findListedMarket(c)
+	if !found {
+		return
+	}
+
+	if err := req.applyTo(&market); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Only the listing columns, so market statistics written meanwhile are kept
+		err := tx.Model(&market).Omit(clause.Associations).Updates(map[string]interface{}{
+			"name":                      market.Name,
+			"price_precision":           market.PricePrecision,
+			"quantity_precision":        market.QuantityPrecision,
+			"min_price":                 market.MinPrice,
+			"min_quantity":              market.MinQuantity,
+			"max_quantity":              market.MaxQuantity,
+			"min_notional":              market.MinNotional,
+			"is_active":                 market.IsActive,
+			"price_band":                market.PriceBand,
+			"price_band_window_seconds": market.PriceBandWindowSeconds,
+			"halt_cooldown_seconds":     market.HaltCooldownSeconds,
+			"reopening_auction_seconds": market.ReopeningAuctionSeconds,
+			"maker_fee":                 market.MakerFee,
+			"taker_fee":                 market.TakerFee,
+		}).Error
+		if err != nil || req.FeeTiers == nil {
+			return err
+		}
+
+		if err := tx.Where("market_id = ?", market.ID).Delete(&models.MarketFee{}).Error; err != nil {
+			return err
+		}
+		if len(market.Fees) == 0 {
+			return nil
+		}
+		return tx.Create(&market.Fees).Error
+	})
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to update market"})
+		return
+	}
+
+	h.pushMarket(c, market, 200)
+}
+
+// DelistMarket closes a market for good: the engine cancels every open order in
+// it and stops listing it. The row stays for the market's order history.
+func (h *AdminHandler) DelistMarket(c *gin.Context) {
+	market, found := h.findListedMarket(c)
+	if !found {
+		return
+	}
+
+	now := time.Now()
+	market.IsActive = false
+	market.DelistedAt = &now
+
+	err := h.db.Model(&market).Updates(map[string]interface{}{"is_active": false, "delisted_at": now}).Error
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to delist market"})
+		return
+	}
+
+	h.pushMarket(c, market, 200)
+}
+
+// SetMarketStatus moves a market to another trading state, e.g. halting it during
+// an incident. The engine applies it, announces it on the market's status channel
+// and the database service stores it.
+func (h *AdminHandler) SetMarketStatus(c *gin.Context) {
+	var req struct {
+		Status models.MarketStatus `json:"status" binding:"required,oneof=OPEN HALTED CANCEL_ONLY POST_ONLY AUCTION"`
+		Reason string              `json:"reason" binding:"max=200"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	market, found := h.findListedMarket(c)
+	if !found {
+		return
+	}
+
+	response, err := h.broker.SetMarketStatus(&messages.MarketStatusRequest{
+		Market: market.Ticker(),
+		Status: req.Status,
+		Reason: req.Reason,
+	})
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to change market status"})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(400, gin.H{"error": response.Message, "status": response.Status})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": response.Message, "market": market.Ticker(), "status": response.Status})
+}
+
+// findListedMarket loads the market named in the URL, e.g. BTC_USD, and answers
+// 404 itself if there is no such market or it was delisted
+func (h *AdminHandler) findListedMarket(c *gin.Context) (models.Market, bool) {
+	var market models.Market
+
+	err := h.db.Preload("Fees").Where("id = ? AND delisted_at IS NULL", models.MarketIDFromTicker(c.Param("market"))).First(&market).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("error: %v", err)
+		}
+		c.JSON(404, gin.H{"error": "Market not found"})
+		return market, false
+	}
+
+	return market, true
+}
+
+// pushMarket sends a saved market to the engine and answers with it. If the
+// engine doesn't take it the change is still saved, and the engine picks it up
+// when it next starts.
+func (h *AdminHandler) pushMarket(c *gin.Context, market models.Market, status int) {
+	response, err := h.broker.UpdateMarket(&messages.UpdateMarketRequest{Market: market})
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Market saved, but the engine did not apply it", "market": toMarketResponse(market)})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(500, gin.H{"error": response.Message, "market": toMarketResponse(market)})
+		return
+	}
+
+	c.JSON(status, gin.H{"message": response.Message, "market": toMarketResponse(market)})
+}
+
+func toMarketResponse(market models.Market) types.MarketResponse {
+	response := types.MarketResponse{
+		ID:                market.ID,
+		Ticker:            market.Ticker(),
+		Name:              market.Name,
+		BaseAsset:         market.BaseAsset,
+		QuoteAsset:        market.QuoteAsset,
+		PricePrecision:    market.PricePrecision,
+		QuantityPrecision: market.QuantityPrecision,
+		MinPrice:          market.MinPrice.String(),
+		MinQuantity:       market.MinQuantity.String(),
+		MaxQuantity:       market.MaxQuantity.String(),
+		MinNotional:       market.MinNotional.String(),
+		Active:            market.IsActive,
+		Status:            string(market.Status),
+		PriceBand:         market.PriceBand.String(),
+		PriceBandWindow:   market.PriceBandWindowSeconds,
+		HaltCooldown:      market.HaltCooldownSeconds,
+		ReopeningAuction:  market.ReopeningAuctionSeconds,
+		MakerFee:          market.MakerFee.String(),
+		TakerFee:          market.TakerFee.String(),
+	}
+
+	fees := append([]models.MarketFee{}, market.Fees...)
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Tier < fees[j].Tier })
+	for _, fee := range fees {
+		response.FeeTiers = append(response.FeeTiers, types.MarketFeeResponse{
+			Tier:     fee.Tier,
+			MakerFee: fee.MakerFee.String(),
+			TakerFee: fee.TakerFee.String(),
+		})
+	}
+
+	if market.DelistedAt != nil {
+		response.DelistedAt = market.DelistedAt.Format(time.RFC3339)
+	}
+
+	return response
+}
@@ -40,5 +40,10 @@ func (h *MarketHandler) GetDepth(c *gin.Context) {
 		return
 	}
 
+	if response.Error != "" {
+		c.JSON(404, gin.H{"error": response.Error})
+		return
+	}
+
 	c.JSON(200, response)
 }
\ No newline at end of file
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/KshitijBhardwaj18/Orbix/services/api-gateway/types"
@@ -21,83 +23,253 @@ func NewOrderHandler(brokerClient *broker.Broker) *OrderHandler {
 	return &OrderHandler{broker: brokerClient}
 }
 
-func (h *OrderHandler) PlaceOrder(c *gin.Context) {
-	var req struct {
-		MarketID string `json:"market-id" binding:"required"`
-		Side     string `json:"side" binding:"required,oneof=BUY SELL"`
-		Type     string `json:"type" binding:"required,oneof=MARKET LIMIT"`
-		Quantity string `json:"quantity" binding:"required"`
-		Price    string `json:"price"`
-	}
+// orderBody is the JSON shape of a single order, shared by POST /order and the
+// legs of POST /order/group
+type orderBody struct {
+	Side     string `json:"side" binding:"required,oneof=BUY SELL"`
+	Type     string `json:"type" binding:"required,oneof=MARKET LIMIT STOP_MARKET STOP_LIMIT TRAILING_STOP"`
+	Quantity string `json:"quantity" binding:"required"`
+	Price    string `json:"price"`
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
-	}
+	// Optional for MARKET orders: worst price the sweep may reach
+	ProtectionPrice string `json:"protection-price"`
 
-	userIDstr := c.GetString("user_id")
-	userID, err := uuid.Parse(userIDstr)
+	// Required for STOP_MARKET and STOP_LIMIT orders
+	StopPrice string `json:"stop-price"`
 
-	if err != nil {
-		c.JSON(405, gin.H{"error": "Invalid UserID formatt"})
-	}
+	// TRAILING_STOP orders need exactly one: a fixed distance or a percentage of the price
+	TrailingOffset  string `json:"trailing-offset"`
+	TrailingPercent string `json:"trailing-percent"`
+
+	// Optional for TRAILING_STOP orders: follow the last trade (default) or the best bid/ask
+	TrailingReference string `json:"trailing-reference" binding:"omitempty,oneof=LAST_PRICE BEST_PRICE"`
 
+	// Optional for limit orders: iceberg slice shown in the book
+	DisplayQuantity string `json:"display-quantity"`
+
+	PostOnly    string `json:"post-only" binding:"omitempty,oneof=REJECT REPRICE"`
+
+	// Overrides the account's self-trade prevention mode for this order
+	SelfTradePrevention string `json:"self-trade-prevention" binding:"omitempty,oneof=CANCEL_NEWEST CANCEL_OLDEST CANCEL_BOTH DECREMENT_AND_CANCEL"`
+
+	TimeInForce string `json:"time-in-force" binding:"omitempty,oneof=GTC IOC FOK GTD"`
+	ExpiresAt   string `json:"expires-at"` // RFC3339, required for GTD
+}
+
+// toOrderRequest validates an order body and converts it into an engine request.
+// The returned error message is safe to show to the client.
+func (req orderBody) toOrderRequest(userID uuid.UUID, marketID string) (*messages.OrderRequest, error) {
 	quantity, err := decimal.NewFromString(req.Quantity)
 
 	if err != nil || quantity.LessThanOrEqual(decimal.Zero) {
-		c.JSON(400, gin.H{"error": "Invalid quantity"})
-		return
+		return nil, errors.New("Invalid quantity")
 	}
 
+	// A trailing stop without a price becomes a market order when it triggers
+	isMarket := req.Type == "MARKET" || req.Type == "STOP_MARKET" || (req.Type == "TRAILING_STOP" && req.Price == "")
+
 	var price *decimal.Decimal
-	if req.Type == "LIMIT" {
+	if !isMarket {
 		if req.Price == "" {
-			c.JSON(400, gin.H{"error": "Price required for limit orders"})
-			return
+			return nil, errors.New("Price required for limit orders")
 		}
 
 		p, err := decimal.NewFromString(req.Price)
 		if err != nil || p.LessThanOrEqual(decimal.Zero) {
-			c.JSON(400, gin.H{"error": "Invalid price"})
-			return
+			return nil, errors.New("Invalid price")
 		}
 		price = &p
 	}
 
-	orderReq := &messages.OrderRequest{
+	var protectionPrice *decimal.Decimal
+	if isMarket && req.ProtectionPrice != "" {
+		p, err := decimal.NewFromString(req.ProtectionPrice)
+		if err != nil || p.LessThanOrEqual(decimal.Zero) {
+			return nil, errors.New("Invalid protection price")
+		}
+		protectionPrice = &p
+	}
+
+	var stopPrice *decimal.Decimal
+	if req.Type == "STOP_MARKET" || req.Type == "STOP_LIMIT" {
+		p, err := decimal.NewFromString(req.StopPrice)
+		if err != nil || p.LessThanOrEqual(decimal.Zero) {
+			return nil, errors.New("Valid stop price required for stop orders")
+		}
+		stopPrice = &p
+	}
+
+	var trailingOffset, trailingPercent *decimal.Decimal
+	if req.Type == "TRAILING_STOP" {
+		if (req.TrailingOffset == "") == (req.TrailingPercent == "") {
+			return nil, errors.New("Trailing stops need either trailing-offset or trailing-percent")
+		}
+
+		if req.TrailingOffset != "" {
+			d, err := decimal.NewFromString(req.TrailingOffset)
+			if err != nil || d.LessThanOrEqual(decimal.Zero) {
+				return nil, errors.New("Invalid trailing offset")
+			}
+			trailingOffset = &d
+		} else {
+			d, err := decimal.NewFromString(req.TrailingPercent)
+			if err != nil || d.LessThanOrEqual(decimal.Zero) || d.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+				return nil, errors.New("Trailing percent must be between 0 and 100")
+			}
+			trailingPercent = &d
+		}
+	} else if req.TrailingReference != "" {
+		return nil, errors.New("Trailing reference is only allowed on trailing stops")
+	}
+
+	var displayQuantity *decimal.Decimal
+	if req.DisplayQuantity != "" {
+		q, err := decimal.NewFromString(req.DisplayQuantity)
+		if err != nil || isMarket || q.LessThanOrEqual(decimal.Zero) || q.GreaterThanOrEqual(quantity) {
+			return nil, errors.New("Display quantity must be below the order quantity on a limit order")
+		}
+		displayQuantity = &q
+	}
+
+	if req.Type == "MARKET" && (req.TimeInForce == "GTC" || req.TimeInForce == "GTD") {
+		return nil, errors.New("Market orders must be IOC or FOK")
+	}
+
+	if req.PostOnly != "" && (req.Type != "LIMIT" || req.TimeInForce == "IOC" || req.TimeInForce == "FOK") {
+		return nil, errors.New("Post-only is only allowed on resting limit orders")
+	}
+
+	var expiresAt *time.Time
+	if req.TimeInForce == "GTD" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !t.After(time.Now()) {
+			return nil, errors.New("GTD orders need a future expires-at (RFC3339)")
+		}
+		expiresAt = &t
+	}
+
+	return &messages.OrderRequest{
 		UserID:   userID,
-		MarketID: req.MarketID,
+		MarketID: marketID,
 		Side:     models.OrderSide(req.Side),
 		Type:     models.OrderType(req.Type),
 		Quantity: quantity,
 		Price:    price,
+
+		ProtectionPrice: protectionPrice,
+		StopPrice:       stopPrice,
+		TrailingOffset:  trailingOffset,
+		TrailingPercent: trailingPercent,
+		DisplayQuantity: displayQuantity,
+		PostOnly:        models.PostOnlyMode(req.PostOnly),
+		TimeInForce:     models.TimeInForce(req.TimeInForce),
+		ExpiresAt:       expiresAt,
+
+		SelfTradePrevention: models.SelfTradePrevention(req.SelfTradePrevention),
+		TrailingReference:   models.TrailingReference(req.TrailingReference),
+	}, nil
+}
+
+func (h *OrderHandler) PlaceOrder(c *gin.Context) {
+	var req struct {
+		MarketID string `json:"market-id" binding:"required"`
+		orderBody
 	}
 
-	response, err := h.broker.CreateOrder(orderReq)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	orderResponse := types.OrderResponse{
-		ID:                response.ID.String(),
-		MarketID:          response.MarketID,
-		Side:              string(response.Side),
-		Type:              string(response.Type),
-		Quantity:          response.Quantity.String(),
-		FilledQuantity:    response.FilledQuantity.String(),
-		RemainingQuantity: response.RemainingQuantity.String(),
-		Status:            string(response.Status),
-		CreatedAt:         response.CreatedAt.Format(time.RFC3339),
+	userIDstr := c.GetString("user_id")
+	userID, err := uuid.Parse(userIDstr)
+
+	if err != nil {
+		c.JSON(405, gin.H{"error": "Invalid UserID formatt"})
 	}
 
-	if response.Price != nil {
-		orderResponse.Price = response.Price.String()
+	orderReq, err := req.toOrderRequest(userID, req.MarketID)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
+	response, err := h.broker.CreateOrder(orderReq)
+
 	if err != nil {
 		log.Printf("error: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to process order"})
 		return
 	}
 
-	c.JSON(201, orderResponse)
+	c.JSON(201, toOrderResponse(*response))
+}
+
+// PlaceOrderGroup places a take-profit and stop-loss pair that cancel each other,
+// optionally bracketed around an entry order. A bracket's legs go out with the
+// entry's first fill and grow with each later one, and once a leg trades or is
+// cancelled, whatever is left of the entry is cancelled too.
+func (h *OrderHandler) PlaceOrderGroup(c *gin.Context) {
+	var req struct {
+		MarketID   string     `json:"market-id" binding:"required"`
+		Entry      *orderBody `json:"entry"`
+		TakeProfit orderBody  `json:"take-profit" binding:"required"`
+		StopLoss   orderBody  `json:"stop-loss" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	groupReq := &messages.OrderGroupRequest{
+		UserID:   userID,
+		MarketID: req.MarketID,
+	}
+
+	takeProfit, err := req.TakeProfit.toOrderRequest(userID, req.MarketID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "take-profit: " + err.Error()})
+		return
+	}
+	groupReq.TakeProfit = *takeProfit
+
+	stopLoss, err := req.StopLoss.toOrderRequest(userID, req.MarketID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "stop-loss: " + err.Error()})
+		return
+	}
+	groupReq.StopLoss = *stopLoss
+
+	if req.Entry != nil {
+		groupReq.Entry, err = req.Entry.toOrderRequest(userID, req.MarketID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "entry: " + err.Error()})
+			return
+		}
+	}
+
+	response, err := h.broker.CreateOrderGroup(groupReq)
+
+	if err != nil {
+		log.Printf("error placing order group: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to process order group"})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(400, gin.H{"error": response.Message})
+		return
+	}
+
+	c.JSON(201, toOrderGroupResponse(response))
 }
 
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
@@ -162,6 +334,129 @@ func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	}
 }
 
+// GetOrder returns the live state of one of the caller's open orders
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	response, err := h.broker.GetOrder(&messages.GetOrderRequest{
+		UserID:  userID,
+		OrderID: c.Param("id"),
+	})
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to get order"})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(404, gin.H{"error": response.Message})
+		return
+	}
+
+	c.JSON(200, toOrderResponse(*response.Order))
+}
+
+// CancelAllOrders pulls every open order of the caller at once. The optional
+// market (BTC_USD) and side query parameters narrow it down.
+func (h *OrderHandler) CancelAllOrders(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	side := c.Query("side")
+	if side != "" && side != "BUY" && side != "SELL" {
+		c.JSON(400, gin.H{"error": "Side must be BUY or SELL"})
+		return
+	}
+
+	response, err := h.broker.CancelAllOrders(&messages.CancelAllOrdersRequest{
+		UserID: userID,
+		Market: c.Query("market"),
+		Side:   models.OrderSide(side),
+	})
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to cancel orders"})
+		return
+	}
+
+	c.JSON(200, gin.H{"cancelled_order_ids": response.OrderIDs})
+}
+
+// ModifyOrder amends the price and/or quantity of a resting order in one step.
+// Quantity is the new total order size; shrinking it keeps the order's place in
+// the queue, anything else sends it to the back. Stop orders can only be amended
+// once they have triggered.
+func (h *OrderHandler) ModifyOrder(c *gin.Context) {
+	var req struct {
+		OrderId  string `json:"order_id" binding:"required"`
+		Price    string `json:"price"`
+		Quantity string `json:"quantity"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Price == "" && req.Quantity == "" {
+		c.JSON(400, gin.H{"error": "Price or quantity required"})
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	modifyReq := &messages.ModifyOrderRequest{
+		UserID:  userID,
+		OrderID: req.OrderId,
+	}
+
+	if req.Price != "" {
+		p, err := decimal.NewFromString(req.Price)
+		if err != nil || p.LessThanOrEqual(decimal.Zero) {
+			c.JSON(400, gin.H{"error": "Invalid price"})
+			return
+		}
+		modifyReq.Price = &p
+	}
+
+	if req.Quantity != "" {
+		q, err := decimal.NewFromString(req.Quantity)
+		if err != nil || q.LessThanOrEqual(decimal.Zero) {
+			c.JSON(400, gin.H{"error": "Invalid quantity"})
+			return
+		}
+		modifyReq.Quantity = &q
+	}
+
+	response, err := h.broker.ModifyOrder(modifyReq)
+
+	if err != nil {
+		log.Printf("error: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to modify order"})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(400, gin.H{"error": response.Message})
+		return
+	}
+
+	c.JSON(200, toOrderResponse(*response.Order))
+}
+
 func (h *OrderHandler) GetOpenOrders(c *gin.Context) {
 	userIDstr := c.GetString("user_id")
 	userID, err := uuid.Parse(userIDstr)
@@ -187,23 +482,15 @@ func (h *OrderHandler) GetOpenOrders(c *gin.Context) {
 		return
 	}
 
+	if response.Error != "" {
+		c.JSON(404, gin.H{"error": response.Error})
+		return
+	}
+
 	// Convert to API response format
-	orderResponses := make([]types.OrderResponse, len(response))
-	for i, order := range response {
-		orderResponses[i] = types.OrderResponse{
-			ID:                order.ID.String(),
-			MarketID:          order.MarketID,
-			Side:              string(order.Side),
-			Type:              string(order.Type),
-			Quantity:          order.Quantity.String(),
-			FilledQuantity:    order.FilledQuantity.String(),
-			RemainingQuantity: order.RemainingQuantity.String(),
-			Status:            string(order.Status),
-			CreatedAt:         order.CreatedAt.Format(time.RFC3339),
-		}
-		if order.Price != nil {
-			orderResponses[i].Price = order.Price.String()
-		}
+	orderResponses := make([]types.OrderResponse, len(response.Orders))
+	for i, order := range response.Orders {
+		orderResponses[i] = toOrderResponse(order)
 	}
 
 	c.JSON(200, gin.H{
@@ -224,3 +511,114 @@ func (h *OrderHandler) LogOrderbooks(c *gin.Context) {
 	c.JSON(200, response)
 }
 
+// toOrderResponse converts an engine order into the API response format
+func toOrderResponse(order models.Order) types.OrderResponse {
+	orderResponse := types.OrderResponse{
+		ID:                  order.ID.String(),
+		MarketID:            order.MarketID,
+		Side:                string(order.Side),
+		Type:                string(order.Type),
+		PostOnly:            string(order.PostOnly),
+		SelfTradePrevention: string(order.SelfTradePrevention),
+		TimeInForce:         string(order.TimeInForce),
+		Quantity:            order.Quantity.String(),
+		FilledQuantity:      order.FilledQuantity.String(),
+		RemainingQuantity:   order.RemainingQuantity.String(),
+		Status:              string(order.Status),
+		Reason:              order.StatusReason,
+		CreatedAt:           order.CreatedAt.Format(time.RFC3339),
+	}
+
+	if order.Price != nil {
+		orderResponse.Price = order.Price.String()
+	}
+
+	if order.StopPrice != nil {
+		orderResponse.StopPrice = order.StopPrice.String()
+	}
+
+	if order.TrailingOffset != nil {
+		orderResponse.TrailingOffset = order.TrailingOffset.String()
+	}
+
+	if order.TrailingPercent != nil {
+		orderResponse.TrailingPercent = order.TrailingPercent.String()
+	}
+
+	if order.Type == models.TRAILING_STOP || order.TrailingOffset != nil || order.TrailingPercent != nil {
+		orderResponse.TrailingReference = string(order.TrailingReference)
+		if orderResponse.TrailingReference == "" {
+			orderResponse.TrailingReference = string(models.TRAIL_LAST_PRICE)
+		}
+	}
+
+	if order.DisplayQuantity != nil {
+		orderResponse.DisplayQuantity = order.DisplayQuantity.String()
+	}
+
+	if order.GroupID != nil {
+		orderResponse.GroupID = order.GroupID.String()
+	}
+
+	if order.ExpiresAt != nil {
+		orderResponse.ExpiresAt = order.ExpiresAt.Format(time.RFC3339)
+	}
+
+	for _, trade := range order.Trades {
+		orderResponse.Trades = append(orderResponse.Trades, toOrderTradeResponse(order, trade))
+	}
+
+	return orderResponse
+}
+
+// toOrderTradeResponse shows a fill from the side of the order's owner. Buyers pay
+// their fee in the base asset they receive, sellers in the quote asset.
+func toOrderTradeResponse(order models.Order, trade models.Trade) types.OrderTradeResponse {
+	baseAsset, quoteAsset, _ := strings.Cut(order.MarketID, "/")
+
+	fee, feeAsset, maker := trade.SellerFee, quoteAsset, !trade.IsBuyerMaker
+	if order.Side == models.BUY {
+		fee, feeAsset, maker = trade.BuyerFee, baseAsset, trade.IsBuyerMaker
+	}
+
+	tradeResponse := types.OrderTradeResponse{
+		ID:        trade.ID.String(),
+		Price:     trade.Price.String(),
+		Quantity:  trade.Quantity.String(),
+		Fee:       "0",
+		FeeAsset:  feeAsset,
+		Liquidity: "TAKER",
+		CreatedAt: trade.CreatedAt.Format(time.RFC3339),
+	}
+
+	if fee != nil {
+		tradeResponse.Fee = fee.String()
+	}
+
+	if maker {
+		tradeResponse.Liquidity = "MAKER"
+	}
+
+	return tradeResponse
+}
+
+// toOrderGroupResponse converts an engine order group into the API response format
+func toOrderGroupResponse(response *messages.OrderGroupResponse) types.OrderGroupResponse {
+	groupResponse := types.OrderGroupResponse{
+		ID:       response.Group.ID.String(),
+		MarketID: response.Group.MarketID,
+		Type:     string(response.Group.Type),
+		Status:   string(response.Group.Status),
+		Orders:   make([]types.OrderResponse, len(response.Orders)),
+	}
+
+	if response.Group.ParentOrderID != nil {
+		groupResponse.ParentOrderID = response.Group.ParentOrderID.String()
+	}
+
+	for i, order := range response.Orders {
+		groupResponse.Orders[i] = toOrderResponse(order)
+	}
+
+	return groupResponse
+}
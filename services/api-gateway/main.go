@@ -25,13 +25,15 @@ func main() {
 	orderHandler := handlers.NewOrderHandler(Broker)
 	userHandler := handlers.NewUserHandler(db)
 	marketHandler := handlers.NewMarketHandler(Broker)
+	accountHandler := handlers.NewAccountHandler(db, Broker)
+	adminHandler := handlers.NewAdminHandler(db, Broker)
 	
 
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"}, // your React frontend
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
@@ -52,14 +54,32 @@ func main() {
 	
 	{
 		protected.POST("/order", orderHandler.PlaceOrder)
+		protected.POST("/order/group", orderHandler.PlaceOrderGroup)
+		protected.GET("/order/:id", orderHandler.GetOrder)
+		protected.PATCH("/order", orderHandler.ModifyOrder)
 		protected.DELETE("/order",orderHandler.DeleteOrder)
 		protected.GET("/orders/open", orderHandler.GetOpenOrders)
+		protected.DELETE("/orders", orderHandler.CancelAllOrders)
 		protected.GET("/user/me", userHandler.GetUser)
+		protected.PUT("/account/self-trade-prevention", accountHandler.SetSelfTradePrevention)
+		protected.GET("/account/fees", accountHandler.GetFees)
 		protected.GET("/logorderbooks",orderHandler.LogOrderbooks)
 		protected.GET("/market/getdepth/:market",marketHandler.GetDepth)
 		
 	}
 
+	admin := protected.Group("/admin")
+	admin.Use(middleware.AdminMiddleware())
+
+	{
+		admin.POST("/snapshot", adminHandler.Snapshot)
+		admin.GET("/markets", adminHandler.ListMarkets)
+		admin.POST("/markets", adminHandler.CreateMarket)
+		admin.PATCH("/markets/:market", adminHandler.UpdateMarket)
+		admin.DELETE("/markets/:market", adminHandler.DelistMarket)
+		admin.PUT("/markets/:market/status", adminHandler.SetMarketStatus)
+	}
+
 	log.Println("API Gateway is running on port :8080")
 	router.Run(":8080")
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware lets through only users whose email is listed in ADMIN_EMAILS
+// (comma separated). It must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.GetString("email")
+
+		for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+			if email != "" && strings.EqualFold(strings.TrimSpace(admin), email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(403, gin.H{"error": "Admin access required"})
+		c.Abort()
+	}
+}
@@ -1,13 +1,91 @@
 package types
 type OrderResponse struct {
+    ID                  string `json:"id"`
+    MarketID            string `json:"market_id"`
+    Side                string `json:"side"`
+    Type                string `json:"type"`
+    PostOnly            string `json:"post_only,omitempty"`
+    SelfTradePrevention string `json:"self_trade_prevention,omitempty"`
+    TimeInForce         string `json:"time_in_force"`
+    Quantity            string `json:"quantity"`
+    DisplayQuantity     string `json:"display_quantity,omitempty"`
+    Price               string `json:"price,omitempty"`
+    StopPrice           string `json:"stop_price,omitempty"` // Current trigger level for trailing stops
+    TrailingOffset      string `json:"trailing_offset,omitempty"`
+    TrailingPercent     string `json:"trailing_percent,omitempty"`
+    TrailingReference   string `json:"trailing_reference,omitempty"`
+    FilledQuantity      string `json:"filled_quantity"`
+    RemainingQuantity   string `json:"remaining_quantity"`
+    Status              string `json:"status"`
+    Reason              string `json:"reason,omitempty"`
+    GroupID             string `json:"group_id,omitempty"`
+    CreatedAt           string `json:"created_at"`
+    ExpiresAt           string `json:"expires_at,omitempty"`
+
+    // Fills the request produced, with the fee the order's owner paid on each
+    Trades []OrderTradeResponse `json:"trades,omitempty"`
+}
+
+// OrderTradeResponse is one fill of an order as its owner sees it
+type OrderTradeResponse struct {
+    ID        string `json:"id"`
+    Price     string `json:"price"`
+    Quantity  string `json:"quantity"`
+    Fee       string `json:"fee"`
+    FeeAsset  string `json:"fee_asset"` // Base asset when buying, quote asset when selling
+    Liquidity string `json:"liquidity"` // MAKER or TAKER
+    CreatedAt string `json:"created_at"`
+}
+
+type OrderGroupResponse struct {
+    ID            string          `json:"id"`
+    MarketID      string          `json:"market_id"`
+    Type          string          `json:"type"`
+    Status        string          `json:"status"`
+    ParentOrderID string          `json:"parent_order_id,omitempty"`
+    Orders        []OrderResponse `json:"orders"`
+}
+
+type MarketResponse struct {
     ID                string `json:"id"`
-    MarketID          string `json:"market_id"`
-    Side              string `json:"side"`
-    Type              string `json:"type"`
-    Quantity          string `json:"quantity"`
-    Price             string `json:"price,omitempty"`
-    FilledQuantity    string `json:"filled_quantity"`
-    RemainingQuantity string `json:"remaining_quantity"`
-    Status            string `json:"status"`
-    CreatedAt         string `json:"created_at"`
-}
\ No newline at end of file
+    Ticker            string `json:"ticker"`
+    Name              string `json:"name"`
+    BaseAsset         string `json:"base_asset"`
+    QuoteAsset        string `json:"quote_asset"`
+    PricePrecision    int    `json:"price_precision"`
+    QuantityPrecision int    `json:"quantity_precision"`
+    MinPrice          string `json:"min_price"`
+    MinQuantity       string `json:"min_quantity"`
+    MaxQuantity       string `json:"max_quantity"` // 0 = no limit
+    MinNotional       string `json:"min_notional"`
+    Active            bool   `json:"active"`
+    Status            string `json:"status"` // Trading state: OPEN, HALTED, CANCEL_ONLY, POST_ONLY or AUCTION
+    PriceBand         string `json:"price_band"`        // Largest move within the window, 0 = no circuit breaker
+    PriceBandWindow   int    `json:"price_band_window"` // Seconds
+    HaltCooldown      int    `json:"halt_cooldown"`     // Seconds a breach halts the market
+    ReopeningAuction  int    `json:"reopening_auction"` // Seconds of call auction after a halt, 0 = none
+    MakerFee          string `json:"maker_fee"`         // Tier 0 rates
+    TakerFee          string `json:"taker_fee"`
+    DelistedAt        string `json:"delisted_at,omitempty"`
+
+    FeeTiers []MarketFeeResponse `json:"fee_tiers,omitempty"` // Rates of higher tiers
+}
+
+// AccountFeesResponse is a user's fee tier and the volume behind it. The next
+// tier fields are left out at the top tier.
+type AccountFeesResponse struct {
+    Tier             int    `json:"tier"`
+    TierName         string `json:"tier_name"`
+    Volume30d        string `json:"volume_30d"`                    // Quote volume traded in the last 30 days
+    UpdatedAt        string `json:"updated_at,omitempty"`          // When the volume was last computed
+    NextTier         *int   `json:"next_tier,omitempty"`
+    NextTierName     string `json:"next_tier_name,omitempty"`
+    NextTierVolume   string `json:"next_tier_volume,omitempty"`    // 30-day volume the next tier needs
+    VolumeToNextTier string `json:"volume_to_next_tier,omitempty"`
+}
+
+type MarketFeeResponse struct {
+    Tier     int    `json:"tier"`
+    MakerFee string `json:"maker_fee"`
+    TakerFee string `json:"taker_fee"`
+}
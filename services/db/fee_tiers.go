@@ -0,0 +1,157 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	feeTierInterval = time.Hour           // How often every user's tier is recomputed
+	feeTierWindow   = 30 * 24 * time.Hour // Trades that count towards a user's volume
+)
+
+// defaultFeeTiers are written to an empty fee_tiers table. Volumes are in the
+// quote asset, which is USD for every default market.
+var defaultFeeTiers = []models.FeeTier{
+	{Tier: 0, Name: "Regular", MinVolume: decimal.Zero},
+	{Tier: 1, Name: "VIP 1", MinVolume: decimal.NewFromInt(50000)},
+	{Tier: 2, Name: "VIP 2", MinVolume: decimal.NewFromInt(500000)},
+	{Tier: 3, Name: "VIP 3", MinVolume: decimal.NewFromInt(2500000)},
+	{Tier: 4, Name: "VIP 4", MinVolume: decimal.NewFromInt(10000000)},
+}
+
+// userVolume is a user's traded quote volume on either side of a trade
+type userVolume struct {
+	UserID uuid.UUID
+	Volume decimal.Decimal
+}
+
+// processFeeTiers keeps every user's fee tier in step with their 30-day volume.
+// The engine only keeps tiers in its journal, so on start every tier above 0 is
+// pushed to it again; after that only changes are.
+func (ds *DatabaseService) processFeeTiers() {
+	if err := ds.seedFeeTiers(); err != nil {
+		log.Printf("❌ Failed to list default fee tiers: %v", err)
+	}
+
+	ds.recomputeFeeTiers(true)
+
+	ticker := time.NewTicker(feeTierInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ds.recomputeFeeTiers(false)
+	}
+}
+
+// seedFeeTiers fills an empty fee_tiers table with defaultFeeTiers
+func (ds *DatabaseService) seedFeeTiers() error {
+	var count int64
+	if err := ds.db.Model(&models.FeeTier{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tiers := append([]models.FeeTier{}, defaultFeeTiers...)
+	if err := ds.db.Create(&tiers).Error; err != nil {
+		return err
+	}
+
+	log.Printf("💸 Listed %d default fee tiers", len(tiers))
+	return nil
+}
+
+// recomputeFeeTiers works out each user's 30-day quote volume from the trades
+// table and moves them to the tier it earns. A tier is only stored once the engine
+// has taken it, so a failed push is retried on the next run.
+func (ds *DatabaseService) recomputeFeeTiers(resync bool) {
+	var tiers []models.FeeTier
+	if err := ds.db.Order("min_volume ASC").Find(&tiers).Error; err != nil {
+		log.Printf("❌ Failed to load fee tiers: %v", err)
+		return
+	}
+
+	now := time.Now()
+	since := now.Add(-feeTierWindow)
+
+	var volumes []userVolume
+	err := ds.db.Raw(`
+		SELECT user_id, SUM(quote_quantity) AS volume FROM (
+			SELECT buyer_id AS user_id, quote_quantity FROM trades WHERE created_at >= ?
+			UNION ALL
+			SELECT seller_id AS user_id, quote_quantity FROM trades WHERE created_at >= ?
+		) AS fills
+		GROUP BY user_id`, since, since).Scan(&volumes).Error
+	if err != nil {
+		log.Printf("❌ Failed to compute 30-day volumes: %v", err)
+		return
+	}
+
+	volumeByUser := make(map[uuid.UUID]decimal.Decimal, len(volumes))
+	for _, volume := range volumes {
+		volumeByUser[volume.UserID] = volume.Volume
+	}
+
+	// Users who traded, and users whose volume has since run out of the window
+	var users []models.User
+	err = ds.db.Where("fee_tier > 0 OR volume30d > 0 OR id IN (?)", userIDs(volumes)).Find(&users).Error
+	if err != nil {
+		log.Printf("❌ Failed to load users for fee tiers: %v", err)
+		return
+	}
+
+	changed := 0
+	for _, user := range users {
+		volume := volumeByUser[user.ID]
+		tier := feeTierFor(volume, tiers)
+
+		if tier != user.FeeTier || (resync && tier > 0) {
+			response, err := ds.broker.SetFeeTier(&messages.FeeTierRequest{UserID: user.ID, Tier: tier})
+			if err != nil || !response.Success {
+				log.Printf("❌ Engine did not take fee tier %d for user %s: %v", tier, user.ID.String()[:8], err)
+				tier = user.FeeTier
+			} else if tier != user.FeeTier {
+				changed++
+			}
+		}
+
+		err := ds.db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"fee_tier":          tier,
+			"volume30d":         volume,
+			"volume_updated_at": now,
+		}).Error
+		if err != nil {
+			log.Printf("❌ Failed to store fee tier of user %s: %v", user.ID.String()[:8], err)
+		}
+	}
+
+	log.Printf("💸 Recomputed fee tiers of %d users, %d changed tier", len(users), changed)
+}
+
+// feeTierFor returns the highest tier whose minimum volume the user has reached.
+// tiers is in ascending order of MinVolume.
+func feeTierFor(volume decimal.Decimal, tiers []models.FeeTier) int {
+	tier := 0
+	for _, t := range tiers {
+		if volume.LessThan(t.MinVolume) {
+			break
+		}
+		tier = t.Tier
+	}
+	return tier
+}
+
+func userIDs(volumes []userVolume) []uuid.UUID {
+	ids := make([]uuid.UUID, len(volumes))
+	for i, volume := range volumes {
+		ids[i] = volume.UserID
+	}
+	return ids
+}
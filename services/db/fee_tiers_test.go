@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFeeTierFor(t *testing.T) {
+	tests := []struct {
+		volume string
+		want   int
+	}{
+		{"0", 0},
+		{"49999.99", 0},
+		{"50000", 1},
+		{"499999", 1},
+		{"2500000", 3},
+		{"99000000", 4},
+	}
+	for _, tt := range tests {
+		if got := feeTierFor(decimal.RequireFromString(tt.volume), defaultFeeTiers); got != tt.want {
+			t.Errorf("volume %s: got tier %d, want %d", tt.volume, got, tt.want)
+		}
+	}
+}
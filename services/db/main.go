@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DatabaseService struct {
@@ -27,7 +28,7 @@ func main() {
 
 	// Create database extensions and migrate schema
 	db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`)
-	err = db.AutoMigrate(&models.User{}, &models.Market{}, &models.Order{}, &models.Trade{}, &models.Balance{})
+	err = db.AutoMigrate(&models.User{}, &models.Market{}, &models.Order{}, &models.Trade{}, &models.Balance{}, &models.OrderGroup{}, &models.MarketFee{}, &models.FeeTier{}, &models.FundsCursor{}, &models.FailedFundsEvent{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
@@ -43,6 +44,9 @@ func main() {
 	// Start event processing in background
 	go dbService.startEventProcessing()
 
+	// Keep fee tiers in step with trading volume
+	go dbService.processFeeTiers()
+
 	// Start HTTP health check server
 	go dbService.startHealthServer()
 
@@ -71,8 +75,11 @@ func (ds *DatabaseService) startEventProcessing() {
 
 	// Subscribe to all database events
 	go ds.processOrderEvents()
-	go ds.processTradeEvents()
 	go ds.processTickerEvents()
+	go ds.processGroupEvents()
+	go ds.processMarketStatusEvents()
+	go ds.processFundsEvents()
+	go ds.retryFailedFundsEvents()
 
 	log.Println("✅ Event processors started successfully")
 }
@@ -89,25 +96,36 @@ func (ds *DatabaseService) processOrderEvents() {
 	}
 }
 
-func (ds *DatabaseService) processTradeEvents() {
-	pubsub := ds.broker.SubscribeToChannel("db@trade")
+func (ds *DatabaseService) processTickerEvents() {
+	pubsub := ds.broker.SubscribeToChannel("db@ticker")
 	defer pubsub.Close()
 
-	log.Println("👂 Listening for trade events: db@trade")
+	log.Println("👂 Listening for ticker events: db@ticker")
 
 	for msg := range pubsub.Channel() {
-		ds.handleTradeEvent(msg.Payload)
+		ds.handleTickerEvent(msg.Payload)
 	}
 }
 
-func (ds *DatabaseService) processTickerEvents() {
-	pubsub := ds.broker.SubscribeToChannel("db@ticker")
+func (ds *DatabaseService) processGroupEvents() {
+	pubsub := ds.broker.SubscribeToPattern("db@group*")
 	defer pubsub.Close()
 
-	log.Println("👂 Listening for ticker events: db@ticker")
+	log.Println("👂 Listening for order group events: db@groupplaced, db@groupupdated")
 
 	for msg := range pubsub.Channel() {
-		ds.handleTickerEvent(msg.Payload)
+		ds.handleGroupEvent(msg.Channel, msg.Payload)
+	}
+}
+
+func (ds *DatabaseService) processMarketStatusEvents() {
+	pubsub := ds.broker.SubscribeToChannel("db@marketstatus")
+	defer pubsub.Close()
+
+	log.Println("👂 Listening for market status events: db@marketstatus")
+
+	for msg := range pubsub.Channel() {
+		ds.handleMarketStatusEvent(msg.Payload)
 	}
 }
 
@@ -126,8 +144,9 @@ func (ds *DatabaseService) handleOrderEvent(channel, payload string) {
 	}
 
 	if strings.Contains(channel, "orderplaced") {
-		// 🟢 INSERT new order
-		if err := ds.db.Create(&order).Error; err != nil {
+		// 🟢 INSERT new order. Bracket legs are stored as they are held back and
+		// placed again once their entry fills.
+		if err := ds.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&order).Error; err != nil {
 			log.Printf("❌ Failed to insert order: %v", err)
 		} else {
 			log.Printf("✅ Inserted order %s (%s %s %s @ %s)", 
@@ -145,27 +164,34 @@ func (ds *DatabaseService) handleOrderEvent(channel, payload string) {
 	}
 }
 
-func (ds *DatabaseService) handleTradeEvent(payload string) {
+func (ds *DatabaseService) handleGroupEvent(channel, payload string) {
 	var eventData map[string]interface{}
 	if err := json.Unmarshal([]byte(payload), &eventData); err != nil {
-		log.Printf("❌ Failed to parse trade event: %v", err)
+		log.Printf("❌ Failed to parse order group event: %v", err)
 		return
 	}
 
-	tradeData, _ := json.Marshal(eventData["trade"])
-	var trade models.Trade
-	if err := json.Unmarshal(tradeData, &trade); err != nil {
-		log.Printf("❌ Failed to parse trade: %v", err)
+	groupData, _ := json.Marshal(eventData["group"])
+	var group models.OrderGroup
+	if err := json.Unmarshal(groupData, &group); err != nil {
+		log.Printf("❌ Failed to parse order group: %v", err)
 		return
 	}
 
-	// 🟢 INSERT trade immediately
-	if err := ds.db.Create(&trade).Error; err != nil {
-		log.Printf("❌ Failed to insert trade: %v", err)
+	if strings.Contains(channel, "groupplaced") {
+		// 🟢 INSERT new group
+		if err := ds.db.Create(&group).Error; err != nil {
+			log.Printf("❌ Failed to insert order group: %v", err)
+		} else {
+			log.Printf("✅ Inserted %s group %s (%s)", group.Type, group.ID.String()[:8], group.MarketID)
+		}
 	} else {
-		log.Printf("✅ Inserted trade %s (%s: %s @ %s = $%s)",
-			trade.ID.String()[:8], trade.MarketID, trade.Quantity.String(), 
-			trade.Price.String(), trade.QuoteQuantity.String())
+		// 🟡 UPDATE existing group
+		if err := ds.db.Save(&group).Error; err != nil {
+			log.Printf("❌ Failed to update order group: %v", err)
+		} else {
+			log.Printf("✅ Updated group %s (Status: %s)", group.ID.String()[:8], group.Status)
+		}
 	}
 }
 
@@ -188,6 +214,34 @@ func (ds *DatabaseService) handleTickerEvent(payload string) {
 	ds.updateMarketStats(market, tickerStats)
 }
 
+func (ds *DatabaseService) handleMarketStatusEvent(payload string) {
+	var eventData struct {
+		Market string              `json:"market"`
+		Status models.MarketStatus `json:"status"`
+		Reason string              `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(payload), &eventData); err != nil {
+		log.Printf("❌ Failed to parse market status event: %v", err)
+		return
+	}
+
+	if eventData.Market == "" || eventData.Status == "" {
+		log.Printf("❌ Invalid market status event data")
+		return
+	}
+
+	// The engine owns the trading state; the table keeps it for restarts and listings
+	err := ds.db.Model(&models.Market{}).
+		Where("id = ?", models.MarketIDFromTicker(eventData.Market)).
+		Update("status", eventData.Status).Error
+	if err != nil {
+		log.Printf("❌ Failed to update status of market %s: %v", eventData.Market, err)
+		return
+	}
+
+	log.Printf("🚦 Market %s is now %s (%s)", eventData.Market, eventData.Status, eventData.Reason)
+}
+
 func (ds *DatabaseService) updateMarketStats(marketID string, stats map[string]interface{}) {
 	// Convert market ID format (BTC/USD -> BTCUSD)
 	dbMarketID := strings.Replace(marketID, "/", "", 1)
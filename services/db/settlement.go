@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	fundsEventAttempts = 5                      // Tries before a funds event is set aside as failed
+	fundsRetryInterval = time.Minute            // How often failed funds events are tried again
+	fundsRetryBackoff  = 200 * time.Millisecond // Grows with every attempt
+)
+
+// processFundsEvents applies the engine's lock changes and trade settlements one
+// at a time, in the order the engine made them. An event stays claimed in the
+// queue until it is handled, so one that was being applied when the service
+// stopped is applied again on start; the cursor then skips it if it had committed.
+func (ds *DatabaseService) processFundsEvents() {
+	log.Printf("👂 Listening for funds events: %s", broker.FundsQueue)
+
+	for {
+		payload, err := ds.broker.ClaimEvent(broker.FundsQueue)
+		if err != nil {
+			log.Printf("❌ Failed to read funds queue: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		ds.handleFundsEvent(payload)
+
+		if err := ds.broker.AckEvent(broker.FundsQueue, payload); err != nil {
+			log.Printf("❌ Failed to acknowledge funds event: %v", err)
+		}
+	}
+}
+
+// handleFundsEvent applies one funds event, retrying a few times as its trade can
+// arrive before the orders it references are stored. An event that still fails is
+// kept in failed_funds_events rather than lost, and the queue moves on.
+func (ds *DatabaseService) handleFundsEvent(payload string) {
+	var event messages.FundsEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Printf("❌ Failed to parse funds event: %v", err)
+		return
+	}
+
+	var err error
+	for attempt := 1; attempt <= fundsEventAttempts; attempt++ {
+		if err = ds.applyFundsEvent(&event, true); err == nil {
+			return
+		}
+		log.Printf("❌ Failed to apply funds event %s (attempt %d): %v", eventName(&event), attempt, err)
+		time.Sleep(time.Duration(attempt) * fundsRetryBackoff)
+	}
+
+	failed := &models.FailedFundsEvent{Payload: payload, Error: err.Error(), Attempts: fundsEventAttempts}
+	if err := ds.db.Create(failed).Error; err != nil {
+		log.Printf("❌ Failed to set aside funds event %s, it is lost: %v", eventName(&event), err)
+		return
+	}
+	log.Printf("🚧 Funds event %s set aside for retry", eventName(&event))
+}
+
+// retryFailedFundsEvents tries the funds events that were set aside again, oldest
+// first, until they apply. They are applied out of order, so they skip the cursor;
+// removing the row in the same transaction keeps them from applying twice.
+func (ds *DatabaseService) retryFailedFundsEvents() {
+	ticker := time.NewTicker(fundsRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var failed []models.FailedFundsEvent
+		if err := ds.db.Order("id").Find(&failed).Error; err != nil {
+			log.Printf("❌ Failed to load failed funds events: %v", err)
+			continue
+		}
+
+		for _, row := range failed {
+			var event messages.FundsEvent
+			if err := json.Unmarshal([]byte(row.Payload), &event); err != nil {
+				continue
+			}
+
+			err := ds.db.Transaction(func(tx *gorm.DB) error {
+				if err := applyFundsEvent(tx, &event, false); err != nil {
+					return err
+				}
+				return tx.Delete(&models.FailedFundsEvent{}, row.ID).Error
+			})
+			if err != nil {
+				ds.db.Model(&row).Updates(map[string]interface{}{"error": err.Error(), "attempts": row.Attempts + 1})
+				continue
+			}
+			log.Printf("✅ Funds event %s applied after %d attempts", eventName(&event), row.Attempts+1)
+		}
+	}
+}
+
+func (ds *DatabaseService) applyFundsEvent(event *messages.FundsEvent, ordered bool) error {
+	return ds.db.Transaction(func(tx *gorm.DB) error {
+		return applyFundsEvent(tx, event, ordered)
+	})
+}
+
+// applyFundsEvent applies a lock change or a trade settlement. Ordered events of
+// an engine journal move its cursor, and one at or before the cursor was already
+// applied and is skipped.
+func applyFundsEvent(tx *gorm.DB, event *messages.FundsEvent, ordered bool) error {
+	if ordered && event.Journal != "" {
+		cursor := models.FundsCursor{Journal: event.Journal}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&cursor).Limit(1).Find(&cursor).Error
+		if err != nil {
+			return err
+		}
+		if alreadyApplied(cursor, event) {
+			log.Printf("↩️ Funds event %s was already applied, skipped", eventName(event))
+			return nil
+		}
+
+		cursor.Sequence, cursor.Index = event.Sequence, event.Index
+		if err := tx.Save(&cursor).Error; err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case event.Balance != nil:
+		return applyBalanceChange(tx, event.Balance)
+	case event.Trade != nil && event.Settlement != nil:
+		return settleTrade(tx, event.Trade, event.Settlement)
+	}
+	return nil
+}
+
+// alreadyApplied reports whether an event of a journal is at or before its cursor.
+// Events are numbered by the engine command that made them and their place in it.
+func alreadyApplied(cursor models.FundsCursor, event *messages.FundsEvent) bool {
+	if event.Sequence != cursor.Sequence {
+		return event.Sequence < cursor.Sequence
+	}
+	return event.Index <= cursor.Index
+}
+
+// eventName identifies a funds event in the logs
+func eventName(event *messages.FundsEvent) string {
+	if event.Journal == "" {
+		return "correction"
+	}
+	return fmt.Sprintf("%s/%d/%d", event.Journal, event.Sequence, event.Index)
+}
+
+// applyBalanceChange applies funds the engine locked for or released from an order
+func applyBalanceChange(tx *gorm.DB, change *messages.BalanceChange) error {
+	if change.UserID == uuid.Nil || change.Asset == "" {
+		log.Printf("❌ Invalid balance event data")
+		return nil
+	}
+
+	if err := applyBalance(tx, change.UserID, change.Asset, change.Available, change.Locked); err != nil {
+		return err
+	}
+
+	log.Printf("🏦 %s %s %s for user %s", change.Reason, change.Locked.Abs().String(), change.Asset, change.UserID.String()[:8])
+	return nil
+}
+
+// settleTrade inserts a trade and applies its settlement to both sides' balances.
+// The trade row doubles as the record that it was settled: a trade that is already
+// there is skipped, so it never settles twice.
+func settleTrade(tx *gorm.DB, trade *models.Trade, settlement *messages.TradeSettlement) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(trade)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("↩️ Trade %s was already settled, skipped", trade.ID.String()[:8])
+		return nil
+	}
+
+	for _, side := range []*messages.SettlementSide{settlement.Buyer, settlement.Seller} {
+		if side == nil {
+			continue
+		}
+		if err := settleSide(tx, trade, side); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("✅ Inserted trade %s (%s: %s @ %s = $%s)",
+		trade.ID.String()[:8], trade.MarketID, trade.Quantity.String(),
+		trade.Price.String(), trade.QuoteQuantity.String())
+	return nil
+}
+
+// settleSide moves one side's funds: what its order locked for the fill is
+// released, the part spent leaves, and what it bought, net of the fee, arrives,
+// locked as far as it is reserved for bracket legs
+func settleSide(tx *gorm.DB, trade *models.Trade, side *messages.SettlementSide) error {
+	refund := side.Unlocked.Sub(side.Spent)
+	if err := applyBalance(tx, side.UserID, side.SpentAsset, refund, side.Unlocked.Neg()); err != nil {
+		return err
+	}
+
+	if err := applyBalance(tx, side.UserID, side.ReceivedAsset, side.Received.Sub(side.Reserved), side.Reserved); err != nil {
+		return err
+	}
+
+	log.Printf("🏦 Settled trade %s for user %s: -%s %s, +%s %s",
+		trade.ID.String()[:8], side.UserID.String()[:8],
+		side.Spent.String(), side.SpentAsset, side.Received.String(), side.ReceivedAsset)
+	return nil
+}
+
+// applyBalance adds available and locked to a user's balance of asset, creating
+// the balance if the user has none yet. The engine decides what a user can spend,
+// so a balance that goes negative is not refused but flagged: it means the
+// database and the engine no longer agree.
+func applyBalance(tx *gorm.DB, userID uuid.UUID, asset string, available, locked decimal.Decimal) error {
+	balance := &models.Balance{UserID: userID, Asset: asset, Available: available, Locked: locked}
+
+	err := tx.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "asset"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"available":  gorm.Expr("balances.available + excluded.available"),
+				"locked":     gorm.Expr("balances.locked + excluded.locked"),
+				"updated_at": gorm.Expr("excluded.updated_at"),
+			}),
+		},
+		clause.Returning{},
+	).Create(balance).Error
+	if err != nil {
+		return err
+	}
+
+	if balance.Available.IsNegative() || balance.Locked.IsNegative() {
+		log.Printf("🚩 Balance of user %s went negative: %s %s available, %s locked",
+			userID.String()[:8], balance.Available.String(), asset, balance.Locked.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+)
+
+func TestAlreadyApplied(t *testing.T) {
+	cursor := models.FundsCursor{Journal: "BTC_USD", Sequence: 10, Index: 3}
+
+	tests := []struct {
+		name     string
+		sequence uint64
+		index    uint64
+		applied  bool
+	}{
+		{"earlier command", 9, 7, true},
+		{"earlier event of the same command", 10, 2, true},
+		{"the event the cursor is at", 10, 3, true},
+		{"later event of the same command", 10, 4, false},
+		{"later command", 11, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &messages.FundsEvent{Journal: "BTC_USD", Sequence: tt.sequence, Index: tt.index}
+			if got := alreadyApplied(cursor, event); got != tt.applied {
+				t.Errorf("got %v, want %v", got, tt.applied)
+			}
+		})
+	}
+}
+
+func TestNewCursorAppliesEverything(t *testing.T) {
+	event := &messages.FundsEvent{Journal: "BTC_USD", Sequence: 1, Index: 1}
+	if alreadyApplied(models.FundsCursor{Journal: "BTC_USD"}, event) {
+		t.Error("the first event of a journal counts as applied")
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+)
+
+// endAuctions moves the markets whose timed auction is over to continuous
+// trading, which uncrosses their books
+func (e *Engine) endAuctions(now time.Time) {
+	for i := range e.Markets {
+		market := &e.Markets[i]
+		if market.AuctionEndsAt == nil || now.Before(*market.AuctionEndsAt) {
+			continue
+		}
+
+		if market.Status == models.MARKET_AUCTION {
+			e.transitionMarket(market, models.MARKET_OPEN, "Auction ended")
+		}
+		market.AuctionEndsAt = nil
+	}
+}
+
+// auctionDue reports whether a timed auction is over
+func (e *Engine) auctionDue(now time.Time) bool {
+	for _, market := range e.Markets {
+		if market.AuctionEndsAt != nil && !now.Before(*market.AuctionEndsAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// uncross ends a book's call auction and emits everything it executed. Its
+// trades go out like any other, and the auction price becomes the reference
+// the price band is measured from.
+func (e *Engine) uncross(ob *orderbook.OrderBook) {
+	market := ob.GetTicker()
+	result, state := ob.Uncross()
+
+	if state.Price != nil {
+		log.Printf("🔨 Auction in %s uncrossed at %s: %s traded in %d trades",
+			market, state.Price.String(), state.Volume.String(), len(result.GeneratedTrades))
+	} else {
+		log.Printf("🔨 Auction in %s ended without crossing orders", market)
+	}
+
+	delete(e.PriceHistory, market)
+	settlements := e.settleTrades(result)
+
+	for _, updatedOrder := range result.UpdatedOrders {
+		e.EmitOrderEvent("ORDER_UPDATED", market, updatedOrder)
+	}
+	for i, trade := range result.GeneratedTrades {
+		e.EmitTradeEvent("TRADE_EXECUTED", market, trade, settlements[i])
+		e.recordTradePrice(market, trade.Price)
+		e.EmitTickerUpdate(market, &trade)
+	}
+	for _, updatedOrder := range result.UpdatedOrders {
+		e.syncOrderGroup(updatedOrder)
+	}
+
+	e.EmitAuctionUpdate(market, state, true)
+	e.EmitOrderbookUpdate(market)
+
+	if len(result.GeneratedTrades) > 0 {
+		e.fireTriggeredOrders(ob, result.GeneratedTrades)
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestCallAuction(t *testing.T) {
+	engine := newTestEngine(t)
+	send(engine, "SET_MARKET_STATUS", messages.MarketStatusRequest{Market: testMarket, Status: models.MARKET_AUCTION, Reason: "opening"})
+
+	bid := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "101", "2"))
+	ask := placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+	if bid.Status != models.PENDING || ask.Status != models.PENDING {
+		t.Fatalf("crossing orders in the auction: got %s and %s, want both PENDING", bid.Status, ask.Status)
+	}
+	if state := engine.Orderbooks[0].IndicativeAuction(); state.Price == nil || !state.Volume.Equal(decimal.NewFromInt(1)) {
+		t.Fatalf("indicative auction: got %s at %v, want 1 to trade", state.Volume, state.Price)
+	}
+
+	// Halting the auction keeps its orders for later
+	send(engine, "SET_MARKET_STATUS", messages.MarketStatusRequest{Market: testMarket, Status: models.MARKET_HALTED, Reason: "test"})
+	if ask.Status != models.PENDING || !engine.Orderbooks[0].Auction {
+		t.Fatalf("halted auction: ask %s, want it still collected", ask.Status)
+	}
+
+	send(engine, "SET_MARKET_STATUS", messages.MarketStatusRequest{Market: testMarket, Status: models.MARKET_OPEN, Reason: "test"})
+	if engine.Orderbooks[0].Auction {
+		t.Fatal("book is still in the auction after the market opened")
+	}
+	if bid.Status != models.PARTIAL || ask.Status != models.FILLED {
+		t.Errorf("after uncrossing: got bid %s and ask %s, want PARTIAL and FILLED", bid.Status, ask.Status)
+	}
+	if len(engine.PriceHistory[testMarket]) != 1 {
+		t.Errorf("got %d prices in the band window, want the auction price alone", len(engine.PriceHistory[testMarket]))
+	}
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// UserBalances are one user's balances by asset
+type UserBalances map[string]models.Balance
+
+// BalanceCache is every user's balances as the engine trades them: Available
+// backs new orders and Locked is held by open ones. All market workers share it,
+// so unlike the rest of the engine it is safe for concurrent use.
+type BalanceCache struct {
+	mu        sync.Mutex
+	users     map[uuid.UUID]UserBalances
+	persisted map[uuid.UUID]map[string]decimal.Decimal // Locked as the balances table had it on start
+}
+
+func NewBalanceCache() *BalanceCache {
+	return &BalanceCache{
+		users:     make(map[uuid.UUID]UserBalances),
+		persisted: make(map[uuid.UUID]map[string]decimal.Decimal),
+	}
+}
+
+// LoadBalances reads the balances table, counting the funds events the database
+// set aside as failed as if they had applied: the engine made them, and the
+// database applies them later without telling the engine. Everything starts out
+// available: the market workers lock funds again for the open orders they recover.
+func LoadBalances(db *gorm.DB) (*BalanceCache, error) {
+	var balances []models.Balance
+	var failed []models.FailedFundsEvent
+
+	// Both from one snapshot, so an event retried meanwhile is counted once
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Find(&balances).Error; err != nil {
+			return err
+		}
+		return tx.Order("id").Find(&failed).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("loading balances: %w", err)
+	}
+
+	cache := loadedBalances(balances, failed)
+	log.Printf("🏦 Loaded %d balances from the database, %d failed funds events counted in", len(balances), len(failed))
+	return cache, nil
+}
+
+// loadedBalances builds the cache LoadBalances returns from what it read
+func loadedBalances(balances []models.Balance, failed []models.FailedFundsEvent) *BalanceCache {
+	cache := NewBalanceCache()
+	for _, balance := range balances {
+		cache.addPersisted(balance.UserID, balance.Asset, balance.Available, balance.Locked)
+	}
+
+	for _, row := range failed {
+		var event messages.FundsEvent
+		if err := json.Unmarshal([]byte(row.Payload), &event); err != nil {
+			log.Printf("⚠️ Failed funds event %d is unreadable, not counted: %v", row.ID, err)
+			continue
+		}
+
+		if change := event.Balance; change != nil {
+			cache.addPersisted(change.UserID, change.Asset, change.Available, change.Locked)
+		}
+		if event.Settlement == nil {
+			continue
+		}
+		for _, side := range []*messages.SettlementSide{event.Settlement.Buyer, event.Settlement.Seller} {
+			if side == nil {
+				continue
+			}
+			cache.addPersisted(side.UserID, side.SpentAsset, side.Unlocked.Sub(side.Spent), side.Unlocked.Neg())
+			cache.addPersisted(side.UserID, side.ReceivedAsset, side.Received.Sub(side.Reserved), side.Reserved)
+		}
+	}
+	return cache
+}
+
+// addPersisted adds to a balance as the database has it. Locked is remembered for
+// Reconcile and made available.
+func (c *BalanceCache) addPersisted(userID uuid.UUID, asset string, available, locked decimal.Decimal) {
+	if c.persisted[userID] == nil {
+		c.persisted[userID] = make(map[string]decimal.Decimal)
+	}
+	c.persisted[userID][asset] = c.persisted[userID][asset].Add(locked)
+
+	balance := c.get(userID, asset)
+	balance.Available = balance.Available.Add(available).Add(locked)
+	c.set(balance)
+}
+
+// Get returns a user's balance of one asset, zero if they never held it
+func (c *BalanceCache) Get(userID uuid.UUID, asset string) models.Balance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(userID, asset)
+}
+
+// Lock moves amount from available to locked if the user has that much available
+func (c *BalanceCache) Lock(userID uuid.UUID, asset string, amount decimal.Decimal) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	balance := c.get(userID, asset)
+	if balance.Available.LessThan(amount) {
+		return false
+	}
+
+	balance.Available = balance.Available.Sub(amount)
+	balance.Locked = balance.Locked.Add(amount)
+	c.set(balance)
+	return true
+}
+
+// Apply adds deltas to a user's available and locked balance without any check
+func (c *BalanceCache) Apply(userID uuid.UUID, asset string, available, locked decimal.Decimal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	balance := c.get(userID, asset)
+	balance.Available = balance.Available.Add(available)
+	balance.Locked = balance.Locked.Add(locked)
+	c.set(balance)
+}
+
+// Reconcile returns the changes that bring the balances table's locked amounts
+// in line with what the recovered open orders lock. Locks whose release never
+// reached the table, e.g. because the engine stopped first, are undone this way.
+func (c *BalanceCache) Reconcile() []messages.BalanceChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changes := []messages.BalanceChange{}
+	add := func(userID uuid.UUID, asset string, locked decimal.Decimal) {
+		diff := c.get(userID, asset).Locked.Sub(locked)
+		if diff.IsZero() {
+			return
+		}
+		changes = append(changes, messages.BalanceChange{
+			UserID:    userID,
+			Asset:     asset,
+			Available: diff.Neg(),
+			Locked:    diff,
+			Reason:    "RECONCILE",
+		})
+	}
+
+	for userID, assets := range c.persisted {
+		for asset, locked := range assets {
+			add(userID, asset, locked)
+		}
+	}
+	for userID, balances := range c.users {
+		for asset := range balances {
+			if _, known := c.persisted[userID][asset]; !known {
+				add(userID, asset, decimal.Zero)
+			}
+		}
+	}
+
+	c.persisted = make(map[uuid.UUID]map[string]decimal.Decimal)
+	return changes
+}
+
+func (c *BalanceCache) get(userID uuid.UUID, asset string) models.Balance {
+	if balance, exists := c.users[userID][asset]; exists {
+		return balance
+	}
+	return models.Balance{UserID: userID, Asset: asset}
+}
+
+func (c *BalanceCache) set(balance models.Balance) {
+	if c.users[balance.UserID] == nil {
+		c.users[balance.UserID] = make(UserBalances)
+	}
+	c.users[balance.UserID][balance.Asset] = balance
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestLoadedBalancesCountFailedFundsEvents(t *testing.T) {
+	user := uuid.New()
+
+	// The database has the buy's lock, but not the trade that spent it
+	trade, _ := json.Marshal(messages.FundsEvent{
+		Journal:  "BTC_USD",
+		Sequence: 2,
+		Index:    2,
+		Settlement: &messages.TradeSettlement{Buyer: &messages.SettlementSide{
+			UserID:        user,
+			SpentAsset:    "USD",
+			Spent:         decimal.RequireFromString("99"),
+			Unlocked:      decimal.RequireFromString("100"),
+			ReceivedAsset: "BTC",
+			Received:      decimal.RequireFromString("0.998"),
+			Reserved:      decimal.RequireFromString("0.5"),
+		}},
+	})
+	cache := loadedBalances(
+		[]models.Balance{{UserID: user, Asset: "USD", Available: decimal.RequireFromString("50"), Locked: decimal.RequireFromString("100")}},
+		[]models.FailedFundsEvent{{ID: 1, Payload: string(trade)}, {ID: 2, Payload: "not json"}},
+	)
+
+	// Everything starts out available until the workers lock their orders' funds
+	for asset, want := range map[string]string{"USD": "51", "BTC": "0.998"} {
+		balance := cache.Get(user, asset)
+		if !balance.Available.Equal(decimal.RequireFromString(want)) || !balance.Locked.IsZero() {
+			t.Errorf("%s: got %s available and %s locked, want %s and 0", asset, balance.Available, balance.Locked, want)
+		}
+	}
+
+	// Only what the reserve locks is left locked once the event has applied
+	cache.Apply(user, "BTC", decimal.RequireFromString("-0.5"), decimal.RequireFromString("0.5"))
+	if changes := cache.Reconcile(); len(changes) != 0 {
+		t.Errorf("got %d corrections, want none: %+v", len(changes), changes)
+	}
+}
@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// BootstrapSource is what a market worker with no journal or snapshot starts
+// from. Workers with history always recover from it instead.
+type BootstrapSource struct {
+	OpenOrders map[string][]models.Order      // Open orders from the database by market, oldest first
+	OpenGroups map[string][]models.OrderGroup // Their pending and active order groups by market
+	Seed       bool                           // Add demo liquidity
+}
+
+// RestoredOrders is what a RESTORE_ORDERS command puts back: a market's open
+// orders and the order groups they belong to
+type RestoredOrders struct {
+	Orders []models.Order      `json:"orders"`
+	Groups []models.OrderGroup `json:"groups"`
+}
+
+// NewBootstrapSource reads ENGINE_BOOTSTRAP: "seed" (the default) starts fresh
+// markets with demo liquidity, "database" with the open orders persisted in
+// Postgres, "database,seed" with both
+func NewBootstrapSource(db *gorm.DB, markets []models.Market) (*BootstrapSource, error) {
+	source := &BootstrapSource{OpenOrders: map[string][]models.Order{}, OpenGroups: map[string][]models.OrderGroup{}}
+
+	setting := os.Getenv("ENGINE_BOOTSTRAP")
+	if setting == "" {
+		setting = "seed"
+	}
+
+	for _, name := range strings.Split(setting, ",") {
+		switch strings.TrimSpace(name) {
+		case "seed":
+			source.Seed = true
+		case "database":
+			openOrders, err := LoadOpenOrders(db, markets)
+			if err != nil {
+				return nil, err
+			}
+			source.OpenOrders = openOrders
+
+			openGroups, err := LoadOpenGroups(db)
+			if err != nil {
+				return nil, err
+			}
+			source.OpenGroups = openGroups
+		default:
+			return nil, fmt.Errorf("unknown ENGINE_BOOTSTRAP source %q", name)
+		}
+	}
+
+	return source, nil
+}
+
+// LoadOpenOrders reads every PENDING and PARTIAL order from the database in time
+// priority and groups them by market. Orders in markets that are no longer
+// configured are reported and left out.
+func LoadOpenOrders(db *gorm.DB, markets []models.Market) (map[string][]models.Order, error) {
+	var orders []models.Order
+	err := db.Where("status IN ?", []models.OrderStatus{models.PENDING, models.PARTIAL}).
+		Order("created_at ASC, id ASC").
+		Find(&orders).Error
+	if err != nil {
+		return nil, fmt.Errorf("loading open orders: %w", err)
+	}
+
+	configured := make(map[string]bool)
+	for _, market := range markets {
+		configured[market.Ticker()] = true
+	}
+
+	byMarket := make(map[string][]models.Order)
+	unknown := make(map[string][]string)
+	for _, order := range orders {
+		if !configured[order.MarketID] {
+			unknown[order.MarketID] = append(unknown[order.MarketID], order.ID.String())
+			continue
+		}
+		byMarket[order.MarketID] = append(byMarket[order.MarketID], order)
+	}
+
+	for market, orderIDs := range unknown {
+		log.Printf("⚠️ %d open orders in market %s, which is not configured, were not loaded: %s",
+			len(orderIDs), market, strings.Join(orderIDs, ", "))
+	}
+
+	log.Printf("🗄️ Loaded %d open orders from the database", len(orders))
+	return byMarket, nil
+}
+
+// LoadOpenGroups reads every PENDING and ACTIVE order group from the database and
+// groups them by market
+func LoadOpenGroups(db *gorm.DB) (map[string][]models.OrderGroup, error) {
+	var groups []models.OrderGroup
+	err := db.Where("status IN ?", []models.OrderGroupStatus{models.GROUP_PENDING, models.GROUP_ACTIVE}).
+		Order("created_at ASC, id ASC").
+		Find(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("loading open order groups: %w", err)
+	}
+
+	byMarket := make(map[string][]models.OrderGroup)
+	for _, group := range groups {
+		byMarket[group.MarketID] = append(byMarket[group.MarketID], group)
+	}
+
+	log.Printf("🗄️ Loaded %d open order groups from the database", len(groups))
+	return byMarket, nil
+}
+
+// Bootstrap gives a fresh engine its starting state. It goes through the journal
+// like any command, so a restart replays it instead of loading again.
+func (e *Engine) Bootstrap(source *BootstrapSource) {
+	for _, market := range e.Markets {
+		if orders := source.OpenOrders[market.Ticker]; len(orders) > 0 {
+			e.Consume(&messages.MessageFromAPI{MessageType: "RESTORE_ORDERS", Data: RestoredOrders{
+				Orders: orders,
+				Groups: source.OpenGroups[market.Ticker],
+			}})
+		}
+	}
+
+	if source.Seed {
+		e.Consume(&messages.MessageFromAPI{MessageType: "SEED_MARKETS"})
+	}
+}
+
+// RestoreOrders puts open orders loaded from the database back where they were:
+// resting orders on their book, untriggered stops in the trigger book and the
+// legs of brackets still waiting for their entry with their group, in the order
+// given. Their groups are rebuilt first; an order whose group can't be is left
+// out rather than restored unprotected or unlinked. Nothing is persisted again;
+// the database already has them.
+func (e *Engine) RestoreOrders(restore RestoredOrders) int {
+	orders := make(map[uuid.UUID]*models.Order)
+	for i := range restore.Orders {
+		if order := &restore.Orders[i]; e.restorable(order) {
+			orders[order.ID] = order
+		}
+	}
+
+	rebuilt := 0
+	for i := range restore.Groups {
+		group := &restore.Groups[i]
+		if reason := e.rebuildGroup(group, orders); reason != "" {
+			log.Printf("⚠️ Group %s could not be rebuilt, its orders are not restored: %s", group.ID.String(), reason)
+			continue
+		}
+		rebuilt++
+	}
+
+	restored := 0
+	for i := range restore.Orders {
+		order := &restore.Orders[i]
+		if orders[order.ID] == nil {
+			continue
+		}
+		if order.GroupID != nil && e.Groups[*order.GroupID] == nil {
+			log.Printf("⚠️ Order %s not restored without its group %s", order.ID.String(), order.GroupID.String())
+			continue
+		}
+
+		ob, err := e.FindOrCreateOrderbook(order.MarketID)
+		if err != nil {
+			continue
+		}
+
+		if _, held := e.heldLeg(order); !held {
+			if order.Type.IsStop() {
+				e.triggerBook(order.MarketID).Add(order)
+			} else {
+				ob.RestOrder(order)
+			}
+			e.lockFunds(ob, order)
+		}
+
+		e.updateOrderIndex(order)
+		restored++
+	}
+
+	for _, market := range e.Markets {
+		e.EmitOrderbookUpdate(market.Ticker)
+	}
+
+	log.Printf("🗄️ Restored %d of %d open orders and %d of %d order groups", restored, len(restore.Orders), rebuilt, len(restore.Groups))
+	return restored
+}
+
+// restorable reports whether an open order from the database can go back into
+// this engine's books
+func (e *Engine) restorable(order *models.Order) bool {
+	if e.GetMarketByTicker(order.MarketID) == nil {
+		log.Printf("⚠️ Order %s is in market %s, which this engine does not run", order.ID.String(), order.MarketID)
+		return false
+	}
+	if order.RemainingQuantity.LessThanOrEqual(decimal.Zero) {
+		return false
+	}
+
+	// Only limit orders rest; anything else was mid-flight when it was persisted
+	if !order.Type.IsStop() && order.Price == nil {
+		log.Printf("⚠️ Order %s is a %s order and cannot rest, not restored", order.ID.String(), order.Type)
+		return false
+	}
+	return true
+}
+
+// rebuildGroup brings back an order group from the database with the restorable
+// orders that belong to it, or returns why it can't. An active group locks what
+// its legs need again under its own key; what a bracket entry's trades reserved
+// is not stored, and the balances are reconciled with the lock afterwards.
+func (e *Engine) rebuildGroup(group *models.OrderGroup, orders map[uuid.UUID]*models.Order) string {
+	ob, err := e.FindOrCreateOrderbook(group.MarketID)
+	if err != nil {
+		return err.Error()
+	}
+
+	state := &OrderGroupState{
+		Sequence:           e.Clock.Sequence(),
+		Group:              group,
+		TakeProfit:         orders[group.TakeProfitOrderID],
+		StopLoss:           orders[group.StopLossOrderID],
+		TakeProfitQuantity: group.TakeProfitQuantity,
+		StopLossQuantity:   group.StopLossQuantity,
+	}
+	if state.TakeProfit == nil || state.StopLoss == nil {
+		return "a leg is not open"
+	}
+	// Groups stored before the quantities were kept grow no further
+	if !state.TakeProfitQuantity.IsPositive() {
+		state.TakeProfitQuantity = state.TakeProfit.Quantity
+	}
+	if !state.StopLossQuantity.IsPositive() {
+		state.StopLossQuantity = state.StopLoss.Quantity
+	}
+	if group.ParentOrderID != nil {
+		state.Entry = orders[*group.ParentOrderID]
+	}
+
+	switch {
+	case group.Status == models.GROUP_PENDING && group.ParentOrderID != nil:
+		if state.Entry == nil {
+			return "its legs are held for an entry that is not open"
+		}
+		if state.TakeProfit.FilledQuantity.IsPositive() || state.StopLoss.FilledQuantity.IsPositive() {
+			return "its held legs have traded"
+		}
+
+	case group.Status == models.GROUP_ACTIVE:
+		// Active legs are unfilled, as the first trade on either ends the group,
+		// so they still cover the entry's position
+		state.Position = decimal.Max(state.TakeProfit.Quantity, state.StopLoss.Quantity)
+
+		lock := &FundLock{UserID: group.UserID, Asset: spendAsset(state.TakeProfit), Orders: []uuid.UUID{state.TakeProfit.ID, state.StopLoss.ID}}
+		if amount := groupFundsRequired(ob, state); amount.IsPositive() {
+			e.changeLock(group.ID, lock, amount)
+		}
+		e.Locks[group.ID] = lock
+
+	default:
+		return fmt.Sprintf("a %s group can't be %s", group.Type, group.Status)
+	}
+
+	e.Groups[group.ID] = state
+	return ""
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// savedOrder is an open order as LoadOpenOrders reads it from the database
+func savedOrder(side models.OrderSide, orderType models.OrderType, price, quantity, filled string, createdAt time.Time) models.Order {
+	order := models.Order{
+		ID:                uuid.New(),
+		UserID:            uuid.New(),
+		MarketID:          testMarket,
+		Side:              side,
+		Type:              orderType,
+		TimeInForce:       models.GTC,
+		Quantity:          *dec(quantity),
+		FilledQuantity:    *dec(filled),
+		RemainingQuantity: dec(quantity).Sub(*dec(filled)),
+		Status:            models.PENDING,
+		CreatedAt:         createdAt,
+		UpdatedAt:         createdAt,
+	}
+	if !order.FilledQuantity.IsZero() {
+		order.Status = models.PARTIAL
+	}
+	if orderType.IsStop() {
+		order.StopPrice = dec(price)
+	} else if price != "" {
+		order.Price = dec(price)
+	}
+	return order
+}
+
+func TestBootstrapRestoresOpenOrders(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	older := savedOrder(models.BUY, models.LIMIT, "99", "1", "0", start)
+	newer := savedOrder(models.BUY, models.LIMIT, "99", "1", "0", start.Add(time.Second))
+	partial := savedOrder(models.SELL, models.LIMIT, "101", "2", "1.5", start.Add(2*time.Second))
+	stop := savedOrder(models.SELL, models.STOP_MARKET, "90", "1", "0", start.Add(3*time.Second))
+	market := savedOrder(models.BUY, models.MARKET, "", "1", "0", start.Add(4*time.Second))
+	used := savedOrder(models.BUY, models.LIMIT, "98", "1", "1", start.Add(5*time.Second))
+
+	dir := t.TempDir()
+	engine := openTestEngine(t, dir)
+	engine.Bootstrap(&BootstrapSource{OpenOrders: map[string][]models.Order{
+		testMarket: {older, newer, partial, stop, market, used},
+	}})
+
+	if len(engine.OrderIndex) != 4 {
+		t.Fatalf("got %d orders restored, want 4", len(engine.OrderIndex))
+	}
+	for _, skipped := range []models.Order{market, used} {
+		if _, found := engine.OrderIndex[skipped.ID]; found {
+			t.Errorf("%s order with %s left was restored", skipped.Type, skipped.RemainingQuantity)
+		}
+	}
+	if stops := engine.triggerBook(testMarket).Orders; len(stops) != 1 || stops[0].ID != stop.ID {
+		t.Errorf("got %d stops waiting, want the restored stop", len(stops))
+	}
+	if ask := engine.OrderIndex[partial.ID].order; !ask.RemainingQuantity.Equal(decimal.RequireFromString("0.5")) {
+		t.Errorf("partly filled order: got %s left, want 0.5", ask.RemainingQuantity)
+	}
+
+	// Bootstrapping is journaled, so a restart comes back to the same books
+	want := engineState(t, engine)
+	engine.Journal.Close()
+	restarted := openTestEngine(t, dir)
+	if got := engineState(t, restarted); got != want {
+		t.Errorf("restarted state differs\n got: %s\nwant: %s", got, want)
+	}
+
+	// Restored orders keep their time priority
+	send(restarted, "CREATE_ORDER", limitOrder(uuid.New(), models.SELL, "99", "1"))
+	if _, found := restarted.OrderIndex[older.ID]; found {
+		t.Error("the newer bid filled before the older one")
+	}
+	if _, found := restarted.OrderIndex[newer.ID]; !found {
+		t.Error("the newer bid is gone")
+	}
+}
+
+// savedGroup links saved orders of one user into a group as the database has it
+func savedGroup(status models.OrderGroupStatus, entry, takeProfit, stopLoss *models.Order) models.OrderGroup {
+	group := models.OrderGroup{
+		ID:                uuid.New(),
+		UserID:            takeProfit.UserID,
+		MarketID:          testMarket,
+		Type:              models.OCO,
+		Status:            status,
+		TakeProfitOrderID: takeProfit.ID,
+		StopLossOrderID:   stopLoss.ID,
+	}
+	orders := []*models.Order{takeProfit, stopLoss}
+	if entry != nil {
+		group.Type = models.BRACKET
+		group.ParentOrderID = &entry.ID
+		orders = append(orders, entry)
+	}
+	for _, order := range orders {
+		order.UserID = group.UserID
+		order.GroupID = &group.ID
+	}
+	return group
+}
+
+func TestBootstrapRestoresOrderGroups(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	saved := func(side models.OrderSide, orderType models.OrderType, price string) models.Order {
+		start = start.Add(time.Second)
+		return savedOrder(side, orderType, price, "1", "0", start)
+	}
+
+	// An OCO protecting a position
+	ocoTakeProfit, ocoStopLoss := saved(models.SELL, models.LIMIT, "110"), saved(models.SELL, models.STOP_MARKET, "90")
+	oco := savedGroup(models.GROUP_ACTIVE, nil, &ocoTakeProfit, &ocoStopLoss)
+
+	// A bracket whose legs are held until its entry fills
+	entry := saved(models.BUY, models.LIMIT, "100")
+	heldTakeProfit, heldStopLoss := saved(models.SELL, models.LIMIT, "111"), saved(models.SELL, models.STOP_MARKET, "89")
+	pending := savedGroup(models.GROUP_PENDING, &entry, &heldTakeProfit, &heldStopLoss)
+
+	// A bracket whose entry is done and whose stop-loss is gone from the
+	// database, and one whose entry is gone while its legs are held: neither can
+	// be rebuilt, so none of their orders are restored
+	brokenTakeProfit, brokenStopLoss := saved(models.SELL, models.LIMIT, "112"), saved(models.SELL, models.STOP_MARKET, "88")
+	filledEntry := saved(models.BUY, models.LIMIT, "100")
+	broken := savedGroup(models.GROUP_ACTIVE, &filledEntry, &brokenTakeProfit, &brokenStopLoss)
+	orphanEntry := saved(models.BUY, models.LIMIT, "98")
+	orphanTakeProfit, orphanStopLoss := saved(models.SELL, models.LIMIT, "113"), saved(models.SELL, models.STOP_MARKET, "87")
+	orphaned := savedGroup(models.GROUP_PENDING, &orphanEntry, &orphanTakeProfit, &orphanStopLoss)
+
+	dir := t.TempDir()
+	engine := openTestEngine(t, dir)
+	engine.Bootstrap(&BootstrapSource{
+		OpenOrders: map[string][]models.Order{
+			testMarket: {ocoTakeProfit, ocoStopLoss, entry, heldTakeProfit, heldStopLoss, brokenTakeProfit, orphanTakeProfit, orphanStopLoss},
+		},
+		OpenGroups: map[string][]models.OrderGroup{testMarket: {oco, pending, broken, orphaned}},
+	})
+
+	if len(engine.Groups) != 2 || engine.Groups[oco.ID] == nil || engine.Groups[pending.ID] == nil {
+		t.Fatalf("got %d groups rebuilt, want the OCO and the pending bracket", len(engine.Groups))
+	}
+	if len(engine.OrderIndex) != 5 {
+		t.Errorf("got %d orders restored, want both groups' 5", len(engine.OrderIndex))
+	}
+	for _, order := range []models.Order{brokenTakeProfit, orphanTakeProfit, orphanStopLoss} {
+		if _, found := engine.OrderIndex[order.ID]; found {
+			t.Errorf("order %s of a group that could not be rebuilt was restored", order.ID)
+		}
+	}
+
+	// The OCO's legs share one lock under the group's key
+	if lock := engine.Locks[oco.ID]; lock == nil || !lock.Amount.Equal(decimal.NewFromInt(1)) || len(lock.Orders) != 2 {
+		t.Errorf("OCO lock: got %+v, want 1 BTC for both legs", lock)
+	}
+
+	// The held legs wait outside the books
+	if asks := engine.Orderbooks[0].Asks.Len(); asks != 1 {
+		t.Errorf("got %d asks, want only the OCO's take-profit", asks)
+	}
+	if held := engine.heldGroupOrders(pending.UserID, testMarket); len(held) != 2 {
+		t.Errorf("got %d held legs, want 2", len(held))
+	}
+
+	// A restart rebuilds the same groups from the journal
+	want := engineState(t, engine)
+	engine.Journal.Close()
+	restarted := openTestEngine(t, dir)
+	if got := engineState(t, restarted); got != want {
+		t.Errorf("restarted state differs\n got: %s\nwant: %s", got, want)
+	}
+	if len(restarted.Groups) != 2 {
+		t.Fatalf("restart rebuilt %d groups, want 2", len(restarted.Groups))
+	}
+
+	// The groups work as before: the entry's fill places the held legs, and the
+	// OCO's take-profit filling cancels its stop-loss
+	placeOrder(t, restarted, limitOrder(uuid.New(), models.SELL, "100", "1"))
+	if state := restarted.Groups[pending.ID]; state == nil || state.Group.Status != models.GROUP_ACTIVE {
+		t.Errorf("bracket not activated by its entry's fill")
+	}
+	placeOrder(t, restarted, limitOrder(uuid.New(), models.BUY, "110", "1"))
+	if _, found := restarted.OrderIndex[ocoStopLoss.ID]; found || restarted.Groups[oco.ID] != nil {
+		t.Error("the OCO's stop-loss outlived its take-profit's fill")
+	}
+}
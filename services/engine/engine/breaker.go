@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/shopspring/decimal"
+)
+
+// reasonPriceBandExceeded is set on orders that would trade outside their
+// market's price band
+const reasonPriceBandExceeded = "PRICE_BAND_EXCEEDED"
+
+// CircuitBreaker limits how far a market's price may move in a period of time.
+// An order that would trade beyond the band is rejected and halts the market.
+type CircuitBreaker struct {
+	Band     decimal.Decimal `json:"band"`     // Largest move within Window as a fraction of the price, zero turns the breaker off
+	Window   time.Duration   `json:"window"`   // How far back trades count towards the band
+	Cooldown time.Duration   `json:"cooldown"` // How long a breach halts the market
+
+	// Length of the call auction that reopens the market after the cooldown, zero
+	// reopens straight into continuous trading
+	Reopening time.Duration `json:"reopening"`
+}
+
+// Equal reports whether two circuit breakers are set up the same
+func (b CircuitBreaker) Equal(other CircuitBreaker) bool {
+	return b.Band.Equal(other.Band) && b.Window == other.Window && b.Cooldown == other.Cooldown &&
+		b.Reopening == other.Reopening
+}
+
+// PricePoint is a trade price and when it traded
+type PricePoint struct {
+	Price decimal.Decimal `json:"price"`
+	Time  time.Time       `json:"time"`
+}
+
+// recordTradePrice remembers a trade price for the market's price band and
+// forgets the ones that have left its window
+func (e *Engine) recordTradePrice(market string, price decimal.Decimal) {
+	now := e.Clock.Now()
+	e.PriceHistory[market] = append(e.recentPrices(market, now), PricePoint{Price: price, Time: now})
+}
+
+// recentPrices returns the trade prices inside the market's price band window
+func (e *Engine) recentPrices(market string, now time.Time) []PricePoint {
+	points := e.PriceHistory[market]
+
+	window := time.Duration(0)
+	if m := e.GetMarketByTicker(market); m != nil {
+		window = m.Breaker.Window
+	}
+
+	start := 0
+	for start < len(points) && now.Sub(points[start].Time) > window {
+		start++
+	}
+	return points[start:]
+}
+
+// priceBand returns the lowest and highest price the market may trade at now.
+// ok is false when the market has no circuit breaker, or nothing to measure a
+// move against yet.
+func (e *Engine) priceBand(ob *orderbook.OrderBook, market *Market) (low, high decimal.Decimal, ok bool) {
+	if !market.Breaker.Band.IsPositive() {
+		return low, high, false
+	}
+
+	prices := []decimal.Decimal{}
+	for _, point := range e.recentPrices(market.Ticker, e.Clock.Now()) {
+		prices = append(prices, point.Price)
+	}
+	if len(prices) == 0 {
+		reference := bandReference(ob)
+		if reference == nil {
+			return low, high, false
+		}
+		prices = append(prices, *reference)
+	}
+
+	lowest, highest := prices[0], prices[0]
+	for _, price := range prices[1:] {
+		lowest = decimal.Min(lowest, price)
+		highest = decimal.Max(highest, price)
+	}
+
+	one := decimal.NewFromInt(1)
+	return highest.Mul(one.Sub(market.Breaker.Band)), lowest.Mul(one.Add(market.Breaker.Band)), true
+}
+
+// bandReference is what a move is measured against when nothing traded within
+// the window: the last trade, or the middle of the book if the market hasn't
+// traded yet
+func bandReference(ob *orderbook.OrderBook) *decimal.Decimal {
+	if ob.CurrentPrice.IsPositive() {
+		price := ob.CurrentPrice
+		return &price
+	}
+
+	bestBid, bestAsk := ob.BestBid(), ob.BestAsk()
+	if bestBid != nil && bestAsk != nil {
+		mid := bestBid.Add(*bestAsk).Div(decimal.NewFromInt(2))
+		return &mid
+	}
+	if bestBid != nil {
+		return bestBid
+	}
+	return bestAsk
+}
+
+// checkPriceBand trips the market's circuit breaker if the order would trade
+// outside the price band, and reports whether it did. Only continuous trading
+// is watched; in the other states orders can't take liquidity anyway.
+func (e *Engine) checkPriceBand(ob *orderbook.OrderBook, order *models.Order) bool {
+	market := e.GetMarketByTicker(ob.GetTicker())
+	if market == nil || market.Status != models.MARKET_OPEN {
+		return false
+	}
+
+	low, high, ok := e.priceBand(ob, market)
+	if !ok {
+		return false
+	}
+
+	sweep := ob.SweepPrice(order)
+	if sweep == nil || (sweep.GreaterThanOrEqual(low) && sweep.LessThanOrEqual(high)) {
+		return false
+	}
+
+	e.tripCircuitBreaker(market, order, *sweep, low, high)
+	return true
+}
+
+// tripCircuitBreaker halts a market whose price band an order would have broken
+// until the cooldown is over, and raises the alert
+func (e *Engine) tripCircuitBreaker(market *Market, order *models.Order, price, low, high decimal.Decimal) {
+	haltedUntil := e.Clock.Now().Add(market.Breaker.Cooldown)
+	market.HaltedUntil = &haltedUntil
+
+	log.Printf("🚨 Circuit breaker tripped in %s: order %s would trade at %s, band is %s to %s",
+		market.Ticker, order.ID.String(), price.String(), low.String(), high.String())
+
+	e.transitionMarket(market, models.MARKET_HALTED,
+		fmt.Sprintf("Circuit breaker: price %s outside %s to %s", price.String(), low.String(), high.String()))
+	e.EmitCircuitBreakerAlert(market.Ticker, order, price, low, high, haltedUntil)
+}
+
+// resumeHaltedMarkets reopens the markets whose circuit breaker cooldown is
+// over, through a reopening auction if the market has one
+func (e *Engine) resumeHaltedMarkets(now time.Time) {
+	for i := range e.Markets {
+		market := &e.Markets[i]
+		if market.HaltedUntil == nil || now.Before(*market.HaltedUntil) {
+			continue
+		}
+
+		market.HaltedUntil = nil
+		if market.Status != models.MARKET_HALTED {
+			continue
+		}
+
+		if market.Breaker.Reopening > 0 {
+			auctionEndsAt := now.Add(market.Breaker.Reopening)
+			market.AuctionEndsAt = &auctionEndsAt
+			e.transitionMarket(market, models.MARKET_AUCTION, "Circuit breaker cooldown over, reopening auction")
+			continue
+		}
+		e.transitionMarket(market, models.MARKET_OPEN, "Circuit breaker cooldown over")
+	}
+}
+
+// resumeDue reports whether a market's circuit breaker cooldown is over
+func (e *Engine) resumeDue(now time.Time) bool {
+	for _, market := range e.Markets {
+		if market.HaltedUntil != nil && !now.Before(*market.HaltedUntil) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.Markets[0].Breaker = CircuitBreaker{Band: decimal.RequireFromString("0.05"), Window: time.Minute, Cooldown: time.Minute, Reopening: time.Minute}
+
+	trade(t, engine, "100")
+	placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "104", "1"))
+	placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "110", "1"))
+
+	// Inside the band the market trades as usual
+	inBand := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "104", "1"))
+	if inBand.Status != models.FILLED {
+		t.Fatalf("order inside the band: got %s (%s), want FILLED", inBand.Status, inBand.StatusReason)
+	}
+
+	// Sweeping to 110 is more than 5% away from the trades in the window
+	outOfBand := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "110", "1"))
+	if outOfBand.Status != models.REJECTED || outOfBand.StatusReason != reasonPriceBandExceeded {
+		t.Fatalf("order outside the band: got %s (%s), want REJECTED (%s)", outOfBand.Status, outOfBand.StatusReason, reasonPriceBandExceeded)
+	}
+	market := engine.GetMarketByTicker(testMarket)
+	if market.Status != models.MARKET_HALTED || market.HaltedUntil == nil {
+		t.Fatalf("market is %s, want it halted until the cooldown is over", market.Status)
+	}
+	if ask := engine.Orderbooks[0].BestAsk(); ask == nil || !ask.Equal(decimal.NewFromInt(110)) {
+		t.Errorf("best ask is %v, want the 110 ask untouched", ask)
+	}
+
+	// The market stays halted until the cooldown is over
+	engine.Tick(market.HaltedUntil.Add(-time.Second))
+	if market.Status != models.MARKET_HALTED {
+		t.Fatalf("market is %s before the cooldown is over, want HALTED", market.Status)
+	}
+	engine.Tick(market.HaltedUntil.Add(time.Second))
+	if market.Status != models.MARKET_AUCTION || market.HaltedUntil != nil || market.AuctionEndsAt == nil {
+		t.Fatalf("market is %s after the cooldown, want a timed reopening auction", market.Status)
+	}
+
+	// The reopening auction takes the order the band refused and uncrosses it when it ends
+	buyer := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "110", "1"))
+	if buyer.Status != models.PENDING {
+		t.Fatalf("order in the auction: got %s (%s), want PENDING", buyer.Status, buyer.StatusReason)
+	}
+	engine.Tick(market.AuctionEndsAt.Add(time.Second))
+	if market.Status != models.MARKET_OPEN || market.AuctionEndsAt != nil {
+		t.Fatalf("market is %s after the auction, want MARKET_OPEN", market.Status)
+	}
+	if buyer.Status != models.FILLED || !engine.Orderbooks[0].CurrentPrice.Equal(decimal.NewFromInt(110)) {
+		t.Errorf("auction: buyer %s, last price %s, want the buyer filled at 110", buyer.Status, engine.Orderbooks[0].CurrentPrice)
+	}
+}
@@ -0,0 +1,545 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How often the coordinator checks on start whether the database has applied the
+// funds queue, and how many checks go by between log lines
+const (
+	fundsWaitInterval = 500 * time.Millisecond
+	fundsWaitLogEvery = 20
+)
+
+// Coordinator serves the requests that are not about a single market. It runs one
+// Shard per market and either routes a request to the shard that owns it or fans
+// it out to every shard and merges the answers.
+type Coordinator struct {
+	Shards    map[string]*Shard // By market ticker
+	Directory *OrderDirectory
+	Balances  *BalanceCache
+	Broker    *broker.Broker
+
+	shardsMu sync.RWMutex // Markets can be listed while a shutdown snapshot reads Shards
+}
+
+// NewCoordinator recovers the worker of every market. They move no funds until
+// AttachBalances.
+func NewCoordinator(brokerClient *broker.Broker, markets []models.Market, bootstrap *BootstrapSource) *Coordinator {
+	coordinator := &Coordinator{
+		Shards:    make(map[string]*Shard),
+		Directory: NewOrderDirectory(),
+		Broker:    brokerClient,
+	}
+
+	for _, definition := range markets {
+		shard, err := NewShard(brokerClient, definition, coordinator.Directory, nil, bootstrap)
+		if err != nil {
+			log.Fatalf("❌ Failed to start engine worker: %v", err)
+		}
+		coordinator.Shards[shard.Market.Ticker] = shard
+	}
+
+	return coordinator
+}
+
+// AttachBalances loads the balances every market shares once the database has
+// applied every funds event the engine sent, including those the markets sent
+// again as they replayed their journals, and hands them to the workers. Balances
+// read any earlier would miss what those events move, and nothing would ever add
+// it to them.
+func (c *Coordinator) AttachBalances(db *gorm.DB) error {
+	for _, shard := range c.Shards {
+		shard.engine.FlushFundsEvents()
+	}
+	c.waitForFundsEvents()
+
+	balances, err := LoadBalances(db)
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range c.Shards {
+		shard.engine.AttachBalances(balances)
+	}
+	c.Balances = balances
+
+	c.reconcileBalances()
+	return nil
+}
+
+// waitForFundsEvents blocks until the funds queue is empty and nothing in it is
+// still being applied
+func (c *Coordinator) waitForFundsEvents() {
+	for attempt := 0; ; attempt++ {
+		pending, err := c.Broker.PendingEvents(broker.FundsQueue)
+		if err == nil && pending == 0 {
+			return
+		}
+
+		if attempt%fundsWaitLogEvery == 0 {
+			if err != nil {
+				log.Printf("❌ Failed to check the funds queue: %v", err)
+			} else {
+				log.Printf("⏳ Waiting for the database to apply %d funds events before loading balances", pending)
+			}
+		}
+		time.Sleep(fundsWaitInterval)
+	}
+}
+
+// reconcileBalances corrects the locked balances in the database to what the
+// recovered open orders of every market lock
+func (c *Coordinator) reconcileBalances() {
+	changes := c.Balances.Reconcile()
+	for _, change := range changes {
+		data, _ := json.Marshal(messages.FundsEvent{Balance: &change})
+		if err := c.Broker.PushEvent(broker.FundsQueue, data); err != nil {
+			log.Printf("❌ Failed to publish balance correction for user %s: %v", change.UserID.String(), err)
+		}
+	}
+
+	if len(changes) > 0 {
+		log.Printf("🏦 Corrected %d locked balances to what open orders hold", len(changes))
+	}
+}
+
+// Run starts every market worker and then serves the coordinator queue
+func (c *Coordinator) Run() {
+	tickers := []string{}
+	for ticker, shard := range c.Shards {
+		go shard.Run()
+		tickers = append(tickers, ticker)
+	}
+
+	// From here on the gateway sends each market's requests straight to its worker
+	if err := c.Broker.SetEngineMarkets(tickers); err != nil {
+		log.Printf("❌ Failed to register engine markets, requests will go through the coordinator: %v", err)
+	}
+
+	for {
+		message, err := c.Broker.BRPop(broker.CoordinatorQueue)
+		if err != nil {
+			log.Printf("error is %v", err)
+			continue
+		}
+
+		c.Consume(message)
+	}
+}
+
+func (c *Coordinator) Consume(message *messages.MessageFromAPI) {
+	dataBytes, _ := json.Marshal(message.Data)
+
+	switch message.MessageType {
+	// Market requests sent to the coordinator queue still reach their market
+	case "CREATE_ORDER":
+		var orderReq messages.OrderRequest
+		json.Unmarshal(dataBytes, &orderReq)
+		c.forwardToMarket(message, orderReq.MarketID)
+
+	case "CREATE_ORDER_GROUP":
+		var groupReq messages.OrderGroupRequest
+		json.Unmarshal(dataBytes, &groupReq)
+		c.forwardToMarket(message, groupReq.MarketID)
+
+	case "GET_DEPTH":
+		var getDepthReq messages.GetDepthRequest
+		json.Unmarshal(dataBytes, &getDepthReq)
+		c.forwardToMarket(message, getDepthReq.Market)
+
+	case "GET_OPEN_ORDERS":
+		var getOpenOrdersReq messages.GetOpenOrdersRequest
+		if err := json.Unmarshal(dataBytes, &getOpenOrdersReq); err != nil {
+			log.Printf("Failed to parse getOpenOrders request: %v", err)
+			return
+		}
+
+		if getOpenOrdersReq.Market != "" {
+			c.forwardToMarket(message, getOpenOrdersReq.Market)
+			return
+		}
+
+		var mu sync.Mutex
+		orders := []models.Order{}
+		c.fanOut(func(e *Engine) {
+			open, _ := e.GetOpenOrders(getOpenOrdersReq.UserID, "")
+			mu.Lock()
+			defer mu.Unlock()
+			orders = append(orders, open...)
+		})
+
+		c.Broker.PublishToClient("OPEN_ORDERS", message.ClientId, messages.OpenOrdersResponse{Orders: orders})
+
+	case "CANCEL_ALL":
+		var cancelAllReq messages.CancelAllOrdersRequest
+		if err := json.Unmarshal(dataBytes, &cancelAllReq); err != nil {
+			log.Printf("Failed to parse cancel all request: %v", err)
+			return
+		}
+
+		if cancelAllReq.Market != "" {
+			c.forwardToMarket(message, cancelAllReq.Market)
+			return
+		}
+
+		var mu sync.Mutex
+		cancelledIDs := []string{}
+		c.fanOut(func(e *Engine) {
+			if err := e.Record(message); err != nil {
+				log.Printf("❌ Failed to journal %s, dropping it: %v", message.MessageType, err)
+				return
+			}
+			cancelled := e.CancelAllOrders(cancelAllReq)
+			mu.Lock()
+			defer mu.Unlock()
+			cancelledIDs = append(cancelledIDs, cancelled...)
+		})
+
+		c.Broker.PublishToClient("ORDERS_CANCELLED", message.ClientId, messages.CancelAllOrdersResponse{
+			Success:  true,
+			Message:  fmt.Sprintf("%d orders cancelled", len(cancelledIDs)),
+			OrderIDs: cancelledIDs,
+		})
+
+	// Requests about one order go to the market the directory says owns it
+	case "CANCEL_ORDER", "MODIFY_ORDER", "GET_ORDER":
+		var target struct {
+			OrderID string `json:"order_id"`
+		}
+		json.Unmarshal(dataBytes, &target)
+
+		if orderID, err := uuid.Parse(target.OrderID); err == nil {
+			if market, found := c.Directory.Market(orderID); found {
+				c.forwardToMarket(message, market)
+				return
+			}
+		}
+
+		c.replyOrderNotFound(message)
+
+	case "SET_SELF_TRADE_PREVENTION":
+		var stpReq messages.SelfTradePreventionRequest
+		if err := json.Unmarshal(dataBytes, &stpReq); err != nil {
+			log.Printf("Failed to parse self-trade prevention request: %v", err)
+			return
+		}
+
+		// Every market keeps its own copy of the account settings
+		var mu sync.Mutex
+		var response messages.SelfTradePreventionResponse
+		c.fanOut(func(e *Engine) {
+			if err := e.Record(message); err != nil {
+				log.Printf("❌ Failed to journal %s, dropping it: %v", message.MessageType, err)
+				return
+			}
+			shardResponse := e.SetSelfTradePrevention(stpReq)
+			mu.Lock()
+			defer mu.Unlock()
+			response = shardResponse
+		})
+
+		c.Broker.PublishToClient("SELF_TRADE_PREVENTION", message.ClientId, response)
+
+	case "SET_FEE_TIER":
+		var tierReq messages.FeeTierRequest
+		if err := json.Unmarshal(dataBytes, &tierReq); err != nil {
+			log.Printf("Failed to parse fee tier request: %v", err)
+			return
+		}
+
+		// Every market charges fees itself, so each needs the user's tier
+		var mu sync.Mutex
+		var response messages.FeeTierResponse
+		c.fanOut(func(e *Engine) {
+			if err := e.Record(message); err != nil {
+				log.Printf("❌ Failed to journal %s, dropping it: %v", message.MessageType, err)
+				return
+			}
+			shardResponse := e.SetFeeTier(tierReq)
+			mu.Lock()
+			defer mu.Unlock()
+			response = shardResponse
+		})
+
+		c.Broker.PublishToClient("FEE_TIER", message.ClientId, response)
+
+	case "LOG_ORDERBOOK":
+		var mu sync.Mutex
+		response := &OrderbooksResponse{Orderbooks: []OrderbookInfo{}}
+		c.fanOut(func(e *Engine) {
+			shardResponse := e.LogOrderbooks()
+			mu.Lock()
+			defer mu.Unlock()
+			response.TotalOrderbooks += shardResponse.TotalOrderbooks
+			response.Orderbooks = append(response.Orderbooks, shardResponse.Orderbooks...)
+		})
+
+		c.Broker.PublishToClient("ORDERBOOK_LOG", message.ClientId, response)
+
+	case "GET_MARKETS":
+		// Each worker knows its market's current rules and trading state
+		var mu sync.Mutex
+		markets := []Market{}
+		c.fanOut(func(e *Engine) {
+			listed := e.GetAllMarkets()
+			mu.Lock()
+			defer mu.Unlock()
+			markets = append(markets, listed...)
+		})
+
+		sort.Slice(markets, func(i, j int) bool {
+			return markets[i].Ticker < markets[j].Ticker
+		})
+		c.Broker.PublishToClient("MARKETS", message.ClientId, markets)
+
+	case "UPDATE_MARKET":
+		var updateMarketReq messages.UpdateMarketRequest
+		if err := json.Unmarshal(dataBytes, &updateMarketReq); err != nil {
+			log.Printf("Failed to parse update market request: %v", err)
+			return
+		}
+
+		c.updateMarket(message, updateMarketReq.Market)
+
+	case "SET_MARKET_STATUS":
+		var marketStatusReq messages.MarketStatusRequest
+		json.Unmarshal(dataBytes, &marketStatusReq)
+		c.forwardToMarket(message, marketStatusReq.Market)
+
+	case "SNAPSHOT":
+		snapshots := c.Snapshot()
+
+		response := messages.SnapshotResponse{Success: true, Message: "Snapshot written", Snapshots: snapshots}
+		for _, snapshot := range snapshots {
+			if snapshot.Error != "" {
+				response.Success = false
+				response.Message = "Some markets could not be snapshotted"
+			}
+		}
+
+		c.Broker.PublishToClient("SNAPSHOT", message.ClientId, response)
+
+	case "TICK":
+		for _, shard := range c.Shards {
+			shard.Submit(message)
+		}
+	}
+}
+
+// Snapshot makes every market worker write a snapshot now
+func (c *Coordinator) Snapshot() []messages.MarketSnapshot {
+	return c.snapshotShards((*Shard).Snapshot)
+}
+
+// Shutdown stops every market worker after its last snapshot, which waits for
+// its funds events to be pushed
+func (c *Coordinator) Shutdown() []messages.MarketSnapshot {
+	return c.snapshotShards((*Shard).Stop)
+}
+
+// snapshotShards snapshots every market worker at once with take
+func (c *Coordinator) snapshotShards(take func(*Shard) (uint64, error)) []messages.MarketSnapshot {
+	c.shardsMu.RLock()
+	defer c.shardsMu.RUnlock()
+
+	var mu sync.Mutex
+	snapshots := []messages.MarketSnapshot{}
+
+	var wg sync.WaitGroup
+	for _, shard := range c.Shards {
+		wg.Add(1)
+		go func(shard *Shard) {
+			defer wg.Done()
+
+			snapshot := messages.MarketSnapshot{Market: shard.Market.Ticker}
+			sequence, err := take(shard)
+			if err != nil {
+				log.Printf("❌ Failed to snapshot %s: %v", shard.Market.Ticker, err)
+				snapshot.Error = err.Error()
+			}
+			snapshot.Sequence = sequence
+
+			mu.Lock()
+			defer mu.Unlock()
+			snapshots = append(snapshots, snapshot)
+		}(shard)
+	}
+	wg.Wait()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Market < snapshots[j].Market
+	})
+	return snapshots
+}
+
+// forwardToMarket hands a request to the worker of its market. The worker replies
+// to the client itself.
+func (c *Coordinator) forwardToMarket(message *messages.MessageFromAPI, market string) {
+	shard, exists := c.Shards[strings.Replace(market, "_", "/", 1)]
+	if !exists {
+		log.Printf("❌ No engine worker for market %q, rejecting %s", market, message.MessageType)
+		c.replyUnknownMarket(message)
+		return
+	}
+	shard.Submit(message)
+}
+
+// updateMarket starts a worker for a newly listed market, or hands the new
+// definition to the worker that runs the market, which journals it and replies.
+// A delisted market's worker keeps running until the engine restarts, rejecting
+// orders, but no longer lists the market.
+func (c *Coordinator) updateMarket(message *messages.MessageFromAPI, definition models.Market) {
+	market := MarketFromModel(definition)
+
+	shard, exists := c.Shards[market.Ticker]
+	if exists {
+		shard.Submit(message)
+		return
+	}
+
+	if definition.DelistedAt != nil {
+		c.Broker.PublishToClient("MARKET_UPDATED", message.ClientId, messages.UpdateMarketResponse{
+			Success: true,
+			Message: "Market was not running",
+		})
+		return
+	}
+
+	// A new market starts with an empty book
+	shard, err := NewShard(c.Broker, definition, c.Directory, c.Balances, &BootstrapSource{})
+	if err != nil {
+		log.Printf("❌ Failed to start engine worker for %s: %v", market.Ticker, err)
+		c.Broker.PublishToClient("MARKET_UPDATED", message.ClientId, messages.UpdateMarketResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.shardsMu.Lock()
+	c.Shards[market.Ticker] = shard
+	c.shardsMu.Unlock()
+
+	go shard.Run()
+	if err := c.Broker.AddEngineMarket(market.Ticker); err != nil {
+		log.Printf("❌ Failed to register %s, its requests will go through the coordinator: %v", market.Ticker, err)
+	}
+
+	log.Printf("🆕 Market %s listed", market.Ticker)
+	c.Broker.PublishToClient("MARKET_UPDATED", message.ClientId, messages.UpdateMarketResponse{
+		Success: true,
+		Message: "Market listed",
+	})
+}
+
+// fanOut runs fn on every market worker and waits until all of them are done.
+// fn runs on the workers' goroutines concurrently, so it must lock anything it
+// shares with the other calls.
+func (c *Coordinator) fanOut(fn func(e *Engine)) {
+	var wg sync.WaitGroup
+	for _, shard := range c.Shards {
+		wg.Add(1)
+		go func(shard *Shard) {
+			defer wg.Done()
+			shard.Do(fn)
+		}(shard)
+	}
+	wg.Wait()
+}
+
+// replyUnknownMarket answers a market request for a market no worker runs
+func (c *Coordinator) replyUnknownMarket(message *messages.MessageFromAPI) {
+	dataBytes, _ := json.Marshal(message.Data)
+
+	switch message.MessageType {
+	case "CREATE_ORDER":
+		var orderReq messages.OrderRequest
+		json.Unmarshal(dataBytes, &orderReq)
+
+		// Never persisted: there is no market for it to belong to
+		now := time.Now()
+		c.Broker.PublishToClient("ORDER_UPDATE", message.ClientId, &models.Order{
+			ID:                uuid.New(),
+			UserID:            orderReq.UserID,
+			MarketID:          orderReq.MarketID,
+			Side:              orderReq.Side,
+			Type:              orderReq.Type,
+			TimeInForce:       orderReq.TimeInForce,
+			Quantity:          orderReq.Quantity,
+			Price:             orderReq.Price,
+			StopPrice:         orderReq.StopPrice,
+			RemainingQuantity: orderReq.Quantity,
+			Status:            models.REJECTED,
+			StatusReason:      reasonUnknownMarket,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		})
+	case "CREATE_ORDER_GROUP":
+		c.Broker.PublishToClient("ORDER_GROUP", message.ClientId, messages.OrderGroupResponse{
+			Success: false,
+			Message: reasonUnknownMarket,
+		})
+	case "GET_DEPTH":
+		var getDepthReq messages.GetDepthRequest
+		json.Unmarshal(dataBytes, &getDepthReq)
+
+		c.Broker.PublishToClient("DEPTH", message.ClientId, messages.DepthResponse{
+			Market: getDepthReq.Market,
+			Bids:   [][2]string{},
+			Asks:   [][2]string{},
+			Error:  ErrUnknownMarket.Error(),
+		})
+	case "GET_OPEN_ORDERS":
+		c.Broker.PublishToClient("OPEN_ORDERS", message.ClientId, messages.OpenOrdersResponse{
+			Orders: []models.Order{},
+			Error:  ErrUnknownMarket.Error(),
+		})
+	case "CANCEL_ALL":
+		c.Broker.PublishToClient("ORDERS_CANCELLED", message.ClientId, messages.CancelAllOrdersResponse{
+			Success:  true,
+			Message:  "0 orders cancelled",
+			OrderIDs: []string{},
+		})
+	case "SET_MARKET_STATUS":
+		c.Broker.PublishToClient("MARKET_STATUS", message.ClientId, messages.MarketStatusResponse{
+			Success: false,
+			Message: reasonUnknownMarket,
+		})
+	}
+}
+
+// replyOrderNotFound answers a single-order request for an order no market owns
+func (c *Coordinator) replyOrderNotFound(message *messages.MessageFromAPI) {
+	switch message.MessageType {
+	case "CANCEL_ORDER":
+		c.Broker.PublishToClient("ORDER_CANCELLED", message.ClientId, messages.CancelOrderResponse{
+			Success: false,
+			Message: "Order cancellation failed",
+			OrderId: "",
+		})
+	case "MODIFY_ORDER":
+		c.Broker.PublishToClient("ORDER_MODIFIED", message.ClientId, messages.ModifyOrderResponse{
+			Success: false,
+			Message: orderbook.ErrOrderNotFound.Error(),
+		})
+	case "GET_ORDER":
+		c.Broker.PublishToClient("ORDER", message.ClientId, messages.GetOrderResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+	}
+}
@@ -18,38 +18,24 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-type UserBalances map[string]models.Balance
-type BalanceCache map[uuid.UUID]UserBalances
+// Market is a listed market as the engine runs it. Markets are listed, changed
+// and delisted in the markets table; see MarketFromModel.
 type Market struct {
-	Name   string `json:"name"`
-	Ticker string `json:"ticker"`
-}
-
-var AvailableMarkets = []Market{
-	{"Bitcoin", "BTC/USD"},
-	{"Ethereum", "ETH/USD"},
-	{"USDT", "USDT/USD"},
-	{"Solana", "SOL/USD"},
-	{"Dogecoin", "DOGE/USD"},
-	{"Chainlink", "LINK/USD"},
-	{"Sui", "SUI/USD"},
-	{"Shiba Inu", "SHIB/USD"},
-	{"Render", "RENDER/USD"},
-	{"Sei", "SEI/USD"},
-	{"Ondo", "ONDO/USD"},
-	{"Worldcoin", "WLD/USD"},
-	{"Pudgy Penguins", "PENGU/USD"},
-	{"Pepe", "PEPE/USD"},
-	{"Aptos", "APT/USD"},
-	{"POL (ex-MATIC)", "POL/USD"},
-	{"Uniswap", "UNI/USD"},
-	{"Ethena", "ENA/USD"},
-	{"Aave", "AAVE/USD"},
+	Name    string              `json:"name"`
+	Ticker  string              `json:"ticker"`
+	Rules   TradingRules        `json:"rules"`
+	Breaker CircuitBreaker      `json:"circuit_breaker"`
+	Fees    FeeSchedule         `json:"fees"`
+	Active  bool                `json:"active"` // Inactive markets keep their book but take no new orders
+	Status  models.MarketStatus `json:"status"` // Trading state, changed with SET_MARKET_STATUS
+
+	HaltedUntil   *time.Time `json:"halted_until,omitempty"`    // When a circuit breaker halt ends
+	AuctionEndsAt *time.Time `json:"auction_ends_at,omitempty"` // When a timed call auction uncrosses
 }
 
 // MarketSeedData contains realistic pricing data for seeding
 type MarketSeedData struct {
-	Market    Market
+	Ticker    string
 	BasePrice float64 // Current market price
 	Spread    float64 // Bid-ask spread percentage (e.g., 0.001 = 0.1%)
 	Depth     int     // Number of levels on each side
@@ -57,40 +43,69 @@ type MarketSeedData struct {
 
 // HIGH LIQUIDITY market data for realistic demo
 var MarketSeedingData = []MarketSeedData{
-	{AvailableMarkets[0], 111227.70, 0.0002, 50}, // BTC/USD - 50 levels each side
-	{AvailableMarkets[1], 4296.38, 0.0003, 40},   // ETH/USD - 40 levels each side
-	{AvailableMarkets[2], 1.0001, 0.0001, 30},    // USDT/USD - 30 levels each side
-	{AvailableMarkets[3], 207.27, 0.0004, 35},    // SOL/USD - 35 levels each side
-	{AvailableMarkets[4], 0.23229, 0.0005, 25},   // DOGE/USD - 25 levels each side
-	{AvailableMarkets[5], 22.427, 0.0003, 30},    // LINK/USD - 30 levels each side
-	{AvailableMarkets[6], 3.397, 0.0004, 25},     // SUI/USD - 25 levels each side
-	{AvailableMarkets[7], 0.00001255, 0.0008, 20}, // SHIB/USD - 20 levels each side
-	{AvailableMarkets[8], 3.572, 0.0005, 20},     // RENDER/USD - 20 levels each side
-	{AvailableMarkets[9], 0.29544, 0.0006, 20},   // SEI/USD - 20 levels each side
-	{AvailableMarkets[10], 0.9155, 0.0004, 20},   // ONDO/USD - 20 levels each side
-	{AvailableMarkets[11], 1.2728, 0.0005, 20},   // WLD/USD - 20 levels each side
-	{AvailableMarkets[12], 0.03131, 0.0008, 15},  // PENGU/USD - 15 levels each side
-	{AvailableMarkets[13], 0.00001001, 0.0008, 15}, // PEPE/USD - 15 levels each side
-	{AvailableMarkets[14], 4.322, 0.0005, 20},    // APT/USD - 20 levels each side
-	{AvailableMarkets[15], 0.2779, 0.0006, 20},   // POL/USD - 20 levels each side
-	{AvailableMarkets[16], 9.40, 0.0004, 25},     // UNI/USD - 25 levels each side
-	{AvailableMarkets[17], 0.765, 0.0005, 20},    // ENA/USD - 20 levels each side
-	{AvailableMarkets[18], 299.59, 0.0003, 35},   // AAVE/USD - 35 levels each side
+	{"BTC/USD", 111227.70, 0.0002, 50},   // 50 levels each side
+	{"ETH/USD", 4296.38, 0.0003, 40},     // 40 levels each side
+	{"USDT/USD", 1.0001, 0.0001, 30},     // 30 levels each side
+	{"SOL/USD", 207.27, 0.0004, 35},      // 35 levels each side
+	{"DOGE/USD", 0.23229, 0.0005, 25},    // 25 levels each side
+	{"LINK/USD", 22.427, 0.0003, 30},     // 30 levels each side
+	{"SUI/USD", 3.397, 0.0004, 25},       // 25 levels each side
+	{"SHIB/USD", 0.00001255, 0.0008, 20}, // 20 levels each side
+	{"RENDER/USD", 3.572, 0.0005, 20},    // 20 levels each side
+	{"SEI/USD", 0.29544, 0.0006, 20},     // 20 levels each side
+	{"ONDO/USD", 0.9155, 0.0004, 20},     // 20 levels each side
+	{"WLD/USD", 1.2728, 0.0005, 20},      // 20 levels each side
+	{"PENGU/USD", 0.03131, 0.0008, 15},   // 15 levels each side
+	{"PEPE/USD", 0.00001001, 0.0008, 15}, // 15 levels each side
+	{"APT/USD", 4.322, 0.0005, 20},       // 20 levels each side
+	{"POL/USD", 0.2779, 0.0006, 20},      // 20 levels each side
+	{"UNI/USD", 9.40, 0.0004, 25},        // 25 levels each side
+	{"ENA/USD", 0.765, 0.0005, 20},       // 20 levels each side
+	{"AAVE/USD", 299.59, 0.0003, 35},     // 35 levels each side
 }
 
+
 type Engine struct {
-	Orderbooks []*orderbook.OrderBook
-	Markets    []Market
-	Balances   BalanceCache
-	Broker     *broker.Broker
+	Orderbooks          []*orderbook.OrderBook
+	TriggerBooks        map[string]*TriggerBook                  // Untriggered stop orders per market
+	Groups              map[uuid.UUID]*OrderGroupState           // Live OCO and bracket groups
+	SelfTradePrevention map[uuid.UUID]models.SelfTradePrevention // Account defaults, orders may override
+	FeeTiers            map[uuid.UUID]int                        // Users above tier 0
+	OrderIndex          map[uuid.UUID]indexedOrder               // Live orders by ID across this engine's markets
+	Directory           *OrderDirectory                          // Shared with the other market workers, nil when running alone
+	PriceHistory        map[string][]PricePoint                  // Trade prices inside each market's price band window
+	Markets             []Market
+	Locks               map[uuid.UUID]*FundLock // Funds held by live orders, by order or OCO group ID
+	Balances            *BalanceCache           // Shared with the other market workers, nil until attached
+	Broker              *broker.Broker
+	Journal             *Journal      // Every state-changing command, written before it is applied
+	Clock               *CommandClock // Time and IDs of the command being applied
+	SnapshotPath        string        // Latest snapshot, which the journal continues from
+
+	replaying        bool         // Rebuilding from the journal: nothing is published but funds events
+	snapshotSequence uint64       // Last journaled command covered by the snapshot file
+	held             *fundsHold   // Locked for the command being applied by holdFunds
+	fundsOutbox      *fundsOutbox // Funds events waiting to be pushed, in the order they were made
 }
 
-func NewEngine(broker *broker.Broker) *Engine {
+// NewEngine creates an engine that owns the orderbooks of the given markets and
+// rebuilds them from the latest snapshot and the journal after it. An engine
+// without either is empty until it is bootstrapped.
+func NewEngine(broker *broker.Broker, markets []Market, journal *Journal, snapshotPath string) (*Engine, error) {
 	engine := &Engine{
-		Orderbooks: []*orderbook.OrderBook{},
-		Markets:    AvailableMarkets,
-		Balances:   make(BalanceCache),
-		Broker:     broker,
+		Orderbooks:          []*orderbook.OrderBook{},
+		TriggerBooks:        make(map[string]*TriggerBook),
+		Groups:              make(map[uuid.UUID]*OrderGroupState),
+		SelfTradePrevention: make(map[uuid.UUID]models.SelfTradePrevention),
+		FeeTiers:            make(map[uuid.UUID]int),
+		OrderIndex:          make(map[uuid.UUID]indexedOrder),
+		PriceHistory:        make(map[string][]PricePoint),
+		Markets:             markets,
+		Locks:               make(map[uuid.UUID]*FundLock),
+		Broker:              broker,
+		Journal:             journal,
+		Clock:               NewCommandClock(journal.Name),
+		SnapshotPath:        snapshotPath,
 	}
 
 	err := engine.InitializeMarketOrderbooks()
@@ -98,13 +113,38 @@ func NewEngine(broker *broker.Broker) *Engine {
 		log.Printf("Warning: Failed to initialize some market orderbooks: %v", err)
 	}
 
-	// Seed markets with demo orders for frontend demo
-	err = engine.SeedMarketsWithOrders()
+	err = engine.Recover()
 	if err != nil {
-		log.Printf("Warning: Failed to seed some markets: %v", err)
+		return nil, err
 	}
 
-	return engine
+	return engine, nil
+}
+
+// Recover loads the latest snapshot and applies every command journaled after it
+// without publishing anything, which brings the books back to where they were
+// when the engine stopped
+func (e *Engine) Recover() error {
+	sequence, err := e.loadSnapshot()
+	if err != nil {
+		return fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	e.replaying = true
+	defer func() { e.replaying = false }()
+
+	replayed, err := e.Journal.Replay(sequence, func(entry JournalEntry) {
+		e.Clock.Start(entry)
+		e.apply(entry.Message)
+	})
+	if err != nil {
+		return fmt.Errorf("replaying journal: %w", err)
+	}
+
+	if replayed > 0 {
+		log.Printf("📼 Replayed %d journaled commands, %d live orders restored", replayed, len(e.OrderIndex))
+	}
+	return nil
 }
 
 func (e *Engine) InitializeMarketOrderbooks() error {
@@ -127,18 +167,23 @@ func (e *Engine) InitializeMarketOrderbooks() error {
 func (e *Engine) SeedMarketsWithOrders() error {
 	log.Printf("🌱 Seeding markets with HIGH LIQUIDITY demo orders...")
 
-	// Create multiple demo user IDs for variety
+	// Create multiple demo user IDs for variety. They hold no balances, so their
+	// orders lock no funds and their side of a trade is not settled.
 	demoUsers := make([]uuid.UUID, 5)
 	for i := range demoUsers {
-		demoUsers[i] = uuid.New()
+		demoUsers[i] = e.Clock.NewID()
 	}
 
 	totalOrders := 0
 	for _, seedData := range MarketSeedingData {
+		if e.GetMarketByTicker(seedData.Ticker) == nil {
+			continue
+		}
+
 		orders := e.seedMarketOrders(seedData, demoUsers)
 		totalOrders += orders
 		log.Printf("✓ Seeded %s with %d levels (%d total orders)", 
-			seedData.Market.Ticker, seedData.Depth, orders)
+			seedData.Ticker, seedData.Depth, orders)
 	}
 
 	log.Printf("🎉 HIGH LIQUIDITY seeding completed! %d total orders across all markets.", totalOrders)
@@ -147,12 +192,15 @@ func (e *Engine) SeedMarketsWithOrders() error {
 
 // seedMarketOrders creates realistic bid and ask orders for a specific market
 func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID) int {
-	orderbook, err := e.FindOrCreateOrderbook(seedData.Market.Ticker)
+	orderbook, err := e.FindOrCreateOrderbook(seedData.Ticker)
 	if err != nil {
-		log.Printf("Failed to seed market %s: %v", seedData.Market.Ticker, err)
+		log.Printf("Failed to seed market %s: %v", seedData.Ticker, err)
 		return 0
 	}
 
+	// Seed orders skip validation, so they are put on the market's ticks and steps here
+	tradingRules := e.marketRules(seedData.Ticker)
+
 	basePrice := decimal.NewFromFloat(seedData.BasePrice)
 	spreadPercent := decimal.NewFromFloat(seedData.Spread)
 
@@ -167,18 +215,18 @@ func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID)
 	for i := 0; i < seedData.Depth; i++ {
 		// Much smaller price steps for tighter liquidity
 		priceReduction := decimal.NewFromFloat(0.0001 + float64(i)*0.00005) // 0.01% to 0.26%
-		price := bestBid.Sub(basePrice.Mul(priceReduction))
+		price := tradingRules.RoundPrice(bestBid.Sub(basePrice.Mul(priceReduction)))
 
 		// Create 2-4 orders at each price level for deep liquidity
 		ordersAtLevel := 2 + (i % 3) // 2-4 orders per level
 		for j := 0; j < ordersAtLevel; j++ {
-			quantity := e.generateHighLiquidityQuantity(seedData.Market.Ticker, price, j)
+			quantity := tradingRules.RoundQuantity(e.generateHighLiquidityQuantity(seedData.Ticker, price, j))
 			userID := userIDs[j%len(userIDs)] // Rotate through users
 
 			bidOrder := &models.Order{
-				ID:                uuid.New(),
+				ID:                e.Clock.NewID(),
 				UserID:            userID,
-				MarketID:          seedData.Market.Ticker,
+				MarketID:          seedData.Ticker,
 				Side:              models.BUY,
 				Type:              models.LIMIT,
 				Quantity:          quantity,
@@ -186,11 +234,12 @@ func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID)
 				FilledQuantity:    decimal.Zero,
 				RemainingQuantity: quantity,
 				Status:            models.PENDING,
-				CreatedAt:         time.Now().Add(-time.Duration(i*10+j) * time.Second),
-				UpdatedAt:         time.Now(),
+				CreatedAt:         e.Clock.Now().Add(-time.Duration(i*10+j) * time.Second),
+				UpdatedAt:         e.Clock.Now(),
 			}
 
 			orderbook.AddOrder(bidOrder)
+			e.updateOrderIndex(bidOrder)
 			orderCount++
 		}
 	}
@@ -199,18 +248,18 @@ func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID)
 	for i := 0; i < seedData.Depth; i++ {
 		// Much smaller price steps for tighter liquidity
 		priceIncrease := decimal.NewFromFloat(0.0001 + float64(i)*0.00005) // 0.01% to 0.26%
-		price := bestAsk.Add(basePrice.Mul(priceIncrease))
+		price := tradingRules.RoundPrice(bestAsk.Add(basePrice.Mul(priceIncrease)))
 
 		// Create 2-4 orders at each price level for deep liquidity
 		ordersAtLevel := 2 + (i % 3) // 2-4 orders per level
 		for j := 0; j < ordersAtLevel; j++ {
-			quantity := e.generateHighLiquidityQuantity(seedData.Market.Ticker, price, j)
+			quantity := tradingRules.RoundQuantity(e.generateHighLiquidityQuantity(seedData.Ticker, price, j))
 			userID := userIDs[j%len(userIDs)] // Rotate through users
 
 			askOrder := &models.Order{
-				ID:                uuid.New(),
+				ID:                e.Clock.NewID(),
 				UserID:            userID,
-				MarketID:          seedData.Market.Ticker,
+				MarketID:          seedData.Ticker,
 				Side:              models.SELL,
 				Type:              models.LIMIT,
 				Quantity:          quantity,
@@ -218,11 +267,12 @@ func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID)
 				FilledQuantity:    decimal.Zero,
 				RemainingQuantity: quantity,
 				Status:            models.PENDING,
-				CreatedAt:         time.Now().Add(-time.Duration(i*10+j) * time.Second),
-				UpdatedAt:         time.Now(),
+				CreatedAt:         e.Clock.Now().Add(-time.Duration(i*10+j) * time.Second),
+				UpdatedAt:         e.Clock.Now(),
 			}
 
 			orderbook.AddOrder(askOrder)
+			e.updateOrderIndex(askOrder)
 			orderCount++
 		}
 	}
@@ -232,44 +282,45 @@ func (e *Engine) seedMarketOrders(seedData MarketSeedData, userIDs []uuid.UUID)
 
 // generateHighLiquidityQuantity creates much larger quantities for high liquidity appearance
 func (e *Engine) generateHighLiquidityQuantity(ticker string, price decimal.Decimal, variation int) decimal.Decimal {
-	// Use variation for different order sizes at same price level
-	rand.Seed(int64(len(ticker)*1000 + variation*100))
+	// Use variation for different order sizes at same price level. The source is
+	// local and seeded so a journal replay seeds exactly the same quantities.
+	rng := rand.New(rand.NewSource(int64(len(ticker)*1000 + variation*100)))
 	
 	// Create different quantity ranges based on asset type with MUCH higher liquidity
 	switch {
 	case strings.Contains(ticker, "BTC"):
 		// Bitcoin: 0.1 to 15 BTC per order (much higher than before)
-		base := 0.1 + rand.Float64()*14.9
+		base := 0.1 + rng.Float64()*14.9
 		return decimal.NewFromFloat(base)
 
 	case strings.Contains(ticker, "ETH"):
 		// Ethereum: 1 to 100 ETH per order (much higher)
-		base := 1 + rand.Float64()*99
+		base := 1 + rng.Float64()*99
 		return decimal.NewFromFloat(base)
 
 	case strings.Contains(ticker, "USDT") || strings.Contains(ticker, "USD"):
 		// Stablecoins: 1000 to 500000 (very high liquidity)
-		base := 1000 + rand.Float64()*499000
+		base := 1000 + rng.Float64()*499000
 		return decimal.NewFromFloat(base)
 
 	case strings.Contains(ticker, "SHIB") || strings.Contains(ticker, "PEPE"):
 		// Meme coins: 10M to 1B tokens (massive liquidity)
-		base := 10000000 + rand.Float64()*990000000
+		base := 10000000 + rng.Float64()*990000000
 		return decimal.NewFromFloat(base)
 
 	case strings.Contains(ticker, "DOGE"):
 		// Dogecoin: 10K to 1M DOGE (high liquidity)
-		base := 10000 + rand.Float64()*990000
+		base := 10000 + rng.Float64()*990000
 		return decimal.NewFromFloat(base)
 
 	case strings.Contains(ticker, "SOL"):
 		// Solana: 10 to 1000 SOL (high liquidity)
-		base := 10 + rand.Float64()*990
+		base := 10 + rng.Float64()*990
 		return decimal.NewFromFloat(base)
 
 	default:
 		// Other altcoins: 10 to 5000 tokens (much higher)
-		base := 10 + rand.Float64()*4990
+		base := 10 + rng.Float64()*4990
 		return decimal.NewFromFloat(base)
 	}
 }
@@ -279,15 +330,77 @@ func (e *Engine) GetAllMarkets() []Market {
 }
 
 func (e *Engine) GetMarketByTicker(ticker string) *Market {
-	for _, market := range e.Markets {
-		if market.Ticker == ticker {
-			return &market
+	for i := range e.Markets {
+		if e.Markets[i].Ticker == ticker {
+			return &e.Markets[i]
 		}
 	}
 	return nil
 }
 
+// journaledCommands are the messages that change engine state. Everything else is
+// a read and is not journaled.
+var journaledCommands = map[string]bool{
+	"CREATE_ORDER":              true,
+	"CREATE_ORDER_GROUP":        true,
+	"CANCEL_ORDER":              true,
+	"MODIFY_ORDER":              true,
+	"CANCEL_ALL":                true,
+	"SET_SELF_TRADE_PREVENTION": true,
+	"TICK":                      true,
+	"SEED_MARKETS":              true,
+	"RESTORE_ORDERS":            true,
+	"UPDATE_MARKET":             true,
+	"SET_MARKET_STATUS":         true,
+	"SET_FEE_TIER":              true,
+}
+
 func (e *Engine) Consume(message *messages.MessageFromAPI) {
+	if journaledCommands[message.MessageType] {
+		// Ticks that have nothing to expire change nothing, keep them out of the journal
+		if message.MessageType == "TICK" && !e.tickDue(time.Now()) {
+			return
+		}
+
+		// Orders the user can't pay for are refused before they reach the journal
+		if !e.holdFunds(message) {
+			e.refuseUnfunded(message)
+			return
+		}
+		defer e.releaseHold()
+
+		if err := e.Record(message); err != nil {
+			log.Printf("❌ Failed to journal %s, dropping it: %v", message.MessageType, err)
+			return
+		}
+	}
+
+	e.apply(message)
+}
+
+// Record journals a command and sets the clock to it. Consume does this itself;
+// callers that apply a command by calling the engine directly must record it first.
+func (e *Engine) Record(message *messages.MessageFromAPI) error {
+	entry, err := e.Journal.Append(message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	e.Clock.Start(entry)
+	return nil
+}
+
+// reply answers the client that sent a command. Replayed commands were answered
+// the first time round.
+func (e *Engine) reply(eventType string, clientId string, data interface{}) {
+	if e.replaying || clientId == "" {
+		return
+	}
+	e.Broker.PublishToClient(eventType, clientId, data)
+}
+
+// apply executes one command against the engine state
+func (e *Engine) apply(message *messages.MessageFromAPI) {
 	switch message.MessageType {
 	case "CREATE_ORDER":
 		dataBytes, _ := json.Marshal(message.Data)
@@ -307,11 +420,11 @@ func (e *Engine) Consume(message *messages.MessageFromAPI) {
 			fmt.Printf("error processing the order")
 		}
 
-		e.Broker.PublishToClient("ORDER_UPDATE", message.ClientId, order)
+		e.reply("ORDER_UPDATE", message.ClientId, order)
 
 	case "LOG_ORDERBOOK":
 		response := e.LogOrderbooks()
-		e.Broker.PublishToClient("ORDERBOOK_LOG", message.ClientId, response)
+		e.reply("ORDERBOOK_LOG", message.ClientId, response)
 
 	case "GET_DEPTH":
 		dataBytes, _ := json.Marshal(message.Data)
@@ -324,9 +437,12 @@ func (e *Engine) Consume(message *messages.MessageFromAPI) {
 			log.Printf("Failed to parse getDepth request")
 		}
 
-		depth := e.GetDepth(getDepthReq.Market)
+		depth, err := e.GetDepth(getDepthReq.Market)
+		if err != nil {
+			depth = &messages.DepthResponse{Market: getDepthReq.Market, Bids: [][2]string{}, Asks: [][2]string{}, Error: err.Error()}
+		}
 
-		e.Broker.PublishToClient("DEPTH", message.ClientId, depth)
+		e.reply("DEPTH", message.ClientId, depth)
 
 	case "GET_OPEN_ORDERS":
 		dataBytes, _ := json.Marshal(message.Data)
@@ -342,13 +458,41 @@ func (e *Engine) Consume(message *messages.MessageFromAPI) {
 			return
 		}
 
-		orders := e.GetOpenOrders(getOpenOrdersReq.UserID, getOpenOrdersReq.Market)
+		orders, err := e.GetOpenOrders(getOpenOrdersReq.UserID, getOpenOrdersReq.Market)
+		if err != nil {
+			e.reply("OPEN_ORDERS", message.ClientId, messages.OpenOrdersResponse{Orders: orders, Error: err.Error()})
+			return
+		}
 
-		e.Broker.PublishToClient("OPEN_ORDERS", message.ClientId, orders)
+		e.reply("OPEN_ORDERS", message.ClientId, messages.OpenOrdersResponse{Orders: orders})
 
 	case "GET_MARKETS":
 		markets := e.GetAllMarkets()
-		e.Broker.PublishToClient("MARKETS", message.ClientId, markets)
+		e.reply("MARKETS", message.ClientId, markets)
+
+	case "UPDATE_MARKET":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var updateMarketReq messages.UpdateMarketRequest
+		if err := json.Unmarshal(dataBytes, &updateMarketReq); err != nil {
+			log.Printf("Failed to parse update market request: %v", err)
+			return
+		}
+
+		response := e.UpdateMarket(updateMarketReq.Market)
+		e.reply("MARKET_UPDATED", message.ClientId, response)
+
+	case "SET_MARKET_STATUS":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var marketStatusReq messages.MarketStatusRequest
+		if err := json.Unmarshal(dataBytes, &marketStatusReq); err != nil {
+			log.Printf("Failed to parse market status request: %v", err)
+			return
+		}
+
+		response := e.SetMarketStatus(marketStatusReq)
+		e.reply("MARKET_STATUS", message.ClientId, response)
 
 	
 	case "CANCEL_ORDER":
@@ -363,23 +507,167 @@ func (e *Engine) Consume(message *messages.MessageFromAPI) {
 			return 
 		}
 
-		cancelledOrder, success := e.CancelOrder(cancelOrderRequest)
+		cancelledOrder, err := e.CancelOrder(cancelOrderRequest)
 		
 		// Prepare response
-		if success && cancelledOrder != nil {
-			e.Broker.PublishToClient("ORDER_CANCELLED", message.ClientId, messages.CancelOrderResponse{
+		if err == nil && cancelledOrder != nil {
+			e.reply("ORDER_CANCELLED", message.ClientId, messages.CancelOrderResponse{
 				Success: true,
 				Message: "Order cancelled successfully",
 				OrderId: cancelOrderRequest.OrderID,
 			})
 		} else {
-			e.Broker.PublishToClient("ORDER_CANCELLED", message.ClientId, messages.CancelOrderResponse{
+			failure := "Order cancellation failed"
+			if rejection, ok := err.(*RejectionError); ok {
+				failure = rejection.Error()
+			}
+			e.reply("ORDER_CANCELLED", message.ClientId, messages.CancelOrderResponse{
 				Success: false,
-				Message: "Order cancellation failed",
+				Message: failure,
 				OrderId: "",
 			})
 		}
 
+	case "MODIFY_ORDER":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var modifyReq messages.ModifyOrderRequest
+
+		err := json.Unmarshal(dataBytes, &modifyReq)
+
+		if err != nil {
+			log.Printf("Failed to parse modify order request: %v", err)
+			return
+		}
+
+		order, err := e.ModifyOrder(modifyReq)
+
+		if err != nil {
+			e.reply("ORDER_MODIFIED", message.ClientId, messages.ModifyOrderResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		e.reply("ORDER_MODIFIED", message.ClientId, messages.ModifyOrderResponse{
+			Success: true,
+			Message: "Order modified successfully",
+			Order:   order,
+		})
+
+	case "CANCEL_ALL":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var cancelAllReq messages.CancelAllOrdersRequest
+
+		err := json.Unmarshal(dataBytes, &cancelAllReq)
+
+		if err != nil {
+			log.Printf("Failed to parse cancel all request: %v", err)
+			return
+		}
+
+		cancelledIDs := e.CancelAllOrders(cancelAllReq)
+
+		e.reply("ORDERS_CANCELLED", message.ClientId, messages.CancelAllOrdersResponse{
+			Success:  true,
+			Message:  fmt.Sprintf("%d orders cancelled", len(cancelledIDs)),
+			OrderIDs: cancelledIDs,
+		})
+
+	case "GET_ORDER":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var getOrderReq messages.GetOrderRequest
+
+		err := json.Unmarshal(dataBytes, &getOrderReq)
+
+		if err != nil {
+			log.Printf("Failed to parse get order request: %v", err)
+			return
+		}
+
+		response := messages.GetOrderResponse{Success: false, Message: "Order not found"}
+		if orderID, err := uuid.Parse(getOrderReq.OrderID); err == nil {
+			if order, found := e.GetOrder(orderID, getOrderReq.UserID); found {
+				response = messages.GetOrderResponse{Success: true, Message: "Order found", Order: order}
+			}
+		}
+
+		e.reply("ORDER", message.ClientId, response)
+
+	case "CREATE_ORDER_GROUP":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var groupReq messages.OrderGroupRequest
+
+		err := json.Unmarshal(dataBytes, &groupReq)
+
+		if err != nil {
+			log.Printf("Failed to parse order group request: %v", err)
+			return
+		}
+
+		response := e.CreateOrderGroup(groupReq)
+
+		e.reply("ORDER_GROUP", message.ClientId, response)
+
+	case "SET_SELF_TRADE_PREVENTION":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var stpReq messages.SelfTradePreventionRequest
+
+		err := json.Unmarshal(dataBytes, &stpReq)
+
+		if err != nil {
+			log.Printf("Failed to parse self-trade prevention request: %v", err)
+			return
+		}
+
+		response := e.SetSelfTradePrevention(stpReq)
+
+		e.reply("SELF_TRADE_PREVENTION", message.ClientId, response)
+
+	case "SET_FEE_TIER":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		var tierReq messages.FeeTierRequest
+
+		err := json.Unmarshal(dataBytes, &tierReq)
+
+		if err != nil {
+			log.Printf("Failed to parse fee tier request: %v", err)
+			return
+		}
+
+		response := e.SetFeeTier(tierReq)
+
+		e.reply("FEE_TIER", message.ClientId, response)
+
+	case "TICK":
+		e.Tick(e.Clock.Now())
+
+	case "SEED_MARKETS":
+		// Seed markets with demo orders for frontend demo
+		if err := e.SeedMarketsWithOrders(); err != nil {
+			log.Printf("Warning: Failed to seed some markets: %v", err)
+		}
+
+	case "RESTORE_ORDERS":
+		dataBytes, _ := json.Marshal(message.Data)
+
+		// Journals from before order groups were restored hold just the orders
+		var restore RestoredOrders
+		if err := json.Unmarshal(dataBytes, &restore); err != nil {
+			if err := json.Unmarshal(dataBytes, &restore.Orders); err != nil {
+				log.Printf("Failed to parse restored orders: %v", err)
+				return
+			}
+		}
+
+		e.RestoreOrders(restore)
+
 	case "TRADE_EVENT":
 		
 	}
@@ -388,105 +676,580 @@ func (e *Engine) Consume(message *messages.MessageFromAPI) {
 }
 
 func (e *Engine) CreateOrder(orderRequest messages.OrderRequest) (order *models.Order, err error) {
+	order = e.newOrder(orderRequest)
+
+	// Orders for a market that isn't listed or isn't trading never get a book
+	if reason := e.marketUnavailable(orderRequest.MarketID); reason != "" {
+		return e.rejectOrder(order, reason), nil
+	}
+	if reason := e.admitOrder(order); reason != "" {
+		return e.rejectOrder(order, reason), nil
+	}
+
 	orderbook, err := e.FindOrCreateOrderbook(orderRequest.MarketID)
 
 	if err != nil {
 		return nil, err
 	}
-	orderID := uuid.New()
-	order = &models.Order{
-		ID:                orderID,
-		UserID:            orderRequest.UserID,
-		MarketID:          orderRequest.MarketID,
-		Side:              orderRequest.Side,
-		Type:              orderRequest.Type,
-		Quantity:          orderRequest.Quantity,
-		Price:             orderRequest.Price,
-		FilledQuantity:    decimal.Zero,
-		RemainingQuantity: orderRequest.Quantity,
-		Status:            models.PENDING,
-		CreatedAt:         time.Now(),
-		UpdatedAt:         time.Now(),
+
+	return e.submitOrder(orderbook, order), nil
+}
+
+// newOrder builds a fresh PENDING order from a request, filling in the default
+// time in force for its type and the account's self-trade prevention mode
+func (e *Engine) newOrder(orderRequest messages.OrderRequest) *models.Order {
+	timeInForce := orderRequest.TimeInForce
+	if timeInForce == "" {
+		timeInForce = models.GTC
+		if orderRequest.Type == models.MARKET {
+			timeInForce = models.IOC
+		}
+	}
+
+	selfTradePrevention := orderRequest.SelfTradePrevention
+	if selfTradePrevention == "" {
+		selfTradePrevention = e.accountSelfTradePrevention(orderRequest.UserID)
+	}
+
+	order := &models.Order{
+		ID:                  e.Clock.NewID(),
+		UserID:              orderRequest.UserID,
+		MarketID:            orderRequest.MarketID,
+		Side:                orderRequest.Side,
+		Type:                orderRequest.Type,
+		PostOnly:            orderRequest.PostOnly,
+		SelfTradePrevention: selfTradePrevention,
+		TimeInForce:         timeInForce,
+		Quantity:            orderRequest.Quantity,
+		Price:               orderRequest.Price,
+		ProtectionPrice:     orderRequest.ProtectionPrice,
+		StopPrice:           orderRequest.StopPrice,
+		TrailingOffset:      orderRequest.TrailingOffset,
+		TrailingPercent:     orderRequest.TrailingPercent,
+		TrailingReference:   orderRequest.TrailingReference,
+		DisplayQuantity:     orderRequest.DisplayQuantity,
+		FilledQuantity:      decimal.Zero,
+		RemainingQuantity:   orderRequest.Quantity,
+		Status:              models.PENDING,
+		CreatedAt:           e.Clock.Now(),
+		UpdatedAt:           e.Clock.Now(),
+	}
+
+	if timeInForce == models.GTD {
+		order.ExpiresAt = orderRequest.ExpiresAt
+	}
+
+	return order
+}
+
+// SetSelfTradePrevention changes the mode used for a user's orders that don't set one
+func (e *Engine) SetSelfTradePrevention(req messages.SelfTradePreventionRequest) messages.SelfTradePreventionResponse {
+	switch req.Mode {
+	case models.STP_CANCEL_NEWEST, models.STP_CANCEL_OLDEST, models.STP_CANCEL_BOTH, models.STP_DECREMENT_AND_CANCEL:
+	default:
+		return messages.SelfTradePreventionResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown self-trade prevention mode %q", req.Mode),
+			Mode:    e.accountSelfTradePrevention(req.UserID),
+		}
+	}
+
+	e.SelfTradePrevention[req.UserID] = req.Mode
+	log.Printf("🪞 Self-trade prevention for user %s set to %s", req.UserID.String(), req.Mode)
+
+	return messages.SelfTradePreventionResponse{
+		Success: true,
+		Message: "Self-trade prevention updated",
+		Mode:    req.Mode,
 	}
+}
+
+// accountSelfTradePrevention is the user's chosen mode, cancel-newest if they never chose one
+func (e *Engine) accountSelfTradePrevention(userID uuid.UUID) models.SelfTradePrevention {
+	if mode, exists := e.SelfTradePrevention[userID]; exists {
+		return mode
+	}
+	return models.STP_CANCEL_NEWEST
+}
+
+// submitOrder validates a new order and routes it to the trigger book or the orderbook
+func (e *Engine) submitOrder(orderbook *orderbook.OrderBook, order *models.Order) *models.Order {
+	if order.TimeInForce == models.GTD && (order.ExpiresAt == nil || !order.ExpiresAt.After(order.CreatedAt)) {
+		return e.rejectOrder(order, "INVALID_EXPIRY")
+	}
+
+	if order.DisplayQuantity != nil && !validDisplayQuantity(order) {
+		return e.rejectOrder(order, "INVALID_DISPLAY_QUANTITY")
+	}
+
+	if reason := e.checkTradingRules(orderbook, order); reason != "" {
+		return e.rejectOrder(order, reason)
+	}
+
+	log.Printf("📋 Processing order: %s for market %s", order.ID.String(), order.MarketID)
+
+	// Drop GTD orders that expired since the last tick so they can't be matched
+	e.expireOrders(orderbook, order.CreatedAt)
+
+	// Stop orders wait in the trigger book until the market trades through their stop price
+	if order.Type.IsStop() {
+		return e.placeStopOrder(orderbook, order)
+	}
+
+	if e.checkPriceBand(orderbook, order) {
+		return e.rejectOrder(order, reasonPriceBandExceeded)
+	}
+
+	if !e.lockFunds(orderbook, order) {
+		return e.rejectOrder(order, reasonInsufficientFunds)
+	}
+	result := e.executeOrder(orderbook, order, "ORDER_PLACED")
+
+	if len(result.GeneratedTrades) > 0 {
+		e.fireTriggeredOrders(orderbook, result.GeneratedTrades)
+	}
+
+	return result.IncomingOrder
+}
 
-	log.Printf("📋 Processing order: %s for market %s", order.ID.String(), orderRequest.MarketID)
+// validDisplayQuantity checks an iceberg's slice: only resting limit orders can hide
+// size, and the slice must be smaller than the order
+func validDisplayQuantity(order *models.Order) bool {
+	if order.Type != models.LIMIT && order.Type != models.STOP_LIMIT {
+		return false
+	}
+	return order.DisplayQuantity.GreaterThan(decimal.Zero) && order.DisplayQuantity.LessThan(order.Quantity)
+}
 
+// executeOrder runs an order through the orderbook and emits everything that happened.
+// placedEvent is the event used for the incoming order itself: ORDER_PLACED for new
+// orders, ORDER_UPDATED for stop orders that were already persisted before triggering.
+func (e *Engine) executeOrder(ob *orderbook.OrderBook, order *models.Order, placedEvent string) *orderbook.MatchingResult {
 	// 🎯 Process order and get EVERYTHING that happened
-	result := orderbook.AddOrder(order)
+	result := ob.AddOrder(order)
+
+	return e.emitMatchingResult(order.MarketID, result, placedEvent)
+}
+
+// emitMatchingResult publishes the order, trade, ticker and depth events for one
+// pass through the orderbook
+func (e *Engine) emitMatchingResult(market string, result *orderbook.MatchingResult, placedEvent string) *orderbook.MatchingResult {
+	if result.Repriced {
+		log.Printf("↩️ Post-only order %s repriced to %s", result.IncomingOrder.ID.String(), result.IncomingOrder.Price.String())
+	}
+
+	// Funds move before the orders are emitted, which releases what closed orders still lock
+	settlements := e.settleTrades(result)
 
 	// 🎯 Now I KNOW exactly what to emit:
 
 	// 1. Emit the incoming order (placed)
-	e.EmitOrderEvent("ORDER_PLACED", orderRequest.MarketID, result.IncomingOrder)
+	e.EmitOrderEvent(placedEvent, market, result.IncomingOrder)
 
 	// 2. Emit all existing orders that were updated
 	for _, updatedOrder := range result.UpdatedOrders {
 		log.Printf("📈 Order %s was updated: %s", updatedOrder.ID.String(), updatedOrder.Status)
-		e.EmitOrderEvent("ORDER_UPDATED", orderRequest.MarketID, updatedOrder)
+		e.EmitOrderEvent("ORDER_UPDATED", market, updatedOrder)
 	}
 
 	// 3. Emit all trades that happened
-	for _, trade := range result.GeneratedTrades {
+	for i, trade := range result.GeneratedTrades {
 		log.Printf("💱 Trade executed: %s at price %s", trade.ID.String(), trade.Price.String())
-		e.EmitTradeEvent("TRADE_EXECUTED", orderRequest.MarketID, trade)
+		e.EmitTradeEvent("TRADE_EXECUTED", market, trade, settlements[i])
+		e.recordTradePrice(market, trade.Price)
 		
 		// 🎯 NEW: Emit ticker update after each trade
-		e.EmitTickerUpdate(orderRequest.MarketID, &trade)
+		e.EmitTickerUpdate(market, &trade)
+	}
+
+	// 4. Emit final status of incoming order if it changed (updates already carry it)
+	if placedEvent != "ORDER_UPDATED" && result.IncomingOrder.Status != models.PENDING {
+		log.Printf("📊 Order %s final status: %s (stopped: %s)", result.IncomingOrder.ID.String(), result.IncomingOrder.Status, result.StopReason)
+		e.EmitOrderEvent("ORDER_UPDATED", market, result.IncomingOrder)
 	}
 
-	// 4. Emit final status of incoming order if it changed
-	if result.IncomingOrder.Status != models.PENDING {
-		log.Printf("📊 Order %s final status: %s", result.IncomingOrder.ID.String(), result.IncomingOrder.Status)
-		e.EmitOrderEvent("ORDER_UPDATED", orderRequest.MarketID, result.IncomingOrder)
+	// Fills and cancellations can complete OCO / bracket groups
+	e.syncOrderGroup(result.IncomingOrder)
+	for _, updatedOrder := range result.UpdatedOrders {
+		e.syncOrderGroup(updatedOrder)
 	}
 
 	// 5. Emit orderbook update for real-time WebSocket
-	e.EmitOrderbookUpdate(orderRequest.MarketID)
+	e.EmitOrderbookUpdate(market)
 
 	// 🎯 NEW: Always emit ticker update (for bid/ask changes even without trades)
 	if len(result.GeneratedTrades) == 0 {
 		// No trades, but orderbook changed - update ticker with current bid/ask
-		e.EmitTickerUpdate(orderRequest.MarketID, nil)
+		e.EmitTickerUpdate(market, nil)
 	}
 
 	log.Printf("✅ Order processing complete: %d trades, %d orders updated", 
 		len(result.GeneratedTrades), len(result.UpdatedOrders))
 
-	return result.IncomingOrder, nil
+	return result
+}
+
+// placeStopOrder parks a stop order in its market's trigger book
+func (e *Engine) placeStopOrder(ob *orderbook.OrderBook, order *models.Order) *models.Order {
+	if order.Type == models.TRAILING_STOP {
+		if !validTrailingDistance(order) {
+			return e.rejectOrder(order, "INVALID_TRAILING_DISTANCE")
+		}
+		if !validTrailingReference(order) {
+			return e.rejectOrder(order, "INVALID_TRAILING_REFERENCE")
+		}
+
+		reference := trailingReference(ob, order)
+		if reference == nil {
+			return e.rejectOrder(order, "NO_REFERENCE_PRICE")
+		}
+
+		stopPrice := trailingStopPrice(order, *reference)
+		order.StopPrice = &stopPrice
+	}
+
+	if order.StopPrice == nil || order.StopPrice.LessThanOrEqual(decimal.Zero) {
+		return e.rejectOrder(order, "INVALID_STOP_PRICE")
+	}
+
+	// A stop the last trade has already gone through would fire on the next unrelated trade
+	if isTriggered(order, ob.CurrentPrice) {
+		return e.rejectOrder(order, "STOP_ALREADY_TRIGGERED")
+	}
+
+	if !e.lockFunds(ob, order) {
+		return e.rejectOrder(order, reasonInsufficientFunds)
+	}
+	e.triggerBook(order.MarketID).Add(order)
+
+	log.Printf("🎯 Stop order %s waiting for %s to trade at %s", order.ID.String(), order.MarketID, order.StopPrice.String())
+	e.EmitOrderEvent("ORDER_PLACED", order.MarketID, order)
+
+	return order
+}
+
+// fireTriggeredOrders walks the trade prices of an execution through the trigger
+// book: trailing stops ratchet on every price and any stop that price reaches is
+// released into normal matching. Trades from a triggered order can move trailing
+// stops and trigger further stops, so this keeps going until the trigger book is quiet.
+func (e *Engine) fireTriggeredOrders(ob *orderbook.OrderBook, trades []models.Trade) {
+	triggerBook := e.triggerBook(ob.GetTicker())
+
+	for len(trades) > 0 {
+		triggered := []*models.Order{}
+		for _, trade := range trades {
+			triggerBook.Trail(trade.Price)
+			for _, order := range triggerBook.Triggered(trade.Price) {
+				log.Printf("🚨 Stop order %s triggered at %s (stop %s)", order.ID.String(), trade.Price.String(), order.StopPrice.String())
+				triggered = append(triggered, order)
+			}
+		}
+
+		trades = nil
+		for _, order := range triggered {
+			// Stops released after a halt wait for trading to resume
+			if e.marketStatus(ob.GetTicker()) != models.MARKET_OPEN {
+				triggerBook.Add(order)
+				continue
+			}
+
+			activate(order, e.Clock.Now())
+			if e.checkPriceBand(ob, order) {
+				e.rejectTriggeredOrder(order, reasonPriceBandExceeded)
+				continue
+			}
+			if !e.affordTriggeredOrder(ob, order) {
+				e.rejectTriggeredOrder(order, reasonInsufficientFunds)
+				continue
+			}
+
+			result := e.executeOrder(ob, order, "ORDER_UPDATED")
+			trades = append(trades, result.GeneratedTrades...)
+		}
+	}
+}
+
+func (e *Engine) triggerBook(market string) *TriggerBook {
+	triggerBook, exists := e.TriggerBooks[market]
+	if !exists {
+		triggerBook = NewTriggerBook()
+		e.TriggerBooks[market] = triggerBook
+	}
+	return triggerBook
+}
+
+// rejectOrder marks an order the engine refused before it reached the orderbook.
+// It is still persisted so the user can see why it was rejected.
+func (e *Engine) rejectOrder(order *models.Order, reason string) *models.Order {
+	order.Status = models.REJECTED
+	order.StatusReason = reason
+
+	log.Printf("⛔ Order %s rejected: %s", order.ID.String(), reason)
+	e.EmitOrderEvent("ORDER_PLACED", order.MarketID, order)
+	e.syncOrderGroup(order)
+
+	return order
 }
 
-func (e *Engine) CancelOrder(req messages.CancelOrderRequest) (*models.Order, bool) {
-	// Search through all orderbooks to find and cancel the order
-	for _, orderbook := range e.Orderbooks {
-		// Try to remove the order from this orderbook
-		cancelledOrder, found := orderbook.RemoveOrder(req.OrderID, req.UserID)
+// rejectTriggeredOrder refuses a stop order that was released by its trigger.
+// The order was persisted when it was placed, so this is an update.
+func (e *Engine) rejectTriggeredOrder(order *models.Order, reason string) {
+	order.Status = models.REJECTED
+	order.StatusReason = reason
+
+	log.Printf("⛔ Triggered order %s rejected: %s", order.ID.String(), reason)
+	e.EmitOrderEvent("ORDER_UPDATED", order.MarketID, order)
+	e.syncOrderGroup(order)
+}
+
+// Tick runs time-based housekeeping. It arrives through the request queue like any
+// other message, so it never races with order processing.
+func (e *Engine) Tick(now time.Time) {
+	for _, ob := range e.Orderbooks {
+		e.expireOrders(ob, now)
+	}
+	e.resumeHaltedMarkets(now)
+	e.endAuctions(now)
+}
+
+// tickDue reports whether a tick would change anything now
+func (e *Engine) tickDue(now time.Time) bool {
+	return e.expiryDue(now) || e.resumeDue(now) || e.auctionDue(now)
+}
+
+// expiryDue reports whether any GTD order has reached its expiry
+func (e *Engine) expiryDue(now time.Time) bool {
+	for _, ob := range e.Orderbooks {
+		if ob.ExpiryDue(now) || e.triggerBook(ob.GetTicker()).ExpiryDue(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// expireOrders removes GTD orders past their expiry from one market's orderbook and
+// trigger book and emits their final state
+func (e *Engine) expireOrders(ob *orderbook.OrderBook, now time.Time) {
+	expired := append(ob.ExpireOrders(now), e.triggerBook(ob.GetTicker()).Expire(now)...)
+	if len(expired) == 0 {
+		return
+	}
+
+	for _, order := range expired {
+		log.Printf("⌛ Order %s expired in market %s", order.ID.String(), ob.GetTicker())
+		e.EmitOrderEvent("ORDER_UPDATED", ob.GetTicker(), order)
+		e.syncOrderGroup(order)
+	}
+
+	e.EmitOrderbookUpdate(ob.GetTicker())
+}
+
+// CancelOrder cancels one open order. Halted markets refuse cancels with a
+// RejectionError; an order that can't be found gives ErrOrderNotFound.
+func (e *Engine) CancelOrder(req messages.CancelOrderRequest) (*models.Order, error) {
+	orderID, err := uuid.Parse(req.OrderID)
+	if err != nil {
+		return nil, orderbook.ErrOrderNotFound
+	}
+
+	// The order index knows which market the order lives in
+	if entry, found := e.lookupOrder(orderID, req.UserID); found {
+		market := entry.orderbook.GetTicker()
+		if e.marketStatus(market) == models.MARKET_HALTED {
+			log.Printf("❌ Order %s could not be cancelled: market %s is halted", req.OrderID, market)
+			return nil, &RejectionError{Reason: reasonMarketHalted}
+		}
+
+		cancelledOrder, found := e.removeOpenOrder(entry.orderbook, orderID, req.UserID, "")
 		if found {
 			log.Printf("✅ Order %s cancelled successfully for user %s in market %s", 
-				req.OrderID, req.UserID.String(), orderbook.GetTicker())
-			return cancelledOrder, true
+				req.OrderID, req.UserID.String(), market)
+			return cancelledOrder, nil
 		}
 	}
 
 	// Order not found in any orderbook
 	log.Printf("❌ Order %s not found for user %s in any market", 
 		req.OrderID, req.UserID.String())
-	return nil, false
+	return nil, orderbook.ErrOrderNotFound
 }
 
-func (e *Engine) GetDepth(Market string) *messages.DepthResponse {
+// ModifyOrder amends a resting order's price and/or quantity without taking it out
+// of the book in between, so there is never a moment without the quote. Stop
+// orders still waiting for their trigger are refused with ErrStopNotTriggered, and
+// bracket legs still held back by their group with ErrLegHeld.
+func (e *Engine) ModifyOrder(req messages.ModifyOrderRequest) (*models.Order, error) {
+	orderID, err := uuid.Parse(req.OrderID)
+	if err != nil {
+		return nil, orderbook.ErrOrderNotFound
+	}
+
+	entry, found := e.lookupOrder(orderID, req.UserID)
+	if !found {
+		log.Printf("❌ Order %s not found for user %s in any market", req.OrderID, req.UserID.String())
+		return nil, orderbook.ErrOrderNotFound
+	}
+	ob := entry.orderbook
+
+	// An order past its GTD expiry must not be brought back to life by an amend
+	e.expireOrders(ob, e.Clock.Now())
+
+	if reason := e.marketUnavailable(ob.GetTicker()); reason != "" {
+		log.Printf("❌ Order %s could not be modified: %s", req.OrderID, reason)
+		return nil, &RejectionError{Reason: reason}
+	}
+
+	if entry.order.Type.IsStop() {
+		log.Printf("❌ Order %s could not be modified: it has not triggered yet", req.OrderID)
+		return nil, ErrStopNotTriggered
+	}
+	if _, held := e.heldLeg(entry.order); held {
+		log.Printf("❌ Order %s could not be modified: its bracket entry has not filled yet", req.OrderID)
+		return nil, ErrLegHeld
+	}
 
-	orderbook, err := e.FindOrCreateOrderbook(Market)
+	amended := amendOrder(entry.order, req)
+	if reason := e.checkTradingRules(ob, &amended); reason != "" {
+		log.Printf("❌ Order %s could not be modified: %s", req.OrderID, reason)
+		return nil, &RejectionError{Reason: reason}
+	}
+	if reason := e.admitAmend(ob, &amended); reason != "" {
+		log.Printf("❌ Order %s could not be modified: %s", req.OrderID, reason)
+		return nil, &RejectionError{Reason: reason}
+	}
+	if e.checkPriceBand(ob, &amended) {
+		log.Printf("❌ Order %s could not be modified: %s", req.OrderID, reasonPriceBandExceeded)
+		return nil, &RejectionError{Reason: reasonPriceBandExceeded}
+	}
 
+	// The lock changes first so trades the amend makes are paid from the new one
+	lockKey, lock, more := e.amendFunds(ob, entry.order, &amended)
+	if lock != nil && !more.IsZero() {
+		e.changeLock(lockKey, lock, more)
+	}
+
+	result, err := ob.ModifyOrder(orderID, req.UserID, req.Price, req.Quantity)
 	if err != nil {
-		log.Printf("Error occured while finding orderbook")
+		if lock != nil && !more.IsZero() {
+			e.changeLock(lockKey, lock, more.Neg())
+		}
+		log.Printf("❌ Order %s could not be modified: %v", req.OrderID, err)
+		return nil, err
+	}
+
+	log.Printf("✏️ Order %s modified in market %s", req.OrderID, ob.GetTicker())
+	e.emitMatchingResult(ob.GetTicker(), result, "ORDER_UPDATED")
+
+	if len(result.GeneratedTrades) > 0 {
+		e.fireTriggeredOrders(ob, result.GeneratedTrades)
+	}
+
+	return result.IncomingOrder, nil
+}
+
+// amendOrder returns a copy of an order with an amend's new price and quantity
+func amendOrder(order *models.Order, req messages.ModifyOrderRequest) models.Order {
+	amended := *order
+	if req.Price != nil {
+		amended.Price = req.Price
+	}
+	if req.Quantity != nil {
+		amended.Quantity = *req.Quantity
+		amended.RemainingQuantity = amended.Quantity.Sub(amended.FilledQuantity)
+	}
+	return amended
+}
+
+// CancelAllOrders cancels every open order of a user, optionally only in one market
+// and/or on one side, including untriggered stops. Bracket legs still waiting for
+// their entry go with the entry. Returns the IDs of the cancelled orders.
+func (e *Engine) CancelAllOrders(req messages.CancelAllOrdersRequest) []string {
+	market := strings.Replace(req.Market, "_", "/", 1)
+	cancelled := []string{}
+
+	for _, ob := range e.Orderbooks {
+		if market != "" && ob.GetTicker() != market {
+			continue
+		}
+		// Nothing leaves a halted book, not even in bulk
+		if e.marketStatus(ob.GetTicker()) == models.MARKET_HALTED {
+			continue
+		}
+
+		// Cancelling a partly filled bracket entry releases its legs into the
+		// book, so keep sweeping until nothing matching is left
+		for {
+			open := ob.GetOpenOrders(req.UserID)
+			open = append(open, e.triggerBook(ob.GetTicker()).GetOpenOrders(req.UserID)...)
+
+			removed := 0
+			for _, order := range open {
+				if req.Side != "" && order.Side != req.Side {
+					continue
+				}
+				if _, found := e.removeOpenOrder(ob, order.ID, req.UserID, ""); found {
+					cancelled = append(cancelled, order.ID.String())
+					removed++
+				}
+			}
+
+			if removed == 0 {
+				break
+			}
+		}
+	}
+
+	log.Printf("🧹 Cancelled %d orders for user %s", len(cancelled), req.UserID.String())
+	return cancelled
+}
+
+// removeOpenOrder cancels a resting order, untriggered stop or held bracket leg in
+// one market, emits its final state and lets any order group it belongs to react
+func (e *Engine) removeOpenOrder(ob *orderbook.OrderBook, orderID uuid.UUID, userID uuid.UUID, reason string) (*models.Order, bool) {
+	market := ob.GetTicker()
+
+	cancelledOrder, found := ob.RemoveOrder(orderID.String(), userID)
+	if !found {
+		// Stop orders that have not triggered yet live in the trigger book, and
+		// bracket legs waiting for their entry with their group
+		cancelledOrder, found = e.triggerBook(market).Remove(orderID, userID)
+		if !found {
+			cancelledOrder, found = e.removeHeldLeg(orderID, userID)
+		}
+		if !found {
+			return nil, false
+		}
+		cancelledOrder.Status = models.CANCELLED
+		cancelledOrder.UpdatedAt = e.Clock.Now()
+	}
+
+	cancelledOrder.StatusReason = reason
+
+	e.EmitOrderEvent("ORDER_UPDATED", market, cancelledOrder)
+	e.EmitOrderbookUpdate(market)
+	e.syncOrderGroup(cancelledOrder)
+
+	return cancelledOrder, true
+}
+
+// GetDepth returns the top levels of a market's book. Markets the engine has no
+// book for give ErrUnknownMarket.
+func (e *Engine) GetDepth(Market string) (*messages.DepthResponse, error) {
+
+	orderbook, err := e.FindOrderbook(Market)
+
+	if err != nil {
+		return nil, err
 	}
 
 	depth := orderbook.GetDepthResponse(50) // Increased from 10 to 50 levels
 
-	return depth
+	return depth, nil
 }
 
-func (e *Engine) GetOpenOrders(userID uuid.UUID, market string) []models.Order {
+// GetOpenOrders returns a user's open orders in one market, or in all of them
+// when market is empty. Markets the engine has no book for give ErrUnknownMarket.
+func (e *Engine) GetOpenOrders(userID uuid.UUID, market string) ([]models.Order, error) {
 
 	var openOrders []models.Order
 
@@ -496,34 +1259,58 @@ func (e *Engine) GetOpenOrders(userID uuid.UUID, market string) []models.Order {
 
 	// If market is specified, only get orders for that market
 	if market != "" {
-		orderbook, err := e.FindOrCreateOrderbook(market)
+		orderbook, err := e.FindOrderbook(market)
 		if err != nil {
-			log.Printf("Error finding orderbook for market %s: %v", market, err)
-			return openOrders
+			return []models.Order{}, err
 		}
 		orders := orderbook.GetOpenOrders(userID)
-		return orders
+		orders = append(orders, e.triggerBook(market).GetOpenOrders(userID)...)
+		orders = append(orders, e.heldGroupOrders(userID, market)...)
+		return orders, nil
 	}
 
 	// If no market specified, get orders from all markets
 	for _, ob := range e.Orderbooks {
 		orders := ob.GetOpenOrders(userID)
 		openOrders = append(openOrders, orders...)
+		openOrders = append(openOrders, e.triggerBook(ob.GetTicker()).GetOpenOrders(userID)...)
 	}
+	openOrders = append(openOrders, e.heldGroupOrders(userID, "")...)
 
-	return openOrders
+	return openOrders, nil
 }
 
-func (e *Engine) FindOrCreateOrderbook(marketID string) (orderBook *orderbook.OrderBook, err error) {
+// FindOrderbook returns the book of a market without creating one, so reads for
+// a market that isn't configured give ErrUnknownMarket instead of an empty book
+func (e *Engine) FindOrderbook(marketID string) (*orderbook.OrderBook, error) {
 	for i := range e.Orderbooks {
 		if e.Orderbooks[i].GetTicker() == marketID {
 			return e.Orderbooks[i], nil
 		}
 	}
+	return nil, ErrUnknownMarket
+}
+
+func (e *Engine) FindOrCreateOrderbook(marketID string) (orderBook *orderbook.OrderBook, err error) {
+	if ob, err := e.FindOrderbook(marketID); err == nil {
+		return ob, nil
+	}
 
 	baseAsset, QuoteAsset, _ := utils.ParseMarketId(marketID)
 
 	orderbook := orderbook.NewOrderBook(baseAsset, QuoteAsset)
+	orderbook.Clock = e.Clock
+	orderbook.Fees = marketFees{engine: e, market: marketID}
+
+	// Post-only orders are repriced by one tick of the market
+	if rules := e.marketRules(marketID); rules.TickSize.IsPositive() {
+		orderbook.TickSize = rules.TickSize
+	}
+
+	// A market can start out in a call auction, e.g. while waiting for its opening
+	if e.marketStatus(marketID) == models.MARKET_AUCTION {
+		orderbook.StartAuction()
+	}
 
 	e.Orderbooks = append(e.Orderbooks, orderbook)
 
@@ -548,8 +1335,8 @@ func (e *Engine) LogOrderbooks() *OrderbooksResponse {
 	for i, ob := range e.Orderbooks {
 		orderbooks[i] = OrderbookInfo{
 			Ticker:   ob.GetTicker(),
-			BidCount: len(ob.Bids),
-			AskCount: len(ob.Asks),
+			BidCount: ob.Bids.Len(),
+			AskCount: ob.Asks.Len(),
 		}
 	}
 
@@ -563,7 +1350,8 @@ func (e *Engine) LogOrderbooks() *OrderbooksResponse {
 
 func (e *Engine) EmitOrderEvent(eventType, market string, order *models.Order) {
 	// 🗄️ DB Event - Simple channel names for database processor
-	dbChannel := fmt.Sprintf("db@%s", strings.ToLower(strings.Replace(eventType, "ORDER_", "", 1)))
+	// ORDER_PLACED -> db@orderplaced, ORDER_UPDATED -> db@orderupdated
+	dbChannel := fmt.Sprintf("db@%s", strings.ToLower(strings.Replace(eventType, "_", "", 1)))
 	
 	dbEventData := map[string]interface{}{
 		"order":     order, // Full model for database persistence
@@ -571,6 +1359,10 @@ func (e *Engine) EmitOrderEvent(eventType, market string, order *models.Order) {
 		"timestamp": time.Now().Unix(),
 	}
 	e.publishEvent(dbChannel, dbEventData)
+
+	// Every order state change passes through here, which keeps the order index and locks in step
+	e.updateOrderIndex(order)
+	e.releaseFunds(order)
 	
 	// 📡 WebSocket Event - Only for updates (not placement, handled by HTTP)
 	if eventType != "ORDER_PLACED" {
@@ -590,6 +1382,14 @@ func (e *Engine) EmitOrderEvent(eventType, market string, order *models.Order) {
 		if order.Price != nil {
 			lightOrder["price"] = order.Price.String()
 		}
+
+		if order.StopPrice != nil {
+			lightOrder["stop_price"] = order.StopPrice.String()
+		}
+
+		if order.StatusReason != "" {
+			lightOrder["reason"] = order.StatusReason
+		}
 		
 		wsEventData := map[string]interface{}{
 			"order":     lightOrder,
@@ -600,14 +1400,21 @@ func (e *Engine) EmitOrderEvent(eventType, market string, order *models.Order) {
 	}
 }
 
-func (e *Engine) EmitTradeEvent(eventType, market string, trade models.Trade) {
-	// 🗄️ DB Event - Single channel for all trade events
+func (e *Engine) EmitGroupEvent(eventType string, group *models.OrderGroup) {
+	// GROUP_PLACED -> db@groupplaced, GROUP_UPDATED -> db@groupupdated
+	dbChannel := fmt.Sprintf("db@%s", strings.ToLower(strings.Replace(eventType, "_", "", 1)))
+
 	dbEventData := map[string]interface{}{
-		"trade":     trade, // Full model for database
-		"market":    market,
+		"group":     group,
+		"market":    group.MarketID,
 		"timestamp": time.Now().Unix(),
 	}
-	e.publishEvent("db@trade", dbEventData)
+	e.publishEvent(dbChannel, dbEventData)
+}
+
+func (e *Engine) EmitTradeEvent(eventType, market string, trade models.Trade, settlement messages.TradeSettlement) {
+	// 🗄️ DB Event - The trade is stored and settled in order with the locks before it
+	e.queueFundsEvent(messages.FundsEvent{Trade: &trade, Settlement: &settlement})
 	
 	// 📡 WebSocket Event - Market specific lightweight trade
 	wsChannel := fmt.Sprintf("trade@%s", strings.Replace(market, "/", "_", 1))
@@ -618,6 +1425,8 @@ func (e *Engine) EmitTradeEvent(eventType, market string, trade models.Trade) {
 		"quantity":      trade.Quantity.String(),
 		"quote_quantity": trade.QuoteQuantity.String(),
 		"is_buyer_maker": trade.IsBuyerMaker,
+		"buyer_fee":     trade.BuyerFee.String(),
+		"seller_fee":    trade.SellerFee.String(),
 		"timestamp":     trade.CreatedAt.Unix(),
 	}
 	
@@ -629,8 +1438,17 @@ func (e *Engine) EmitTradeEvent(eventType, market string, trade models.Trade) {
 	e.publishEvent(wsChannel, wsEventData)
 }
 
+// EmitBalanceChange persists funds an order locked or released
+func (e *Engine) EmitBalanceChange(change messages.BalanceChange) {
+	e.queueFundsEvent(messages.FundsEvent{Balance: &change})
+}
+
 func (e *Engine) EmitOrderbookUpdate(market string) {
-	depth := e.GetDepth(market)
+	ob, err := e.FindOrderbook(market)
+	if err != nil {
+		return
+	}
+	depth := ob.GetDepthResponse(50)
 	
 	// 📡 WebSocket Event - Market specific orderbook updates
 	wsChannel := fmt.Sprintf("depth@%s", strings.Replace(market, "/", "_", 1))
@@ -642,9 +1460,79 @@ func (e *Engine) EmitOrderbookUpdate(market string) {
 	}
 	
 	e.publishEvent(wsChannel, wsEventData)
+
+	// Trailing stops that follow the best bid or ask move with every change to the top of the book
+	e.triggerBook(market).TrailBest(ob.BestBid(), ob.BestAsk())
+
+	// While orders are collected for an auction, every change moves its indicative price
+	if ob.Auction && !e.replaying {
+		e.EmitAuctionUpdate(market, ob.IndicativeAuction(), false)
+	}
+}
+
+// EmitMarketStatus announces a change of a market's trading state, to the database
+// and on the market's status channel
+func (e *Engine) EmitMarketStatus(market string, previous, status models.MarketStatus, reason string) {
+	eventData := map[string]interface{}{
+		"market":          market,
+		"status":          status,
+		"previous_status": previous,
+		"reason":          reason,
+		"timestamp":       e.Clock.Now().Unix(),
+	}
+
+	e.publishEvent("db@marketstatus", eventData)
+	e.publishEvent(fmt.Sprintf("status@%s", strings.Replace(market, "/", "_", 1)), eventData)
+}
+
+// EmitCircuitBreakerAlert warns that an order would have moved a market's price
+// outside its band and the market is halted until haltedUntil
+func (e *Engine) EmitCircuitBreakerAlert(market string, order *models.Order, price, low, high decimal.Decimal, haltedUntil time.Time) {
+	alert := map[string]interface{}{
+		"type":         "CIRCUIT_BREAKER",
+		"market":       market,
+		"order_id":     order.ID.String(),
+		"price":        price.String(),
+		"band_low":     low.String(),
+		"band_high":    high.String(),
+		"halted_until": haltedUntil.Unix(),
+		"timestamp":    e.Clock.Now().Unix(),
+	}
+
+	e.publishEvent(fmt.Sprintf("alert@%s", strings.Replace(market, "/", "_", 1)), alert)
+}
+
+// EmitAuctionUpdate publishes a call auction's indicative price and volume, or
+// with uncrossed set the price and volume it ended with
+func (e *Engine) EmitAuctionUpdate(market string, state orderbook.AuctionState, uncrossed bool) {
+	auction := map[string]interface{}{
+		"indicative_price": nil,
+		"matched_volume":   state.Volume.String(),
+		"surplus":          state.Surplus.String(),
+		"surplus_side":     state.SurplusSide,
+		"uncrossed":        uncrossed,
+	}
+	if state.Price != nil {
+		auction["indicative_price"] = state.Price.String()
+	}
+	if m := e.GetMarketByTicker(market); m != nil && m.AuctionEndsAt != nil {
+		auction["ends_at"] = m.AuctionEndsAt.Unix()
+	}
+
+	wsEventData := map[string]interface{}{
+		"auction":   auction,
+		"market":    market,
+		"timestamp": e.Clock.Now().Unix(),
+	}
+	e.publishEvent(fmt.Sprintf("auction@%s", strings.Replace(market, "/", "_", 1)), wsEventData)
 }
 
 func (e *Engine) publishEvent(channel string, data interface{}) {
+	// Replayed commands already published their events the first time round
+	if e.replaying {
+		return
+	}
+
 	eventBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("❌ Failed to marshal event data: %v", err)
@@ -700,15 +1588,8 @@ func (e *Engine) EmitTickerUpdate(market string, lastTrade *models.Trade) {
 
 func (e *Engine) calculateTickerStats(market string, lastTrade *models.Trade) map[string]interface{} {
 	// Find the orderbook for this market
-	var orderbook *orderbook.OrderBook
-	for _, ob := range e.Orderbooks {
-		if ob.GetTicker() == market {
-			orderbook = ob
-			break
-		}
-	}
-	
-	if orderbook == nil {
+	orderbook, err := e.FindOrderbook(market)
+	if err != nil {
 		log.Printf("❌ Orderbook not found for market: %s", market)
 		return make(map[string]interface{})
 	}
@@ -761,19 +1642,13 @@ func (e *Engine) getBestBidAsk(orderbook *orderbook.OrderBook) (decimal.Decimal,
 	bestAsk := decimal.Zero
 	
 	// Get best bid (highest price in bids)
-	if len(orderbook.Bids) > 0 {
-		// Bids are sorted highest first
-		if orderbook.Bids[0].Price != nil {
-			bestBid = *orderbook.Bids[0].Price
-		}
+	if price := orderbook.BestBid(); price != nil {
+		bestBid = *price
 	}
 	
 	// Get best ask (lowest price in asks)  
-	if len(orderbook.Asks) > 0 {
-		// Asks are sorted lowest first
-		if orderbook.Asks[0].Price != nil {
-			bestAsk = *orderbook.Asks[0].Price
-		}
+	if price := orderbook.BestAsk(); price != nil {
+		bestAsk = *price
 	}
 	
 	return bestBid, bestAsk
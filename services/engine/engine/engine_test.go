@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+func TestTimeInForce(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		request     func(userID uuid.UUID) messages.OrderRequest
+		timeInForce models.TimeInForce
+		status      models.OrderStatus
+		reason      string
+	}{
+		{
+			name:        "limit orders default to GTC",
+			request:     func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99", "1") },
+			timeInForce: models.GTC,
+			status:      models.PENDING,
+		},
+		{
+			name: "market orders default to IOC",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				return messages.OrderRequest{UserID: userID, MarketID: testMarket, Side: models.BUY, Type: models.MARKET, Quantity: *dec("1")}
+			},
+			timeInForce: models.IOC,
+			status:      models.CANCELLED,
+			reason:      orderbook.StopReasonBookExhausted,
+		},
+		{
+			name: "GTD with a future expiry rests",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				request := limitOrder(userID, models.BUY, "99", "1")
+				request.TimeInForce, request.ExpiresAt = models.GTD, &future
+				return request
+			},
+			timeInForce: models.GTD,
+			status:      models.PENDING,
+		},
+		{
+			name: "GTD without an expiry is rejected",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				request := limitOrder(userID, models.BUY, "99", "1")
+				request.TimeInForce = models.GTD
+				return request
+			},
+			timeInForce: models.GTD,
+			status:      models.REJECTED,
+			reason:      "INVALID_EXPIRY",
+		},
+		{
+			name: "GTD with an expiry in the past is rejected",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				request := limitOrder(userID, models.BUY, "99", "1")
+				request.TimeInForce, request.ExpiresAt = models.GTD, &past
+				return request
+			},
+			timeInForce: models.GTD,
+			status:      models.REJECTED,
+			reason:      "INVALID_EXPIRY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			order := placeOrder(t, engine, tt.request(uuid.New()))
+
+			if order.TimeInForce != tt.timeInForce {
+				t.Errorf("time in force: got %s, want %s", order.TimeInForce, tt.timeInForce)
+			}
+			if order.Status != tt.status || order.StatusReason != tt.reason {
+				t.Errorf("got %s (%s), want %s (%s)", order.Status, order.StatusReason, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestTickExpiresGTDOrders(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+
+	expiring := func(price string, expiresAt time.Time) *models.Order {
+		request := limitOrder(user, models.BUY, price, "1")
+		request.TimeInForce, request.ExpiresAt = models.GTD, &expiresAt
+		return placeOrder(t, engine, request)
+	}
+	soon := expiring("99", time.Now().Add(time.Minute))
+	later := expiring("98", time.Now().Add(time.Hour))
+	gtc := placeOrder(t, engine, limitOrder(user, models.BUY, "97", "1"))
+
+	engine.Tick(time.Now())
+	if soon.Status != models.PENDING {
+		t.Fatalf("order expired early: %s", soon.Status)
+	}
+
+	engine.Tick(time.Now().Add(2 * time.Minute))
+	if soon.Status != models.EXPIRED || later.Status != models.PENDING || gtc.Status != models.PENDING {
+		t.Errorf("got %s, %s and %s, want EXPIRED, PENDING and PENDING", soon.Status, later.Status, gtc.Status)
+	}
+	if open, _ := engine.GetOpenOrders(user, testMarket); len(open) != 2 {
+		t.Errorf("got %d open orders after the first expiry, want 2", len(open))
+	}
+}
+
+func TestTickCommand(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	for _, price := range []string{"99", "98"} {
+		request := limitOrder(user, models.BUY, price, "1")
+		request.TimeInForce, request.ExpiresAt = models.GTD, &expiresAt
+		send(engine, "CREATE_ORDER", request)
+	}
+
+	// Nothing is due yet
+	send(engine, "TICK", nil)
+	if open := len(userOrders(engine, user)); open != 2 {
+		t.Fatalf("got %d open orders before expiry, want 2", open)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	send(engine, "TICK", nil)
+	if open := len(userOrders(engine, user)); open != 0 {
+		t.Errorf("got %d open orders after expiry, want none", open)
+	}
+}
+
+func TestAccountSelfTradePrevention(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+
+	if response := engine.SetSelfTradePrevention(messages.SelfTradePreventionRequest{UserID: user, Mode: "CANCEL_SOMETIMES"}); response.Success {
+		t.Fatal("accepted an unknown self-trade prevention mode")
+	}
+	if response := engine.SetSelfTradePrevention(messages.SelfTradePreventionRequest{UserID: user, Mode: models.STP_CANCEL_OLDEST}); !response.Success {
+		t.Fatalf("refused CANCEL_OLDEST: %s", response.Message)
+	}
+
+	resting := placeOrder(t, engine, limitOrder(user, models.SELL, "100", "1"))
+	other := placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+	incoming := placeOrder(t, engine, limitOrder(user, models.BUY, "100", "1"))
+
+	if incoming.SelfTradePrevention != models.STP_CANCEL_OLDEST {
+		t.Errorf("incoming mode: got %s, want the account's CANCEL_OLDEST", incoming.SelfTradePrevention)
+	}
+	if resting.Status != models.CANCELLED || resting.StatusReason != orderbook.StopReasonSelfTrade {
+		t.Errorf("own resting order: got %s (%s), want CANCELLED (%s)", resting.Status, resting.StatusReason, orderbook.StopReasonSelfTrade)
+	}
+	if incoming.Status != models.FILLED || other.Status != models.FILLED {
+		t.Errorf("got %s against %s, want both FILLED", incoming.Status, other.Status)
+	}
+
+	// An order's own mode wins over the account default
+	request := limitOrder(user, models.SELL, "100", "1")
+	request.SelfTradePrevention = models.STP_CANCEL_NEWEST
+	if order := placeOrder(t, engine, request); order.SelfTradePrevention != models.STP_CANCEL_NEWEST {
+		t.Errorf("override: got %s, want CANCEL_NEWEST", order.SelfTradePrevention)
+	}
+}
+
+func TestModifyOrder(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+	ask := placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "101", "1"))
+	bid := placeOrder(t, engine, limitOrder(user, models.BUY, "99", "1"))
+
+	if _, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: uuid.New(), OrderID: bid.ID.String(), Price: dec("101")}); err != orderbook.ErrOrderNotFound {
+		t.Errorf("another user's order: got %v, want %v", err, orderbook.ErrOrderNotFound)
+	}
+	if _, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: user, OrderID: "not-an-id", Price: dec("101")}); err != orderbook.ErrOrderNotFound {
+		t.Errorf("malformed ID: got %v, want %v", err, orderbook.ErrOrderNotFound)
+	}
+
+	order, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: user, OrderID: bid.ID.String(), Price: dec("101")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.ID != bid.ID || order.Status != models.FILLED || ask.Status != models.FILLED {
+		t.Errorf("got %s against %s, want the amended bid to fill the ask", order.Status, ask.Status)
+	}
+
+	// Stops waiting in the trigger book can't be amended
+	stop := placeOrder(t, engine, stopOrder(user, models.SELL, "90", "", "1"))
+	if _, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: user, OrderID: stop.ID.String(), Quantity: dec("2")}); err != ErrStopNotTriggered {
+		t.Errorf("untriggered stop: got %v, want %v", err, ErrStopNotTriggered)
+	}
+	if !stop.Quantity.Equal(*dec("1")) || len(engine.triggerBook(testMarket).Orders) != 1 {
+		t.Errorf("refused amend changed the stop: quantity %s", stop.Quantity)
+	}
+}
+
+func TestCancelAllOrders(t *testing.T) {
+	tests := []struct {
+		name      string
+		market    string
+		side      models.OrderSide
+		cancelled []string
+	}{
+		{"everything", "", "", []string{"btc bid", "btc ask", "btc stop"}},
+		{"its market", "BTC_USD", "", []string{"btc bid", "btc ask", "btc stop"}},
+		{"one side, untriggered stops included", "", models.SELL, []string{"btc ask", "btc stop"}},
+		{"one side of one market", "BTC_USD", models.BUY, []string{"btc bid"}},
+		{"another market", "SOL_USD", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			user := uuid.New()
+
+			orders := map[string]*models.Order{
+				"btc bid":  placeOrder(t, engine, limitOrder(user, models.BUY, "90", "1")),
+				"btc ask":  placeOrder(t, engine, limitOrder(user, models.SELL, "110", "1")),
+				"btc stop": placeOrder(t, engine, stopOrder(user, models.SELL, "80", "", "1")),
+			}
+			other := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "95", "1"))
+
+			cancelled := engine.CancelAllOrders(messages.CancelAllOrdersRequest{UserID: user, Market: tt.market, Side: tt.side})
+
+			if len(cancelled) != len(tt.cancelled) {
+				t.Errorf("got %d orders cancelled, want %d", len(cancelled), len(tt.cancelled))
+			}
+			for _, name := range tt.cancelled {
+				if orders[name].Status != models.CANCELLED {
+					t.Errorf("%s: got %s, want CANCELLED", name, orders[name].Status)
+				}
+			}
+			if left, _ := engine.GetOpenOrders(user, ""); len(left) != len(orders)-len(tt.cancelled) {
+				t.Errorf("got %d orders left open, want %d", len(left), len(orders)-len(tt.cancelled))
+			}
+			if other.Status != models.PENDING {
+				t.Errorf("another user's order: got %s, want PENDING", other.Status)
+			}
+		})
+	}
+}
+
+func TestOrderIndex(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+	resting := placeOrder(t, engine, limitOrder(user, models.BUY, "99", "2"))
+	stop := placeOrder(t, engine, stopOrder(user, models.SELL, "90", "", "1"))
+
+	for _, order := range []*models.Order{resting, stop} {
+		if _, found := engine.GetOrder(order.ID, user); !found {
+			t.Errorf("%s order is not indexed", order.Type)
+		}
+		if _, found := engine.GetOrder(order.ID, uuid.New()); found {
+			t.Errorf("%s order was found for another user", order.Type)
+		}
+	}
+
+	// A partial fill updates the indexed order, a full fill drops it
+	placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "99", "1"))
+	if order, _ := engine.GetOrder(resting.ID, user); order == nil || order.Status != models.PARTIAL {
+		t.Errorf("got %v, want the PARTIAL order", order)
+	}
+	placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "99", "1"))
+	if _, found := engine.GetOrder(resting.ID, user); found {
+		t.Error("filled order is still indexed")
+	}
+
+	if _, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: stop.ID.String()}); err != nil {
+		t.Fatal("failed to cancel an indexed stop order")
+	}
+	if len(engine.OrderIndex) != 0 {
+		t.Errorf("got %d orders indexed, want none", len(engine.OrderIndex))
+	}
+}
+
+func TestOrderDirectory(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.Directory = NewOrderDirectory()
+	user := uuid.New()
+
+	order := placeOrder(t, engine, limitOrder(user, models.BUY, "99", "1"))
+	if market, found := engine.Directory.Market(order.ID); !found || market != testMarket {
+		t.Fatalf("got %q (found %v), want %s", market, found, testMarket)
+	}
+
+	engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: order.ID.String()})
+	if _, found := engine.Directory.Market(order.ID); found {
+		t.Error("cancelled order is still in the directory")
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// FeeRates are what a user pays for making and taking liquidity, as fractions of
+// what they receive from the trade
+type FeeRates struct {
+	Maker decimal.Decimal `json:"maker"`
+	Taker decimal.Decimal `json:"taker"`
+}
+
+// FeeSchedule is a market's fee rates by tier. A tier without rates of its own
+// pays those of the closest tier below it, and tier 0 pays Base.
+type FeeSchedule struct {
+	Base  FeeRates         `json:"base"`
+	Tiers map[int]FeeRates `json:"tiers,omitempty"`
+}
+
+// feeScheduleFromModel reads a market's fee schedule from its row and its
+// market_fees rows
+func feeScheduleFromModel(m models.Market) FeeSchedule {
+	schedule := FeeSchedule{Base: FeeRates{Maker: m.MakerFee, Taker: m.TakerFee}}
+
+	for _, fee := range m.Fees {
+		if fee.Tier <= 0 {
+			continue
+		}
+		if schedule.Tiers == nil {
+			schedule.Tiers = make(map[int]FeeRates)
+		}
+		schedule.Tiers[fee.Tier] = FeeRates{Maker: fee.MakerFee, Taker: fee.TakerFee}
+	}
+	return schedule
+}
+
+// Rates returns the rates a user in the given tier pays
+func (s FeeSchedule) Rates(tier int) FeeRates {
+	best, rates := 0, s.Base
+	for t, tierRates := range s.Tiers {
+		if t <= tier && t > best {
+			best, rates = t, tierRates
+		}
+	}
+	return rates
+}
+
+// Equal reports whether two fee schedules charge the same
+func (s FeeSchedule) Equal(other FeeSchedule) bool {
+	if !s.Base.equal(other.Base) || len(s.Tiers) != len(other.Tiers) {
+		return false
+	}
+	for tier, rates := range s.Tiers {
+		otherRates, exists := other.Tiers[tier]
+		if !exists || !rates.equal(otherRates) {
+			return false
+		}
+	}
+	return true
+}
+
+// String lists the schedule's rates, lowest tier first
+func (s FeeSchedule) String() string {
+	tiers := []int{}
+	for tier := range s.Tiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Ints(tiers)
+
+	description := fmt.Sprintf("maker %s taker %s", s.Base.Maker.String(), s.Base.Taker.String())
+	for _, tier := range tiers {
+		description += fmt.Sprintf(", tier %d maker %s taker %s", tier, s.Tiers[tier].Maker.String(), s.Tiers[tier].Taker.String())
+	}
+	return description
+}
+
+func (r FeeRates) equal(other FeeRates) bool {
+	return r.Maker.Equal(other.Maker) && r.Taker.Equal(other.Taker)
+}
+
+// marketFees charges a market's fee schedule at each user's tier. Both are looked
+// up at match time, so a changed schedule or tier applies from the next trade.
+type marketFees struct {
+	engine *Engine
+	market string
+}
+
+func (f marketFees) FeeRates(userID uuid.UUID) (maker, taker decimal.Decimal) {
+	market := f.engine.GetMarketByTicker(f.market)
+	if market == nil {
+		return decimal.Zero, decimal.Zero
+	}
+
+	rates := market.Fees.Rates(f.engine.FeeTiers[userID])
+	return rates.Maker, rates.Taker
+}
+
+// SetFeeTier moves a user to another fee tier. Users the engine has never been
+// told about are in tier 0.
+func (e *Engine) SetFeeTier(req messages.FeeTierRequest) messages.FeeTierResponse {
+	if req.Tier < 0 {
+		return messages.FeeTierResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid fee tier %d", req.Tier),
+			Tier:    e.FeeTiers[req.UserID],
+		}
+	}
+
+	if req.Tier == 0 {
+		delete(e.FeeTiers, req.UserID)
+	} else {
+		e.FeeTiers[req.UserID] = req.Tier
+	}
+	log.Printf("💸 Fee tier for user %s set to %d", req.UserID.String(), req.Tier)
+
+	return messages.FeeTierResponse{
+		Success: true,
+		Message: "Fee tier updated",
+		Tier:    req.Tier,
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestFeeScheduleRates(t *testing.T) {
+	rates := func(maker, taker string) FeeRates {
+		return FeeRates{Maker: decimal.RequireFromString(maker), Taker: decimal.RequireFromString(taker)}
+	}
+	schedule := FeeSchedule{
+		Base:  rates("0.001", "0.002"),
+		Tiers: map[int]FeeRates{2: rates("0.0005", "0.001"), 4: rates("0", "0.0005")},
+	}
+
+	tests := []struct {
+		tier int
+		want FeeRates
+	}{
+		{0, rates("0.001", "0.002")},
+		{1, rates("0.001", "0.002")},
+		{2, rates("0.0005", "0.001")},
+		{3, rates("0.0005", "0.001")},
+		{7, rates("0", "0.0005")},
+	}
+	for _, tt := range tests {
+		if got := schedule.Rates(tt.tier); !got.equal(tt.want) {
+			t.Errorf("tier %d: got maker %s taker %s, want maker %s taker %s", tt.tier, got.Maker, got.Taker, tt.want.Maker, tt.want.Taker)
+		}
+	}
+}
+
+func TestSetFeeTier(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.Markets[0].Fees.Tiers = map[int]FeeRates{1: {Maker: decimal.Zero, Taker: decimal.RequireFromString("0.001")}}
+	user := uuid.New()
+
+	// The book charges each user the market's rates for their tier
+	placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "99", "1"))
+	book := engine.Orderbooks[0]
+	if maker, taker := book.Fees.FeeRates(user); !maker.Equal(decimal.RequireFromString("0.001")) || !taker.Equal(decimal.RequireFromString("0.002")) {
+		t.Errorf("tier 0: got maker %s taker %s, want 0.001 and 0.002", maker, taker)
+	}
+
+	if response := engine.SetFeeTier(messages.FeeTierRequest{UserID: user, Tier: -1}); response.Success {
+		t.Error("accepted a negative fee tier")
+	}
+	send(engine, "SET_FEE_TIER", messages.FeeTierRequest{UserID: user, Tier: 3})
+	if maker, taker := book.Fees.FeeRates(user); !maker.IsZero() || !taker.Equal(decimal.RequireFromString("0.001")) {
+		t.Errorf("tier 3: got maker %s taker %s, want 0 and 0.001", maker, taker)
+	}
+
+	// Back in tier 0 the user is forgotten
+	send(engine, "SET_FEE_TIER", messages.FeeTierRequest{UserID: user, Tier: 0})
+	if _, exists := engine.FeeTiers[user]; exists {
+		t.Error("user back in tier 0 is still listed")
+	}
+}
+
+func TestDefaultMarketFeeTiers(t *testing.T) {
+	schedule := MarketFromModel(DefaultMarkets[0]).Fees
+	for tier, want := range map[int][2]string{0: {"0.001", "0.002"}, 2: {"0.0006", "0.0015"}, 9: {"0.0002", "0.001"}} {
+		rates := schedule.Rates(tier)
+		if !rates.Maker.Equal(decimal.RequireFromString(want[0])) || !rates.Taker.Equal(decimal.RequireFromString(want[1])) {
+			t.Errorf("tier %d: got maker %s taker %s, want %s and %s", tier, rates.Maker, rates.Taker, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/KshitijBhardwaj18/Orbix/shared/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const reasonInsufficientFunds = "INSUFFICIENT_FUNDS"
+
+// fundsOutboxSize is how many funds events may wait for Redis before applying
+// commands blocks, so that a market stops rather than loses a settlement
+const fundsOutboxSize = 4096
+
+// FundLock is the part of a user's balance that open orders hold: the quote asset
+// for buys and the base asset for sells. Both legs of an OCO group share one lock,
+// as only one of them can trade.
+type FundLock struct {
+	UserID uuid.UUID       `json:"user_id"`
+	Asset  string          `json:"asset"`
+	Amount decimal.Decimal `json:"amount"` // Still locked
+	Orders []uuid.UUID     `json:"orders"` // Live orders drawing on it; what is left is released when the last closes
+}
+
+// fundsHold is what a command locked in the shared balances before it was
+// journaled, until applying it hands the funds to the orders it places
+type fundsHold struct {
+	UserID uuid.UUID
+	Asset  string
+	Amount decimal.Decimal
+}
+
+// AttachBalances starts checking and moving funds in the shared balances, and
+// locks what the engine's open orders hold. Recovery and bootstrapping happen
+// before this, so the balances never see a replayed command.
+func (e *Engine) AttachBalances(balances *BalanceCache) {
+	for _, lock := range e.Locks {
+		balances.Apply(lock.UserID, lock.Asset, lock.Amount.Neg(), lock.Amount)
+	}
+	e.Balances = balances
+}
+
+// tracksBalances reports whether fund movements reach the shared balances
+func (e *Engine) tracksBalances() bool {
+	return e.Balances != nil && !e.replaying
+}
+
+// spendAsset is the asset an order pays with
+func spendAsset(order *models.Order) string {
+	baseAsset, quoteAsset, _ := utils.ParseMarketId(order.MarketID)
+	if order.Side == models.BUY {
+		return quoteAsset
+	}
+	return baseAsset
+}
+
+// fundsRequired is how much of its spend asset an order locks for its remaining
+// quantity. Buys are valued at the worst price they may trade at: the limit or
+// protection price, the stop price of a stop without either, or what sweeping
+// the book costs now for a plain market order.
+func fundsRequired(ob *orderbook.OrderBook, order *models.Order) decimal.Decimal {
+	if order.Side == models.SELL {
+		return order.RemainingQuantity
+	}
+
+	switch {
+	case order.Price != nil:
+		return order.Price.Mul(order.RemainingQuantity)
+	case order.ProtectionPrice != nil:
+		return order.ProtectionPrice.Mul(order.RemainingQuantity)
+	case order.StopPrice != nil:
+		return order.StopPrice.Mul(order.RemainingQuantity)
+	case order.Type == models.TRAILING_STOP:
+		// Valued where placeStopOrder will put its stop
+		reference := trailingReference(ob, order)
+		if reference == nil {
+			return decimal.Zero
+		}
+		return trailingStopPrice(order, *reference).Mul(order.RemainingQuantity)
+	default:
+		return ob.SweepCost(order)
+	}
+}
+
+// groupFundsRequired is what the legs of an OCO group lock together: the most
+// either of them needs
+func groupFundsRequired(ob *orderbook.OrderBook, state *OrderGroupState) decimal.Decimal {
+	return decimal.Max(fundsRequired(ob, state.TakeProfit), fundsRequired(ob, state.StopLoss))
+}
+
+// fundLock returns the lock an order draws on and its key, the order's ID or its
+// OCO group's. Orders that lock nothing, like demo liquidity, have none.
+func (e *Engine) fundLock(order *models.Order) (uuid.UUID, *FundLock) {
+	keys := []uuid.UUID{order.ID}
+	if order.GroupID != nil {
+		keys = append(keys, *order.GroupID)
+	}
+
+	for _, key := range keys {
+		if lock, exists := e.Locks[key]; exists && slices.Contains(lock.Orders, order.ID) {
+			return key, lock
+		}
+	}
+	return uuid.Nil, nil
+}
+
+// lockFunds locks what an order needs as it enters the orderbook or trigger book,
+// and reports whether the user could pay for it. An OCO leg joins its sibling's
+// lock. New orders were paid for by holdFunds; bracket legs can only use what
+// their entry's trades reserved for them, so whether they are placed depends on
+// nothing but the market's own journal.
+func (e *Engine) lockFunds(ob *orderbook.OrderBook, order *models.Order) bool {
+	key := order.ID
+	amount := fundsRequired(ob, order)
+	bracketLeg := false
+	if order.GroupID != nil {
+		if state, exists := e.Groups[*order.GroupID]; exists && order != state.Entry {
+			key = *order.GroupID
+			amount = groupFundsRequired(ob, state)
+			bracketLeg = state.Entry != nil
+		}
+	}
+
+	if lock, exists := e.Locks[key]; exists {
+		if bracketLeg && lock.Amount.LessThan(amount) {
+			log.Printf("⛔ Lock %s refused: %s %s needed, the entry reserved %s", key.String(), amount.String(), lock.Asset, lock.Amount.String())
+			return false
+		}
+		if !slices.Contains(lock.Orders, order.ID) {
+			lock.Orders = append(lock.Orders, order.ID)
+		}
+		return true
+	}
+	if bracketLeg {
+		return !amount.IsPositive()
+	}
+	if !amount.IsPositive() {
+		return true
+	}
+
+	lock := &FundLock{UserID: order.UserID, Asset: spendAsset(order), Orders: []uuid.UUID{order.ID}}
+	e.changeLock(key, lock, amount)
+	e.Locks[key] = lock
+	return true
+}
+
+// releaseFunds lets go of an order's lock once the order is closed. Every state
+// change is emitted through EmitOrderEvent, which calls this.
+func (e *Engine) releaseFunds(order *models.Order) {
+	if !isClosed(order.Status) {
+		return
+	}
+
+	key, lock := e.fundLock(order)
+	if lock == nil {
+		return
+	}
+
+	lock.Orders = slices.DeleteFunc(lock.Orders, func(id uuid.UUID) bool { return id == order.ID })
+	if len(lock.Orders) > 0 {
+		return
+	}
+
+	delete(e.Locks, key)
+	if lock.Amount.IsPositive() {
+		e.changeLock(key, lock, lock.Amount.Neg())
+	}
+}
+
+// amendFunds returns how much more an amended order's lock needs, negative if the
+// amend frees funds
+func (e *Engine) amendFunds(ob *orderbook.OrderBook, order, amended *models.Order) (uuid.UUID, *FundLock, decimal.Decimal) {
+	key, lock := e.fundLock(order)
+	if lock == nil {
+		return key, nil, decimal.Zero
+	}
+
+	required := fundsRequired(ob, amended)
+	for _, orderID := range lock.Orders {
+		if entry, exists := e.OrderIndex[orderID]; exists && orderID != order.ID {
+			required = decimal.Max(required, fundsRequired(ob, entry.order))
+		}
+	}
+
+	return key, lock, required.Sub(lock.Amount)
+}
+
+// changeLock grows a lock by amount, or shrinks it for a negative amount, and
+// moves the funds between the user's available and locked balance. A lock only
+// grows for a command holdFunds paid for before it was journaled, so it is never
+// refused here: the funds held for the command are used and the shared balances
+// are not checked again, which would let a replay decide differently. A replay
+// moves no balances but sends the change to the database again like the first time.
+func (e *Engine) changeLock(key uuid.UUID, lock *FundLock, amount decimal.Decimal) {
+	reason := "UNLOCK"
+	if amount.IsPositive() {
+		reason = "LOCK"
+	}
+
+	switch {
+	case !e.tracksBalances():
+	case amount.IsPositive():
+		taken := decimal.Zero
+		held := e.held
+		if held != nil && held.UserID == lock.UserID && held.Asset == lock.Asset {
+			taken = decimal.Min(held.Amount, amount)
+			held.Amount = held.Amount.Sub(taken)
+		}
+
+		if unheld := amount.Sub(taken); unheld.IsPositive() {
+			log.Printf("⚠️ Lock %s grew by %s %s more than was held for it", key.String(), unheld.String(), lock.Asset)
+			e.Balances.Apply(lock.UserID, lock.Asset, unheld.Neg(), unheld)
+		}
+	default:
+		e.Balances.Apply(lock.UserID, lock.Asset, amount.Neg(), amount)
+	}
+
+	lock.Amount = lock.Amount.Add(amount)
+	e.EmitBalanceChange(messages.BalanceChange{
+		UserID:    lock.UserID,
+		Asset:     lock.Asset,
+		Available: amount.Neg(),
+		Locked:    amount,
+		Reason:    reason,
+		Reference: &key,
+	})
+}
+
+// settleTrades moves the funds of every trade in a matching result between its
+// buyer and seller. It runs before the orders' new states are emitted, as orders
+// that closed release what their trades left of their lock.
+func (e *Engine) settleTrades(result *orderbook.MatchingResult) []messages.TradeSettlement {
+	orders := make(map[uuid.UUID]*models.Order)
+	if result.IncomingOrder != nil {
+		orders[result.IncomingOrder.ID] = result.IncomingOrder
+	}
+	for _, order := range result.UpdatedOrders {
+		orders[order.ID] = order
+	}
+
+	settlements := make([]messages.TradeSettlement, len(result.GeneratedTrades))
+	for i, trade := range result.GeneratedTrades {
+		settlements[i] = messages.TradeSettlement{
+			Buyer:  e.settleSide(orders[trade.BuyerOrderID], trade),
+			Seller: e.settleSide(orders[trade.SellerOrderID], trade),
+		}
+		e.recordEntryTrade(orders[trade.BuyerOrderID], trade)
+		e.recordEntryTrade(orders[trade.SellerOrderID], trade)
+	}
+	return settlements
+}
+
+// settleSide takes one side's payment out of its order's lock and credits what it
+// bought, net of its fee. A limit buy releases its limit price for every unit, so
+// a better trade price returns the difference to Available.
+func (e *Engine) settleSide(order *models.Order, trade models.Trade) *messages.SettlementSide {
+	if order == nil {
+		return nil
+	}
+	_, lock := e.fundLock(order)
+	if lock == nil {
+		return nil
+	}
+
+	baseAsset, quoteAsset, _ := utils.ParseMarketId(trade.MarketID)
+	side := &messages.SettlementSide{UserID: order.UserID}
+
+	if order.Side == models.BUY {
+		side.SpentAsset, side.Spent, side.Unlocked = quoteAsset, trade.QuoteQuantity, trade.QuoteQuantity
+		if order.Price != nil {
+			side.Unlocked = order.Price.Mul(trade.Quantity)
+		}
+		side.ReceivedAsset, side.Received = baseAsset, trade.Quantity.Sub(feeOf(trade.BuyerFee))
+	} else {
+		side.SpentAsset, side.Spent, side.Unlocked = baseAsset, trade.Quantity, trade.Quantity
+		side.ReceivedAsset, side.Received = quoteAsset, trade.QuoteQuantity.Sub(feeOf(trade.SellerFee))
+	}
+
+	side.Unlocked = decimal.Min(side.Unlocked, lock.Amount)
+	lock.Amount = lock.Amount.Sub(side.Unlocked)
+	e.reserveForLegs(order, side)
+
+	if e.tracksBalances() {
+		e.Balances.Apply(order.UserID, side.SpentAsset, side.Unlocked.Sub(side.Spent), side.Unlocked.Neg())
+		e.Balances.Apply(order.UserID, side.ReceivedAsset, side.Received.Sub(side.Reserved), side.Reserved)
+	}
+
+	return side
+}
+
+// reserveForLegs keeps what a bracket entry's trade brought in locked under its
+// group, for the legs that close the position with it. It never reaches Available,
+// where another market could spend it before the legs are placed.
+func (e *Engine) reserveForLegs(order *models.Order, side *messages.SettlementSide) {
+	if order.GroupID == nil {
+		return
+	}
+	state, exists := e.Groups[*order.GroupID]
+	if !exists || state.Entry == nil || state.Entry.ID != order.ID {
+		return
+	}
+
+	lock, exists := e.Locks[state.Group.ID]
+	if !exists {
+		lock = &FundLock{UserID: order.UserID, Asset: side.ReceivedAsset, Orders: []uuid.UUID{state.TakeProfit.ID, state.StopLoss.ID}}
+		e.Locks[state.Group.ID] = lock
+	}
+
+	side.Reserved = side.Received
+	lock.Amount = lock.Amount.Add(side.Reserved)
+}
+
+func feeOf(fee *decimal.Decimal) decimal.Decimal {
+	if fee == nil {
+		return decimal.Zero
+	}
+	return *fee
+}
+
+// affordTriggeredOrder cuts a triggered market buy down to what its lock can pay
+// for at the prices in the book now. A stop's lock is valued at its stop price,
+// and the market has usually moved past it by the time the stop fires. It returns
+// false if the lock buys nothing at all.
+func (e *Engine) affordTriggeredOrder(ob *orderbook.OrderBook, order *models.Order) bool {
+	if order.Side != models.BUY || order.Price != nil {
+		return true
+	}
+
+	_, lock := e.fundLock(order)
+	if lock == nil || ob.SweepCost(order).LessThanOrEqual(lock.Amount) {
+		return true
+	}
+
+	affordable := e.marketRules(order.MarketID).RoundQuantity(ob.AffordableQuantity(order, lock.Amount))
+	if !affordable.IsPositive() {
+		return false
+	}
+
+	log.Printf("🪙 Triggered order %s cut from %s to %s, all its locked funds buy", order.ID.String(), order.RemainingQuantity.String(), affordable.String())
+	order.Quantity = order.Quantity.Sub(order.RemainingQuantity).Add(affordable)
+	order.RemainingQuantity = affordable
+	return true
+}
+
+// holdFunds locks what a new order, order group or amend needs before the command
+// is journaled. The balances are shared with the other markets, so this is the one
+// place they are checked, and a replay of the journal never depends on them.
+func (e *Engine) holdFunds(message *messages.MessageFromAPI) bool {
+	if e.Balances == nil {
+		return true
+	}
+
+	need := e.fundsNeeded(message)
+	if need == nil || !need.Amount.IsPositive() {
+		return true
+	}
+	if !e.Balances.Lock(need.UserID, need.Asset, need.Amount) {
+		log.Printf("⛔ %s for user %s refused: %s %s needed, %s available", message.MessageType,
+			need.UserID.String(), need.Amount.String(), need.Asset, e.Balances.Get(need.UserID, need.Asset).Available.String())
+		return false
+	}
+
+	e.held = need
+	return true
+}
+
+// releaseHold makes whatever the applied command did not lock available again
+func (e *Engine) releaseHold() {
+	if held := e.held; held != nil && held.Amount.IsPositive() {
+		e.Balances.Apply(held.UserID, held.Asset, held.Amount, held.Amount.Neg())
+	}
+	e.held = nil
+}
+
+// fundsNeeded works out what a command will lock when it is applied. Commands that
+// will be rejected for another reason need nothing.
+func (e *Engine) fundsNeeded(message *messages.MessageFromAPI) *fundsHold {
+	dataBytes, _ := json.Marshal(message.Data)
+
+	switch message.MessageType {
+	case "CREATE_ORDER":
+		var orderReq messages.OrderRequest
+		if json.Unmarshal(dataBytes, &orderReq) != nil || e.marketUnavailable(orderReq.MarketID) != "" {
+			return nil
+		}
+
+		ob, err := e.FindOrderbook(orderReq.MarketID)
+		if err != nil {
+			return nil
+		}
+		order := e.newOrder(orderReq)
+		return &fundsHold{UserID: order.UserID, Asset: spendAsset(order), Amount: fundsRequired(ob, order)}
+
+	case "CREATE_ORDER_GROUP":
+		var groupReq messages.OrderGroupRequest
+		if json.Unmarshal(dataBytes, &groupReq) != nil || e.marketUnavailable(groupReq.MarketID) != "" {
+			return nil
+		}
+
+		// A bracket only needs funds for its entry; the legs sell what it buys
+		ob, err := e.FindOrderbook(groupReq.MarketID)
+		if err != nil {
+			return nil
+		}
+		if groupReq.Entry != nil {
+			entry := e.newGroupOrder(groupReq, *groupReq.Entry, uuid.Nil)
+			return &fundsHold{UserID: entry.UserID, Asset: spendAsset(entry), Amount: fundsRequired(ob, entry)}
+		}
+
+		state := &OrderGroupState{
+			TakeProfit: e.newGroupOrder(groupReq, groupReq.TakeProfit, uuid.Nil),
+			StopLoss:   e.newGroupOrder(groupReq, groupReq.StopLoss, uuid.Nil),
+		}
+		return &fundsHold{UserID: groupReq.UserID, Asset: spendAsset(state.TakeProfit), Amount: groupFundsRequired(ob, state)}
+
+	case "MODIFY_ORDER":
+		var modifyReq messages.ModifyOrderRequest
+		if json.Unmarshal(dataBytes, &modifyReq) != nil {
+			return nil
+		}
+		orderID, err := uuid.Parse(modifyReq.OrderID)
+		if err != nil {
+			return nil
+		}
+		entry, found := e.lookupOrder(orderID, modifyReq.UserID)
+		if !found {
+			return nil
+		}
+
+		amended := amendOrder(entry.order, modifyReq)
+		_, lock, more := e.amendFunds(entry.orderbook, entry.order, &amended)
+		if lock == nil {
+			return nil
+		}
+		return &fundsHold{UserID: lock.UserID, Asset: lock.Asset, Amount: more}
+	}
+
+	return nil
+}
+
+// refuseUnfunded answers a command holdFunds turned down. It was never journaled,
+// so a refused order gets a random ID and the wall clock rather than the command clock's.
+func (e *Engine) refuseUnfunded(message *messages.MessageFromAPI) {
+	dataBytes, _ := json.Marshal(message.Data)
+
+	switch message.MessageType {
+	case "CREATE_ORDER":
+		var orderReq messages.OrderRequest
+		json.Unmarshal(dataBytes, &orderReq)
+
+		order := e.newOrder(orderReq)
+		order.ID = uuid.New()
+		order.CreatedAt = time.Now()
+		order.UpdatedAt = order.CreatedAt
+
+		e.reply("ORDER_UPDATE", message.ClientId, e.rejectOrder(order, reasonInsufficientFunds))
+
+	case "CREATE_ORDER_GROUP":
+		e.reply("ORDER_GROUP", message.ClientId, &messages.OrderGroupResponse{Success: false, Message: reasonInsufficientFunds})
+
+	case "MODIFY_ORDER":
+		e.reply("ORDER_MODIFIED", message.ClientId, messages.ModifyOrderResponse{Success: false, Message: reasonInsufficientFunds})
+	}
+}
+
+// fundsOutbox holds funds events until pushFundsEvents has handed them to Redis
+type fundsOutbox struct {
+	events chan []byte
+	done   chan struct{} // Closed once events is closed and everything in it pushed
+}
+
+// pushFundsEvent puts one funds event on the funds queue
+var pushFundsEvent = func(b *broker.Broker, data []byte) error {
+	return b.PushEvent(broker.FundsQueue, data)
+}
+
+// queueFundsEvent numbers a lock change or trade settlement and hands it to the
+// outbox, which pushes the events onto the funds queue in the order they came.
+// Replayed commands send their events again under the same numbers: the ones the
+// database already has are skipped by its cursor, and the ones that never got
+// there before the engine stopped are not lost.
+func (e *Engine) queueFundsEvent(event messages.FundsEvent) {
+	event.Journal, event.Sequence, event.Index = e.Clock.NextEvent()
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("❌ Failed to marshal funds event: %v", err)
+		return
+	}
+
+	if e.fundsOutbox == nil {
+		e.fundsOutbox = &fundsOutbox{events: make(chan []byte, fundsOutboxSize), done: make(chan struct{})}
+		go e.pushFundsEvents(e.fundsOutbox)
+	}
+	e.fundsOutbox.events <- data
+}
+
+// pushFundsEvents pushes funds events onto the funds queue one at a time, so they
+// reach the database in order, retrying each until Redis takes it
+func (e *Engine) pushFundsEvents(outbox *fundsOutbox) {
+	defer close(outbox.done)
+
+	for data := range outbox.events {
+		for attempt := 1; ; attempt++ {
+			err := pushFundsEvent(e.Broker, data)
+			if err == nil {
+				break
+			}
+
+			log.Printf("❌ Failed to push funds event (attempt %d): %v", attempt, err)
+			time.Sleep(min(time.Duration(attempt)*100*time.Millisecond, 5*time.Second))
+		}
+	}
+}
+
+// FlushFundsEvents closes the outbox and waits until Redis has taken every event
+// in it. The next event opens a new one. Commands a snapshot covers are never
+// replayed, so their events must be out before it is taken.
+func (e *Engine) FlushFundsEvents() {
+	if e.fundsOutbox == nil {
+		return
+	}
+
+	close(e.fundsOutbox.events)
+	<-e.fundsOutbox.done
+	e.fundsOutbox = nil
+}
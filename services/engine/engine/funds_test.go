@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// checkBalance fails the test unless a user's balance of asset is available/locked
+func checkBalance(t *testing.T, engine *Engine, userID uuid.UUID, asset, available, locked string) {
+	t.Helper()
+	balance := engine.Balances.Get(userID, asset)
+	if !balance.Available.Equal(decimal.RequireFromString(available)) || !balance.Locked.Equal(decimal.RequireFromString(locked)) {
+		t.Errorf("%s: got %s available and %s locked, want %s and %s", asset, balance.Available, balance.Locked, available, locked)
+	}
+}
+
+func TestOrderLocksFunds(t *testing.T) {
+	tests := []struct {
+		name      string
+		asset     string
+		funds     string
+		order     func(userID uuid.UUID) messages.OrderRequest
+		placed    bool
+		available string
+		locked    string
+	}{
+		{
+			name:      "limit buy locks its price for every unit",
+			asset:     "USD",
+			funds:     "1000",
+			order:     func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "100", "2") },
+			placed:    true,
+			available: "800",
+			locked:    "200",
+		},
+		{
+			name:      "limit sell locks the base asset",
+			asset:     "BTC",
+			funds:     "5",
+			order:     func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.SELL, "100", "2") },
+			placed:    true,
+			available: "3",
+			locked:    "2",
+		},
+		{
+			name:  "stop buy locks its stop price for every unit",
+			asset: "USD",
+			funds: "1000",
+			order: func(userID uuid.UUID) messages.OrderRequest {
+				return messages.OrderRequest{UserID: userID, MarketID: testMarket, Side: models.BUY, Type: models.STOP_MARKET, StopPrice: dec("105"), Quantity: *dec("2")}
+			},
+			placed:    true,
+			available: "790",
+			locked:    "210",
+		},
+		{
+			name:      "buy the user can't pay for is refused",
+			asset:     "USD",
+			funds:     "150",
+			order:     func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "100", "2") },
+			available: "150",
+			locked:    "0",
+		},
+		{
+			name:      "sell of more than the user holds is refused",
+			asset:     "BTC",
+			funds:     "1",
+			order:     func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.SELL, "100", "2") },
+			available: "1",
+			locked:    "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := uuid.New()
+			engine := fundedEngine(t, map[uuid.UUID]map[string]string{user: {tt.asset: tt.funds}})
+
+			send(engine, "CREATE_ORDER", tt.order(user))
+
+			orders := userOrders(engine, user)
+			if placed := len(orders) == 1; placed != tt.placed {
+				t.Fatalf("placed: got %v, want %v", placed, tt.placed)
+			}
+			checkBalance(t, engine, user, tt.asset, tt.available, tt.locked)
+			if !tt.placed {
+				return
+			}
+
+			// Cancelling releases everything the order locked
+			send(engine, "CANCEL_ORDER", messages.CancelOrderRequest{UserID: user, OrderID: orders[0].ID.String()})
+			checkBalance(t, engine, user, tt.asset, tt.funds, "0")
+			if len(engine.Locks) != 0 {
+				t.Errorf("%d locks left after the cancel", len(engine.Locks))
+			}
+		})
+	}
+}
+
+func TestTradeSettlesLockedFunds(t *testing.T) {
+	seller, buyer := uuid.New(), uuid.New()
+	engine := fundedEngine(t, map[uuid.UUID]map[string]string{
+		seller: {"BTC": "2"},
+		buyer:  {"USD": "1000"},
+	})
+
+	send(engine, "CREATE_ORDER", limitOrder(seller, models.SELL, "100", "1"))
+	send(engine, "CREATE_ORDER", limitOrder(buyer, models.BUY, "120", "1"))
+
+	// The buyer locked 120 but paid 100 and takes 0.2% of the BTC as fee; the
+	// seller made the market and pays 0.1% of the USD
+	checkBalance(t, engine, buyer, "USD", "900", "0")
+	checkBalance(t, engine, buyer, "BTC", "0.998", "0")
+	checkBalance(t, engine, seller, "BTC", "1", "0")
+	checkBalance(t, engine, seller, "USD", "99.9", "0")
+	if len(engine.Locks) != 0 {
+		t.Errorf("%d locks left after both orders filled", len(engine.Locks))
+	}
+}
+
+func TestAmendChangesLock(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  string
+		amended   string
+		available string
+		locked    string
+	}{
+		{"amending down releases funds", "0.5", "0.5", "55", "45"},
+		{"amending up locks more", "1.1", "1.1", "1", "99"},
+		{"amending beyond the balance is refused", "2", "1", "10", "90"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := uuid.New()
+			engine := fundedEngine(t, map[uuid.UUID]map[string]string{user: {"USD": "100"}})
+			send(engine, "CREATE_ORDER", limitOrder(user, models.BUY, "90", "1"))
+			order := userOrders(engine, user)[0]
+
+			send(engine, "MODIFY_ORDER", messages.ModifyOrderRequest{UserID: user, OrderID: order.ID.String(), Quantity: dec(tt.quantity)})
+
+			if !order.Quantity.Equal(decimal.RequireFromString(tt.amended)) {
+				t.Errorf("quantity: got %s, want %s", order.Quantity, tt.amended)
+			}
+			checkBalance(t, engine, user, "USD", tt.available, tt.locked)
+		})
+	}
+}
+
+func TestOrderGroupLocksFunds(t *testing.T) {
+	t.Run("OCO legs share one lock", func(t *testing.T) {
+		trader, buyer := uuid.New(), uuid.New()
+		engine := fundedEngine(t, map[uuid.UUID]map[string]string{trader: {"BTC": "1"}, buyer: {"USD": "200"}})
+
+		send(engine, "CREATE_ORDER_GROUP", sellGroup(trader, "", "1"))
+		if len(engine.Groups) != 1 || len(engine.Locks) != 1 {
+			t.Fatalf("got %d groups and %d locks, want one of each", len(engine.Groups), len(engine.Locks))
+		}
+		checkBalance(t, engine, trader, "BTC", "0", "1")
+
+		// The take-profit fills, which cancels the stop-loss and leaves no lock behind
+		send(engine, "CREATE_ORDER", limitOrder(buyer, models.BUY, "110", "1"))
+		checkBalance(t, engine, trader, "BTC", "0", "0")
+		checkBalance(t, engine, trader, "USD", "109.89", "0")
+		if len(engine.Locks) != 0 {
+			t.Errorf("%d locks left after the group completed", len(engine.Locks))
+		}
+	})
+
+	t.Run("OCO the user can't cover is refused", func(t *testing.T) {
+		trader := uuid.New()
+		engine := fundedEngine(t, map[uuid.UUID]map[string]string{trader: {"BTC": "0.5"}})
+
+		send(engine, "CREATE_ORDER_GROUP", sellGroup(trader, "", "1"))
+		if len(engine.Groups) != 0 || len(userOrders(engine, trader)) != 0 {
+			t.Errorf("placed %d groups and %d orders, want none", len(engine.Groups), len(userOrders(engine, trader)))
+		}
+		checkBalance(t, engine, trader, "BTC", "0.5", "0")
+	})
+
+	t.Run("bracket locks its entry until it is cancelled", func(t *testing.T) {
+		trader := uuid.New()
+		engine := fundedEngine(t, map[uuid.UUID]map[string]string{trader: {"USD": "150"}})
+
+		send(engine, "CREATE_ORDER_GROUP", sellGroup(trader, "100", "1"))
+		checkBalance(t, engine, trader, "USD", "50", "100")
+
+		for _, state := range engine.Groups {
+			send(engine, "CANCEL_ORDER", messages.CancelOrderRequest{UserID: trader, OrderID: state.Entry.ID.String()})
+		}
+		checkBalance(t, engine, trader, "USD", "150", "0")
+		if len(engine.Groups) != 0 || len(engine.Locks) != 0 {
+			t.Errorf("left %d groups and %d locks", len(engine.Groups), len(engine.Locks))
+		}
+	})
+}
+
+func TestBracketLegsLockWhatTheEntryBought(t *testing.T) {
+	seller, trader := uuid.New(), uuid.New()
+	engine := fundedEngine(t, map[uuid.UUID]map[string]string{
+		seller: {"BTC": "5"},
+		trader: {"USD": "1000"},
+	})
+
+	send(engine, "CREATE_ORDER", limitOrder(seller, models.SELL, "100", "0.4"))
+	send(engine, "CREATE_ORDER_GROUP", messages.OrderGroupRequest{
+		UserID:     trader,
+		MarketID:   testMarket,
+		Entry:      &messages.OrderRequest{Side: models.BUY, Type: models.LIMIT, Price: dec("100"), Quantity: *dec("1")},
+		TakeProfit: messages.OrderRequest{Side: models.SELL, Type: models.LIMIT, Price: dec("105"), Quantity: *dec("1")},
+		StopLoss:   messages.OrderRequest{Side: models.SELL, Type: models.STOP_MARKET, StopPrice: dec("80"), Quantity: *dec("1")},
+	})
+
+	if len(engine.Groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(engine.Groups))
+	}
+	for _, state := range engine.Groups {
+		// The entry bought 0.4 and paid 0.2% of it as taker fee
+		for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+			if !leg.Quantity.Equal(decimal.RequireFromString("0.3992")) {
+				t.Errorf("%s leg sized %s, want 0.3992", leg.Type, leg.Quantity)
+			}
+		}
+	}
+	checkBalance(t, engine, trader, "BTC", "0", "0.3992")
+	checkBalance(t, engine, trader, "USD", "900", "60")
+}
+
+func TestBracketLegsUnfundedAreCancelled(t *testing.T) {
+	buyer, trader := uuid.New(), uuid.New()
+	engine := fundedEngine(t, map[uuid.UUID]map[string]string{
+		buyer:  {"USD": "1000"},
+		trader: {"BTC": "1"},
+	})
+
+	// A short bracket: its legs buy back with what the entry's sale brought in,
+	// 99.8 after the taker fee, which doesn't cover the stop loss
+	send(engine, "CREATE_ORDER", limitOrder(buyer, models.BUY, "100", "1"))
+	send(engine, "CREATE_ORDER_GROUP", messages.OrderGroupRequest{
+		UserID:     trader,
+		MarketID:   testMarket,
+		Entry:      &messages.OrderRequest{Side: models.SELL, Type: models.LIMIT, Price: dec("100"), Quantity: *dec("1")},
+		TakeProfit: messages.OrderRequest{Side: models.BUY, Type: models.LIMIT, Price: dec("95"), Quantity: *dec("1")},
+		StopLoss:   messages.OrderRequest{Side: models.BUY, Type: models.STOP_MARKET, StopPrice: dec("108"), Quantity: *dec("1")},
+	})
+
+	if len(engine.Groups) != 0 || len(engine.Locks) != 0 || len(userOrders(engine, trader)) != 0 {
+		t.Errorf("left %d groups, %d locks and %d orders", len(engine.Groups), len(engine.Locks), len(userOrders(engine, trader)))
+	}
+	checkBalance(t, engine, trader, "BTC", "0", "0")
+	checkBalance(t, engine, trader, "USD", "99.8", "0")
+}
+
+func TestBracketLegLocksReplay(t *testing.T) {
+	dir := t.TempDir()
+	buyer, trader := uuid.New(), uuid.New()
+	pushed := captureFundsEvents(t)
+
+	// The trader has USD to spare, but the legs only get what the entry's sale
+	// brought in, so they are refused the same way whatever the balances were
+	engine := openTestEngine(t, dir)
+	balances := NewBalanceCache()
+	balances.Apply(buyer, "USD", decimal.NewFromInt(1000), decimal.Zero)
+	balances.Apply(trader, "BTC", decimal.NewFromInt(1), decimal.Zero)
+	balances.Apply(trader, "USD", decimal.NewFromInt(1000), decimal.Zero)
+	engine.AttachBalances(balances)
+
+	send(engine, "CREATE_ORDER", limitOrder(buyer, models.BUY, "100", "1"))
+	send(engine, "CREATE_ORDER_GROUP", messages.OrderGroupRequest{
+		UserID:     trader,
+		MarketID:   testMarket,
+		Entry:      &messages.OrderRequest{Side: models.SELL, Type: models.LIMIT, Price: dec("100"), Quantity: *dec("1")},
+		TakeProfit: messages.OrderRequest{Side: models.BUY, Type: models.LIMIT, Price: dec("95"), Quantity: *dec("1")},
+		StopLoss:   messages.OrderRequest{Side: models.BUY, Type: models.STOP_MARKET, StopPrice: dec("108"), Quantity: *dec("1")},
+	})
+
+	if len(engine.Groups) != 0 || len(engine.Locks) != 0 {
+		t.Errorf("left %d groups and %d locks", len(engine.Groups), len(engine.Locks))
+	}
+	checkBalance(t, engine, trader, "USD", "1099.8", "0")
+	engine.FlushFundsEvents()
+	sent := pushed()
+
+	engine.Journal.Close()
+	replayed := openTestEngine(t, dir)
+	if len(replayed.Groups) != 0 || len(replayed.Locks) != 0 || len(userOrders(replayed, trader)) != 0 {
+		t.Errorf("replay left %d groups, %d locks and %d orders", len(replayed.Groups), len(replayed.Locks), len(userOrders(replayed, trader)))
+	}
+	replayed.FlushFundsEvents()
+	if resent := pushed(); fmt.Sprintf("%s", resent) != fmt.Sprintf("%s", sent) {
+		t.Errorf("replay sent different funds events\n got: %s\nwant: %s", resent, sent)
+	}
+}
+
+func TestFundsEventsFollowTheJournal(t *testing.T) {
+	dir := t.TempDir()
+	seller, buyer := uuid.New(), uuid.New()
+	pushed := captureFundsEvents(t)
+
+	engine := openTestEngine(t, dir)
+	balances := NewBalanceCache()
+	balances.Apply(seller, "BTC", decimal.NewFromInt(1), decimal.Zero)
+	balances.Apply(buyer, "USD", decimal.NewFromInt(100), decimal.Zero)
+	engine.AttachBalances(balances)
+
+	send(engine, "CREATE_ORDER", limitOrder(seller, models.SELL, "100", "1"))
+	send(engine, "CREATE_ORDER", limitOrder(buyer, models.BUY, "100", "1"))
+	engine.FlushFundsEvents()
+	sent := pushed()
+
+	// Each order's lock, then the trade with both sides' settlement
+	want := []struct {
+		sequence, index uint64
+		trade           bool
+	}{
+		{1, 1, false},
+		{2, 1, false},
+		{2, 2, true},
+	}
+
+	if len(sent) != len(want) {
+		t.Fatalf("got %d funds events, want %d", len(sent), len(want))
+	}
+	for i, data := range sent {
+		var event messages.FundsEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Journal != "BTC_USD" || event.Sequence != want[i].sequence || event.Index != want[i].index {
+			t.Errorf("event %d numbered %s/%d/%d, want BTC_USD/%d/%d", i, event.Journal, event.Sequence, event.Index, want[i].sequence, want[i].index)
+		}
+		if trade := event.Trade != nil && event.Settlement != nil && event.Settlement.Buyer != nil && event.Settlement.Seller != nil; trade != want[i].trade {
+			t.Errorf("event %d: settled trade %v, want %v", i, trade, want[i].trade)
+		}
+	}
+
+	// Replaying the journal sends the same events again, which the database's
+	// cursor skips if it already has them
+	engine.Journal.Close()
+	replayed := openTestEngine(t, dir)
+	replayed.FlushFundsEvents()
+	if resent := pushed(); fmt.Sprintf("%s", resent) != fmt.Sprintf("%s", sent) {
+		t.Errorf("replay sent different funds events\n got: %s\nwant: %s", resent, sent)
+	}
+}
+
+func TestSnapshotWaitsForFundsEvents(t *testing.T) {
+	dir := t.TempDir()
+	pushed := captureFundsEvents(t)
+
+	// Redis is down for the first two attempts
+	capture := pushFundsEvent
+	failures := 2
+	pushFundsEvent = func(b *broker.Broker, data []byte) error {
+		if failures > 0 {
+			failures--
+			return errors.New("connection refused")
+		}
+		return capture(b, data)
+	}
+
+	engine := openTestEngine(t, dir)
+	trade(t, engine, "100")
+	if _, err := engine.TakeSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The orders won't be replayed after the snapshot, so their events must be out
+	if sent := pushed(); len(sent) != 3 {
+		t.Fatalf("got %d funds events pushed by the snapshot, want both locks and the trade", len(sent))
+	}
+
+	// Nothing is left to send on restart
+	engine.Journal.Close()
+	openTestEngine(t, dir).FlushFundsEvents()
+	if sent := pushed(); len(sent) != 0 {
+		t.Errorf("restart sent %d funds events the snapshot covers", len(sent))
+	}
+}
@@ -0,0 +1,459 @@
+package engine
+
+import (
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Reasons set on orders cancelled by their group
+const (
+	reasonSiblingFilled    = "GROUP_SIBLING_FILLED"
+	reasonSiblingCancelled = "GROUP_SIBLING_CANCELLED"
+	reasonEntryNotFilled   = "GROUP_ENTRY_NOT_FILLED"
+)
+
+// ErrLegHeld is returned for amends of bracket legs still waiting for their
+// entry's first fill
+var ErrLegHeld = errors.New("bracket legs cannot be amended before their entry fills")
+
+// OrderGroupState is the engine's live view of an OCO or bracket group. Bracket
+// legs are held here, outside any book, until the entry order first fills.
+type OrderGroupState struct {
+	Sequence   uint64 // Of the command that created the group, which orders groups as they were placed
+	Group      *models.OrderGroup
+	Entry      *models.Order
+	TakeProfit *models.Order
+	StopLoss   *models.Order
+
+	// The quantities the legs were placed with. Bracket legs never cover more
+	// than the entry's position, and grow with it up to these.
+	TakeProfitQuantity decimal.Decimal
+	StopLossQuantity   decimal.Decimal
+
+	// What the entry's trades gave the user to close: the base bought net of the
+	// buyer fee for a buy entry, the base sold for a sell entry
+	Position decimal.Decimal
+}
+
+func (g *OrderGroupState) orders() []models.Order {
+	orders := []models.Order{}
+	for _, order := range []*models.Order{g.Entry, g.TakeProfit, g.StopLoss} {
+		if order != nil {
+			orders = append(orders, *order)
+		}
+	}
+	return orders
+}
+
+// CreateOrderGroup validates and places an OCO or bracket group
+func (e *Engine) CreateOrderGroup(req messages.OrderGroupRequest) *messages.OrderGroupResponse {
+	if message := validateOrderGroup(req); message != "" {
+		return &messages.OrderGroupResponse{Success: false, Message: message}
+	}
+
+	if reason := e.marketUnavailable(req.MarketID); reason != "" {
+		return &messages.OrderGroupResponse{Success: false, Message: reason}
+	}
+	if reason := e.admitGroup(req.MarketID); reason != "" {
+		return &messages.OrderGroupResponse{Success: false, Message: reason}
+	}
+
+	orderbook, err := e.FindOrCreateOrderbook(req.MarketID)
+	if err != nil {
+		return &messages.OrderGroupResponse{Success: false, Message: err.Error()}
+	}
+
+	now := e.Clock.Now()
+	group := &models.OrderGroup{
+		ID:        e.Clock.NewID(),
+		UserID:    req.UserID,
+		MarketID:  req.MarketID,
+		Type:      models.OCO,
+		Status:    models.GROUP_PENDING,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	state := &OrderGroupState{
+		Sequence:   e.Clock.Sequence(),
+		Group:      group,
+		TakeProfit: e.newGroupOrder(req, req.TakeProfit, group.ID),
+		StopLoss:   e.newGroupOrder(req, req.StopLoss, group.ID),
+	}
+	group.TakeProfitOrderID = state.TakeProfit.ID
+	group.StopLossOrderID = state.StopLoss.ID
+	group.TakeProfitQuantity = state.TakeProfit.Quantity
+	group.StopLossQuantity = state.StopLoss.Quantity
+	state.TakeProfitQuantity = state.TakeProfit.Quantity
+	state.StopLossQuantity = state.StopLoss.Quantity
+
+	if req.Entry != nil {
+		state.Entry = e.newGroupOrder(req, *req.Entry, group.ID)
+		group.Type = models.BRACKET
+		group.ParentOrderID = &state.Entry.ID
+	}
+
+	// A leg the market would reject must not leave the rest of the group unprotected
+	for _, order := range state.orders() {
+		if reason := e.checkTradingRules(orderbook, &order); reason != "" {
+			return &messages.OrderGroupResponse{Success: false, Message: reason}
+		}
+	}
+
+	e.Groups[group.ID] = state
+	e.EmitGroupEvent("GROUP_PLACED", group)
+
+	// Held legs are stored, looked up and cancelled like any other open order
+	if state.Entry != nil {
+		e.EmitOrderEvent("ORDER_PLACED", group.MarketID, state.TakeProfit)
+		e.EmitOrderEvent("ORDER_PLACED", group.MarketID, state.StopLoss)
+	}
+
+	log.Printf("🔗 %s group %s created for user %s in %s", group.Type, group.ID.String(), req.UserID.String(), req.MarketID)
+
+	if state.Entry != nil {
+		// The legs are placed by syncOrderGroup once the entry starts filling
+		e.submitOrder(orderbook, state.Entry)
+	} else {
+		e.activateGroup(state)
+	}
+
+	return &messages.OrderGroupResponse{
+		Success: true,
+		Message: "Order group placed",
+		Group:   *group,
+		Orders:  state.orders(),
+	}
+}
+
+// validateOrderGroup returns a message describing what is wrong with the request,
+// or an empty string if the group can be placed
+func validateOrderGroup(req messages.OrderGroupRequest) string {
+	if req.TakeProfit.Type != models.LIMIT {
+		return "Take-profit leg must be a LIMIT order"
+	}
+	if !req.StopLoss.Type.IsStop() {
+		return "Stop-loss leg must be a STOP_MARKET, STOP_LIMIT or TRAILING_STOP order"
+	}
+	if req.TakeProfit.Side != req.StopLoss.Side {
+		return "Take-profit and stop-loss must be on the same side"
+	}
+	if req.Entry != nil {
+		if req.Entry.Type.IsStop() {
+			return "Entry order must be a MARKET or LIMIT order"
+		}
+		if req.Entry.Side == req.TakeProfit.Side {
+			return "Entry order must be on the opposite side to its take-profit and stop-loss"
+		}
+	}
+	return ""
+}
+
+func (e *Engine) newGroupOrder(req messages.OrderGroupRequest, orderRequest messages.OrderRequest, groupID uuid.UUID) *models.Order {
+	orderRequest.UserID = req.UserID
+	orderRequest.MarketID = req.MarketID
+
+	order := e.newOrder(orderRequest)
+	order.GroupID = &groupID
+	return order
+}
+
+// activateGroup places both legs of a group. The stop-loss goes first so that a
+// take-profit filling on arrival still finds a sibling to cancel.
+func (e *Engine) activateGroup(state *OrderGroupState) {
+	orderbook, _ := e.FindOrCreateOrderbook(state.Group.MarketID)
+
+	e.updateGroupStatus(state, models.GROUP_ACTIVE)
+
+	e.submitOrder(orderbook, state.StopLoss)
+	if state.Group.Status != models.GROUP_ACTIVE {
+		return
+	}
+
+	e.submitOrder(orderbook, state.TakeProfit)
+}
+
+// syncOrderGroup is called whenever an order's state changes and applies the
+// group rules: fills of the entry place and grow the legs, a fill or cancel on
+// one leg cancels the other
+func (e *Engine) syncOrderGroup(order *models.Order) {
+	if order.GroupID == nil {
+		return
+	}
+
+	state, exists := e.Groups[*order.GroupID]
+	if !exists {
+		return
+	}
+
+	if state.Entry != nil && order.ID == state.Entry.ID {
+		e.onGroupEntryUpdated(state)
+		return
+	}
+
+	// A held leg can only close, when it is cancelled, which ends the group
+	if state.Group.Status == models.GROUP_ACTIVE || state.Group.Status == models.GROUP_PENDING {
+		e.onGroupLegUpdated(state, order)
+	}
+}
+
+// onGroupEntryUpdated places a bracket's legs with the entry's first fill, so
+// what it bought is protected while the rest of the entry still rests, and grows
+// them with every fill after that. Legs too small for the market's rules wait for
+// more fills, or for the entry to close.
+func (e *Engine) onGroupEntryUpdated(state *OrderGroupState) {
+	entry := state.Entry
+
+	switch state.Group.Status {
+	case models.GROUP_PENDING:
+		if state.Position.IsPositive() {
+			if !isClosed(entry.Status) && !e.groupLegsTradable(state) {
+				return
+			}
+			for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+				leg.Quantity = e.coveredQuantity(state, leg)
+				leg.RemainingQuantity = leg.Quantity
+			}
+			e.activateGroup(state)
+			return
+		}
+
+		if !isClosed(entry.Status) {
+			return
+		}
+
+		// Nothing filled, so the legs are never placed
+		for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+			e.closeUnplacedLeg(leg, reasonEntryNotFilled)
+		}
+		e.updateGroupStatus(state, models.GROUP_CANCELLED)
+
+	case models.GROUP_ACTIVE:
+		e.growGroupLegs(state)
+	}
+}
+
+// recordEntryTrade adds a trade of a bracket entry to the group's position
+func (e *Engine) recordEntryTrade(order *models.Order, trade models.Trade) {
+	if order == nil || order.GroupID == nil {
+		return
+	}
+	state, exists := e.Groups[*order.GroupID]
+	if !exists || state.Entry == nil || state.Entry.ID != order.ID {
+		return
+	}
+
+	// Buyers pay their fee in the base asset, so the legs can't sell that part
+	quantity := trade.Quantity
+	if order.Side == models.BUY {
+		quantity = quantity.Sub(feeOf(trade.BuyerFee))
+	}
+	state.Position = state.Position.Add(quantity)
+}
+
+// coveredQuantity is how much of a bracket leg the entry's position covers, in
+// whole steps of the market
+func (e *Engine) coveredQuantity(state *OrderGroupState, leg *models.Order) decimal.Decimal {
+	requested := state.TakeProfitQuantity
+	if leg.ID == state.StopLoss.ID {
+		requested = state.StopLossQuantity
+	}
+	return decimal.Min(requested, e.marketRules(state.Group.MarketID).RoundQuantity(state.Position))
+}
+
+// groupLegsTradable reports whether both legs, cut to the entry's position, pass
+// the market's rules
+func (e *Engine) groupLegsTradable(state *OrderGroupState) bool {
+	orderbook, _ := e.FindOrCreateOrderbook(state.Group.MarketID)
+
+	for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+		covered := *leg
+		covered.Quantity = e.coveredQuantity(state, leg)
+		covered.RemainingQuantity = covered.Quantity
+		if e.checkTradingRules(orderbook, &covered) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// growGroupLegs brings working bracket legs up to the entry's position since they
+// were placed. The entry's trades have already added to the group's lock, so a
+// take-profit that trades as it grows is paid from it; legs that would need more
+// than the lock holds stay as they are. A stop-loss that has not triggered grows
+// in place; a resting leg is amended and goes to the back of its price level.
+func (e *Engine) growGroupLegs(state *OrderGroupState) {
+	orderbook, _ := e.FindOrCreateOrderbook(state.Group.MarketID)
+	market := orderbook.GetTicker()
+
+	takeProfit, stopLoss := *state.TakeProfit, *state.StopLoss
+	for _, leg := range []*models.Order{&takeProfit, &stopLoss} {
+		leg.Quantity = decimal.Max(leg.Quantity, e.coveredQuantity(state, leg))
+		leg.RemainingQuantity = leg.Quantity.Sub(leg.FilledQuantity)
+	}
+	if takeProfit.Quantity.Equal(state.TakeProfit.Quantity) && stopLoss.Quantity.Equal(state.StopLoss.Quantity) {
+		return
+	}
+
+	if lock, exists := e.Locks[state.Group.ID]; exists {
+		more := decimal.Max(fundsRequired(orderbook, &takeProfit), fundsRequired(orderbook, &stopLoss)).Sub(lock.Amount)
+		if more.IsPositive() {
+			log.Printf("⛔ Group %s legs not grown: %s", state.Group.ID.String(), reasonInsufficientFunds)
+			return
+		}
+	}
+
+	for _, grown := range []*models.Order{&stopLoss, &takeProfit} {
+		leg := state.StopLoss
+		if grown.ID == state.TakeProfit.ID {
+			leg = state.TakeProfit
+		}
+		if state.Group.Status != models.GROUP_ACTIVE || grown.Quantity.Equal(leg.Quantity) {
+			continue
+		}
+
+		log.Printf("🔗 Group %s leg %s grown from %s to %s", state.Group.ID.String(), leg.ID.String(), leg.Quantity.String(), grown.Quantity.String())
+
+		if leg.Type.IsStop() {
+			leg.Quantity = grown.Quantity
+			leg.RemainingQuantity = grown.RemainingQuantity
+			leg.UpdatedAt = e.Clock.Now()
+			e.EmitOrderEvent("ORDER_UPDATED", market, leg)
+			continue
+		}
+
+		result, err := orderbook.ModifyOrder(leg.ID, leg.UserID, nil, &grown.Quantity)
+		if err != nil {
+			log.Printf("❌ Group %s leg %s could not be grown: %v", state.Group.ID.String(), leg.ID.String(), err)
+			continue
+		}
+		e.emitMatchingResult(market, result, "ORDER_UPDATED")
+		if len(result.GeneratedTrades) > 0 {
+			e.fireTriggeredOrders(orderbook, result.GeneratedTrades)
+		}
+	}
+}
+
+func (e *Engine) onGroupLegUpdated(state *OrderGroupState, leg *models.Order) {
+	traded := leg.FilledQuantity.GreaterThan(decimal.Zero)
+	if !traded && !isClosed(leg.Status) {
+		return
+	}
+
+	sibling := state.StopLoss
+	if leg.ID == state.StopLoss.ID {
+		sibling = state.TakeProfit
+	}
+
+	reason := reasonSiblingCancelled
+	status := models.GROUP_CANCELLED
+	if traded {
+		reason = reasonSiblingFilled
+		status = models.GROUP_COMPLETED
+	}
+
+	// Update the group first so the sibling's own cancellation is not handled again
+	e.updateGroupStatus(state, status)
+
+	orderbook, _ := e.FindOrCreateOrderbook(state.Group.MarketID)
+
+	// A bracket whose exit has traded or gone must not keep adding to the position
+	if entry := state.Entry; entry != nil && !isClosed(entry.Status) {
+		e.removeOpenOrder(orderbook, entry.ID, entry.UserID, reason)
+	}
+
+	if isClosed(sibling.Status) {
+		return
+	}
+
+	if _, found := e.removeOpenOrder(orderbook, sibling.ID, sibling.UserID, reason); !found {
+		// The sibling was never placed (e.g. the stop-loss was rejected)
+		e.closeUnplacedLeg(sibling, reason)
+	}
+}
+
+// closeUnplacedLeg cancels a leg that never reached a book, e.g. one held back
+// until its entry filled
+func (e *Engine) closeUnplacedLeg(leg *models.Order, reason string) {
+	leg.Status = models.CANCELLED
+	leg.StatusReason = reason
+	leg.UpdatedAt = e.Clock.Now()
+	e.EmitOrderEvent("ORDER_UPDATED", leg.MarketID, leg)
+}
+
+// heldLeg returns the group of a bracket leg that is held back until its entry
+// first fills
+func (e *Engine) heldLeg(order *models.Order) (*OrderGroupState, bool) {
+	if order.GroupID == nil {
+		return nil, false
+	}
+	state, exists := e.Groups[*order.GroupID]
+	if !exists || state.Group.Status != models.GROUP_PENDING || state.Entry == nil || order.ID == state.Entry.ID {
+		return nil, false
+	}
+	return state, true
+}
+
+// removeHeldLeg takes one of the user's held bracket legs out of its group to be
+// cancelled, which cancels the rest of the group with it
+func (e *Engine) removeHeldLeg(orderID uuid.UUID, userID uuid.UUID) (*models.Order, bool) {
+	entry, found := e.lookupOrder(orderID, userID)
+	if !found {
+		return nil, false
+	}
+	if _, held := e.heldLeg(entry.order); !held {
+		return nil, false
+	}
+	return entry.order, true
+}
+
+// updateGroupStatus records a group transition, persists it and forgets groups
+// that have nothing left to do
+func (e *Engine) updateGroupStatus(state *OrderGroupState, status models.OrderGroupStatus) {
+	state.Group.Status = status
+	state.Group.UpdatedAt = e.Clock.Now()
+
+	log.Printf("🔗 Group %s is now %s", state.Group.ID.String(), status)
+	e.EmitGroupEvent("GROUP_UPDATED", state.Group)
+
+	if status == models.GROUP_COMPLETED || status == models.GROUP_CANCELLED {
+		delete(e.Groups, state.Group.ID)
+	}
+}
+
+// heldGroupOrders lists bracket legs still waiting for their entry's first fill,
+// in the order their groups were placed
+func (e *Engine) heldGroupOrders(userID uuid.UUID, market string) []models.Order {
+	groups := make([]*OrderGroupState, 0, len(e.Groups))
+	for _, state := range e.Groups {
+		groups = append(groups, state)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Sequence != groups[j].Sequence {
+			return groups[i].Sequence < groups[j].Sequence
+		}
+		return groups[i].Group.ID.String() < groups[j].Group.ID.String()
+	})
+
+	held := []models.Order{}
+	for _, state := range groups {
+		if state.Group.UserID != userID || state.Group.Status != models.GROUP_PENDING {
+			continue
+		}
+		if market != "" && state.Group.MarketID != market {
+			continue
+		}
+		held = append(held, *state.TakeProfit, *state.StopLoss)
+	}
+	return held
+}
+
+func isClosed(status models.OrderStatus) bool {
+	return status == models.FILLED || status == models.CANCELLED || status == models.REJECTED || status == models.EXPIRED
+}
@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// sellGroup is a request to protect a long position of quantity with a
+// take-profit at 110 and a stop-loss at 90. An entry price makes it a bracket.
+func sellGroup(userID uuid.UUID, entryPrice, quantity string) messages.OrderGroupRequest {
+	request := messages.OrderGroupRequest{
+		UserID:     userID,
+		MarketID:   testMarket,
+		TakeProfit: limitOrder(userID, models.SELL, "110", quantity),
+		StopLoss:   stopOrder(userID, models.SELL, "90", "", quantity),
+	}
+	if entryPrice != "" {
+		entry := limitOrder(userID, models.BUY, entryPrice, quantity)
+		request.Entry = &entry
+	}
+	return request
+}
+
+func placeGroup(t *testing.T, engine *Engine, request messages.OrderGroupRequest) *OrderGroupState {
+	t.Helper()
+	if err := engine.Record(&messages.MessageFromAPI{MessageType: "CREATE_ORDER_GROUP", Data: request}); err != nil {
+		t.Fatal(err)
+	}
+	response := engine.CreateOrderGroup(request)
+	if !response.Success {
+		t.Fatalf("order group refused: %s", response.Message)
+	}
+	return engine.Groups[response.Group.ID]
+}
+
+func TestOCOGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		act         func(t *testing.T, engine *Engine, state *OrderGroupState)
+		takeProfit  models.OrderStatus
+		stopLoss    models.OrderStatus
+		reason      string
+		groupStatus models.OrderGroupStatus
+	}{
+		{
+			name: "take-profit fill cancels the stop-loss",
+			act: func(t *testing.T, engine *Engine, state *OrderGroupState) {
+				placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "110", "1"))
+			},
+			takeProfit:  models.FILLED,
+			stopLoss:    models.CANCELLED,
+			reason:      reasonSiblingFilled,
+			groupStatus: models.GROUP_COMPLETED,
+		},
+		{
+			name: "stop-loss firing cancels the take-profit",
+			act: func(t *testing.T, engine *Engine, state *OrderGroupState) {
+				maker := uuid.New()
+				placeOrder(t, engine, limitOrder(maker, models.BUY, "90", "1"))
+				placeOrder(t, engine, limitOrder(maker, models.BUY, "89", "1"))
+				placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "90", "1"))
+			},
+			takeProfit:  models.CANCELLED,
+			stopLoss:    models.FILLED,
+			reason:      reasonSiblingFilled,
+			groupStatus: models.GROUP_COMPLETED,
+		},
+		{
+			name: "cancelling a leg cancels its sibling",
+			act: func(t *testing.T, engine *Engine, state *OrderGroupState) {
+				engine.CancelOrder(messages.CancelOrderRequest{UserID: state.Group.UserID, OrderID: state.TakeProfit.ID.String()})
+			},
+			takeProfit:  models.CANCELLED,
+			stopLoss:    models.CANCELLED,
+			reason:      reasonSiblingCancelled,
+			groupStatus: models.GROUP_CANCELLED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			state := placeGroup(t, engine, sellGroup(uuid.New(), "", "1"))
+			if state.Group.Status != models.GROUP_ACTIVE {
+				t.Fatalf("group: got %s, want ACTIVE", state.Group.Status)
+			}
+
+			tt.act(t, engine, state)
+
+			if state.TakeProfit.Status != tt.takeProfit || state.StopLoss.Status != tt.stopLoss {
+				t.Errorf("legs: got %s and %s, want %s and %s", state.TakeProfit.Status, state.StopLoss.Status, tt.takeProfit, tt.stopLoss)
+			}
+			cancelled := state.StopLoss
+			if tt.stopLoss != models.CANCELLED {
+				cancelled = state.TakeProfit
+			}
+			if cancelled.StatusReason != tt.reason {
+				t.Errorf("reason: got %s, want %s", cancelled.StatusReason, tt.reason)
+			}
+			if state.Group.Status != tt.groupStatus {
+				t.Errorf("group: got %s, want %s", state.Group.Status, tt.groupStatus)
+			}
+			if _, live := engine.Groups[state.Group.ID]; live {
+				t.Error("closed group is still tracked")
+			}
+		})
+	}
+}
+
+func TestBracketGroup(t *testing.T) {
+	t.Run("legs are held until the entry fills", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "1"))
+
+		if state.Group.Status != models.GROUP_PENDING {
+			t.Fatalf("group: got %s, want PENDING", state.Group.Status)
+		}
+		if asks := engine.Orderbooks[0].Asks.Len(); asks != 0 {
+			t.Errorf("take-profit was placed before the entry filled: %d asks", asks)
+		}
+		if stops := len(engine.triggerBook(testMarket).Orders); stops != 0 {
+			t.Errorf("stop-loss was placed before the entry filled: %d stops", stops)
+		}
+		if open, _ := engine.GetOpenOrders(user, testMarket); len(open) != 3 {
+			t.Errorf("got %d open orders, want the entry and both held legs", len(open))
+		}
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+
+		if state.Group.Status != models.GROUP_ACTIVE {
+			t.Fatalf("group: got %s, want ACTIVE", state.Group.Status)
+		}
+		if asks := engine.Orderbooks[0].Asks.Len(); asks != 1 {
+			t.Errorf("got %d asks, want the take-profit", asks)
+		}
+		if stops := len(engine.triggerBook(testMarket).Orders); stops != 1 {
+			t.Errorf("got %d stops, want the stop-loss", stops)
+		}
+	})
+
+	t.Run("legs go out with the entry's first fill and grow with later ones", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "3"))
+
+		checkLegs := func(quantity string) {
+			t.Helper()
+			for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+				if !leg.Quantity.Equal(decimal.RequireFromString(quantity)) || !leg.RemainingQuantity.Equal(leg.Quantity) {
+					t.Errorf("%s leg: got %s with %s remaining, want %s", leg.Type, leg.Quantity, leg.RemainingQuantity, quantity)
+				}
+			}
+		}
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+		if state.Group.Status != models.GROUP_ACTIVE || state.Entry.Status != models.PARTIAL {
+			t.Fatalf("after the first fill: group %s, entry %s, want ACTIVE and PARTIAL", state.Group.Status, state.Entry.Status)
+		}
+		if asks, stops := engine.Orderbooks[0].Asks.Len(), len(engine.triggerBook(testMarket).Orders); asks != 1 || stops != 1 {
+			t.Errorf("got %d asks and %d stops, want both legs placed", asks, stops)
+		}
+		// The entry rests, so it pays the 0.1% maker fee out of the base it buys
+		checkLegs("0.999")
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1.5"))
+		checkLegs("2.4975")
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+		if state.Entry.Status != models.FILLED {
+			t.Errorf("entry: got %s, want FILLED", state.Entry.Status)
+		}
+		checkLegs("2.997")
+	})
+
+	t.Run("legs keep what filled when the entry closes early", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "3"))
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+		engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: state.Entry.ID.String()})
+
+		if state.Group.Status != models.GROUP_ACTIVE {
+			t.Fatalf("group: got %s, want ACTIVE", state.Group.Status)
+		}
+		for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+			if !leg.Quantity.Equal(decimal.RequireFromString("0.999")) {
+				t.Errorf("%s leg: got quantity %s, want 0.999", leg.Type, leg.Quantity)
+			}
+		}
+	})
+
+	t.Run("rest of the entry is cancelled once a leg trades", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "3"))
+
+		placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+		placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "110", "1"))
+
+		if state.TakeProfit.Status != models.FILLED || state.Entry.Status != models.CANCELLED {
+			t.Errorf("got take-profit %s and entry %s, want FILLED and CANCELLED", state.TakeProfit.Status, state.Entry.Status)
+		}
+		if state.Group.Status != models.GROUP_COMPLETED {
+			t.Errorf("group: got %s, want COMPLETED", state.Group.Status)
+		}
+	})
+
+	t.Run("legs are cancelled when the entry closes with nothing filled", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "1"))
+
+		engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: state.Entry.ID.String()})
+
+		for _, leg := range []*models.Order{state.TakeProfit, state.StopLoss} {
+			if leg.Status != models.CANCELLED || leg.StatusReason != reasonEntryNotFilled {
+				t.Errorf("%s leg: got %s (%s), want CANCELLED (%s)", leg.Type, leg.Status, leg.StatusReason, reasonEntryNotFilled)
+			}
+		}
+		if state.Group.Status != models.GROUP_CANCELLED {
+			t.Errorf("group: got %s, want CANCELLED", state.Group.Status)
+		}
+		if len(engine.OrderIndex) != 0 {
+			t.Errorf("%d orders left in the index", len(engine.OrderIndex))
+		}
+	})
+
+	t.Run("held legs are indexed and listed in the order their groups were placed", func(t *testing.T) {
+		dir := t.TempDir()
+		engine := openTestEngine(t, dir)
+		user := uuid.New()
+
+		held := []uuid.UUID{}
+		for i := 0; i < 5; i++ {
+			state := placeGroup(t, engine, sellGroup(user, "100", "1"))
+			held = append(held, state.TakeProfit.ID, state.StopLoss.ID)
+		}
+
+		checkHeld := func(engine *Engine) {
+			t.Helper()
+			for attempt := 0; attempt < 5; attempt++ {
+				listed := engine.heldGroupOrders(user, testMarket)
+				if len(listed) != len(held) {
+					t.Fatalf("got %d held legs, want %d", len(listed), len(held))
+				}
+				for i, leg := range listed {
+					if leg.ID != held[i] {
+						t.Fatalf("held leg %d: got %s, want %s", i, leg.ID, held[i])
+					}
+				}
+			}
+			for _, legID := range held {
+				if _, found := engine.GetOrder(legID, user); !found {
+					t.Errorf("held leg %s is not in the order index", legID)
+				}
+			}
+		}
+		checkHeld(engine)
+
+		// The index is rebuilt with them from a snapshot
+		if _, err := engine.TakeSnapshot(); err != nil {
+			t.Fatal(err)
+		}
+		engine.Journal.Close()
+		checkHeld(openTestEngine(t, dir))
+	})
+
+	t.Run("cancelling a held leg cancels its group", func(t *testing.T) {
+		engine := newTestEngine(t)
+		user := uuid.New()
+		state := placeGroup(t, engine, sellGroup(user, "100", "1"))
+
+		_, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: user, OrderID: state.TakeProfit.ID.String(), Price: dec("115")})
+		if err != ErrLegHeld {
+			t.Errorf("amend of a held leg: got %v, want %v", err, ErrLegHeld)
+		}
+
+		if _, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: state.TakeProfit.ID.String()}); err != nil {
+			t.Fatalf("cancel of a held leg: %v", err)
+		}
+		for _, order := range []*models.Order{state.Entry, state.TakeProfit, state.StopLoss} {
+			if order.Status != models.CANCELLED {
+				t.Errorf("order %s: got %s, want CANCELLED", order.ID, order.Status)
+			}
+		}
+		if state.Group.Status != models.GROUP_CANCELLED {
+			t.Errorf("group: got %s, want CANCELLED", state.Group.Status)
+		}
+		if len(engine.OrderIndex) != 0 {
+			t.Errorf("%d orders left in the index", len(engine.OrderIndex))
+		}
+	})
+}
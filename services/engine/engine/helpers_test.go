@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const testMarket = "BTC/USD"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	// There is no Redis to push funds events to, so snapshots would wait forever
+	pushFundsEvent = func(*broker.Broker, []byte) error { return nil }
+	os.Exit(m.Run())
+}
+
+// captureFundsEvents collects the funds events every engine pushes from now on,
+// in the order they are pushed, until the test ends
+func captureFundsEvents(t *testing.T) func() [][]byte {
+	var mu sync.Mutex
+	pushed := [][]byte{}
+
+	push := pushFundsEvent
+	t.Cleanup(func() { pushFundsEvent = push })
+	pushFundsEvent = func(_ *broker.Broker, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pushed = append(pushed, data)
+		return nil
+	}
+
+	return func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+		events := pushed
+		pushed = [][]byte{}
+		return events
+	}
+}
+
+// openTestEngine opens the engine of testMarket whose journal and snapshot are in
+// dir, recovering whatever they hold. Nothing it publishes needs Redis to arrive.
+func openTestEngine(t *testing.T, dir string) *Engine {
+	t.Helper()
+
+	journal, err := OpenJournal(filepath.Join(dir, "BTC_USD.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { journal.Close() })
+
+	market := MarketFromModel(DefaultMarkets[0])
+	engine, err := NewEngine(broker.NewRedisClient(), []Market{market}, journal, filepath.Join(dir, "BTC_USD.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every funds event is pushed before the next test, so none turns up in another's
+	t.Cleanup(engine.FlushFundsEvents)
+	return engine
+}
+
+// newTestEngine is an engine with no orders and a journal of its own
+func newTestEngine(t *testing.T) *Engine {
+	return openTestEngine(t, t.TempDir())
+}
+
+// fundedEngine is a new engine that checks orders against balances, which start
+// out with what funds gives each user
+func fundedEngine(t *testing.T, funds map[uuid.UUID]map[string]string) *Engine {
+	engine := newTestEngine(t)
+	balances := NewBalanceCache()
+	for userID, assets := range funds {
+		for asset, amount := range assets {
+			balances.Apply(userID, asset, decimal.RequireFromString(amount), decimal.Zero)
+		}
+	}
+	engine.AttachBalances(balances)
+	return engine
+}
+
+// send gives the engine a command as the API would
+func send(engine *Engine, messageType string, data interface{}) {
+	engine.Consume(&messages.MessageFromAPI{MessageType: messageType, Data: data})
+}
+
+// limitOrder is a request for a limit order on testMarket
+func limitOrder(userID uuid.UUID, side models.OrderSide, price, quantity string) messages.OrderRequest {
+	return messages.OrderRequest{
+		UserID:   userID,
+		MarketID: testMarket,
+		Side:     side,
+		Type:     models.LIMIT,
+		Price:    dec(price),
+		Quantity: *dec(quantity),
+	}
+}
+
+// placeOrder journals and creates an order, failing the test if the engine returns an error
+func placeOrder(t *testing.T, engine *Engine, request messages.OrderRequest) *models.Order {
+	t.Helper()
+	if err := engine.Record(&messages.MessageFromAPI{MessageType: "CREATE_ORDER", Data: request}); err != nil {
+		t.Fatal(err)
+	}
+	order, err := engine.CreateOrder(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// stopOrder is a request for a stop order on testMarket. A limit price makes it a
+// stop-limit order.
+func stopOrder(userID uuid.UUID, side models.OrderSide, stopPrice, price, quantity string) messages.OrderRequest {
+	request := messages.OrderRequest{
+		UserID:    userID,
+		MarketID:  testMarket,
+		Side:      side,
+		Type:      models.STOP_MARKET,
+		StopPrice: dec(stopPrice),
+		Quantity:  *dec(quantity),
+	}
+	if price != "" {
+		request.Type, request.Price = models.STOP_LIMIT, dec(price)
+	}
+	return request
+}
+
+// trade crosses two fresh orders at price so that the market last trades there
+func trade(t *testing.T, engine *Engine, price string) {
+	t.Helper()
+	placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, price, "1"))
+	placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, price, "1"))
+}
+
+// userOrders returns a user's live orders
+func userOrders(engine *Engine, userID uuid.UUID) []*models.Order {
+	orders := []*models.Order{}
+	for _, entry := range engine.OrderIndex {
+		if entry.order.UserID == userID {
+			orders = append(orders, entry.order)
+		}
+	}
+	return orders
+}
+
+func dec(value string) *decimal.Decimal {
+	d := decimal.RequireFromString(value)
+	return &d
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"sync"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+// indexedOrder is where a live order can be found: the order itself and the book
+// of its market. The order may be resting, waiting in the trigger book or held
+// back as a bracket leg.
+type indexedOrder struct {
+	order     *models.Order
+	orderbook *orderbook.OrderBook
+}
+
+// updateOrderIndex records an order's latest state in the engine-wide index.
+// Every state change is emitted through EmitOrderEvent, which calls this, so open
+// orders are indexed and closed ones dropped without the matching code knowing.
+func (e *Engine) updateOrderIndex(order *models.Order) {
+	if isClosed(order.Status) {
+		delete(e.OrderIndex, order.ID)
+		if e.Directory != nil {
+			e.Directory.Delete(order.ID)
+		}
+		return
+	}
+
+	if entry, exists := e.OrderIndex[order.ID]; exists && entry.order == order {
+		return
+	}
+
+	ob, err := e.FindOrderbook(order.MarketID)
+	if err != nil {
+		return
+	}
+	e.OrderIndex[order.ID] = indexedOrder{order: order, orderbook: ob}
+	if e.Directory != nil {
+		e.Directory.Set(order.ID, order.MarketID)
+	}
+}
+
+// lookupOrder finds one of the user's live orders by ID
+func (e *Engine) lookupOrder(orderID uuid.UUID, userID uuid.UUID) (indexedOrder, bool) {
+	entry, exists := e.OrderIndex[orderID]
+	if !exists || entry.order.UserID != userID {
+		return indexedOrder{}, false
+	}
+	return entry, true
+}
+
+// GetOrder returns a snapshot of one of the user's live orders
+func (e *Engine) GetOrder(orderID uuid.UUID, userID uuid.UUID) (*models.Order, bool) {
+	entry, found := e.lookupOrder(orderID, userID)
+	if !found {
+		return nil, false
+	}
+
+	order := *entry.order
+	return &order, true
+}
+
+// OrderDirectory maps every live order ID to the market that owns it. It is the
+// only state the market workers share, so unlike the rest of the engine it is
+// safe for concurrent use.
+type OrderDirectory struct {
+	mu      sync.RWMutex
+	markets map[uuid.UUID]string
+}
+
+func NewOrderDirectory() *OrderDirectory {
+	return &OrderDirectory{markets: make(map[uuid.UUID]string)}
+}
+
+func (d *OrderDirectory) Set(orderID uuid.UUID, market string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.markets[orderID] = market
+}
+
+func (d *OrderDirectory) Delete(orderID uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.markets, orderID)
+}
+
+// Market returns the market of a live order
+func (d *OrderDirectory) Market(orderID uuid.UUID) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	market, exists := d.markets[orderID]
+	return market, exists
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/google/uuid"
+)
+
+// JournalEntry is one accepted command as written to the journal. The engine
+// applies it with the entry's sequence and timestamp, which is what makes a replay
+// produce the same orders, trades and IDs as the original run.
+type JournalEntry struct {
+	Sequence  uint64                   `json:"seq"`
+	Timestamp time.Time                `json:"ts"`
+	Message   *messages.MessageFromAPI `json:"message"`
+}
+
+// Journal is an append-only file of every command that changes an engine's state,
+// one JSON entry per line. Commands are written and synced before they are
+// applied, so after a crash replaying the journal rebuilds the books exactly.
+type Journal struct {
+	Name     string // Namespace for the IDs generated while applying its commands
+	path     string
+	file     *os.File
+	sequence uint64
+}
+
+// JournalPath is where the journal of a market worker lives: one file per market
+// under JOURNAL_DIR, ./journal by default
+func JournalPath(market string) string {
+	return filepath.Join(journalDir(), strings.Replace(market, "/", "_", 1)+".journal")
+}
+
+func journalDir() string {
+	if dir := os.Getenv("JOURNAL_DIR"); dir != "" {
+		return dir
+	}
+	return "journal"
+}
+
+// OpenJournal opens a journal for appending, creating it if needed
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		Name: strings.TrimSuffix(filepath.Base(path), ".journal"),
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Replay calls apply for every entry after the given sequence number, in order,
+// and returns how many there were. Entries up to it are already covered by a
+// snapshot. A torn last line, left by a crash in the middle of a write, is cut
+// off; that command was never applied. Any other damage stops the replay with an error.
+func (j *Journal) Replay(after uint64, apply func(entry JournalEntry)) (int, error) {
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	j.sequence = after
+	reader := bufio.NewReader(j.file)
+	var offset int64
+	replayed := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return replayed, j.truncate(offset)
+			}
+			break
+		}
+		if err != nil {
+			return replayed, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return replayed, fmt.Errorf("%s: corrupt entry at byte %d: %v", j.path, offset, err)
+		}
+		offset += int64(len(line))
+
+		// Left over from a crash between writing a snapshot and truncating the journal
+		if entry.Sequence <= after {
+			continue
+		}
+		if entry.Sequence != j.sequence+1 {
+			return replayed, fmt.Errorf("%s: entry %d follows %d", j.path, entry.Sequence, j.sequence)
+		}
+
+		apply(entry)
+		j.sequence = entry.Sequence
+		replayed++
+	}
+
+	_, err := j.file.Seek(0, io.SeekEnd)
+	return replayed, err
+}
+
+// Sequence is the sequence number of the last entry written or replayed
+func (j *Journal) Sequence() uint64 {
+	return j.sequence
+}
+
+// Reset empties the journal once a snapshot covers all of it. Sequence numbers
+// carry on from where they were.
+func (j *Journal) Reset() error {
+	if err := j.truncate(0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// truncate drops everything after the last complete entry
+func (j *Journal) truncate(offset int64) error {
+	if err := j.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := j.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Append writes a command to the journal and waits until it is on disk
+func (j *Journal) Append(message *messages.MessageFromAPI, now time.Time) (JournalEntry, error) {
+	entry := JournalEntry{
+		Sequence:  j.sequence + 1,
+		Timestamp: now.UTC(),
+		Message:   message,
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return JournalEntry{}, err
+	}
+	if err := j.file.Sync(); err != nil {
+		return JournalEntry{}, err
+	}
+
+	j.sequence = entry.Sequence
+	return entry, nil
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// journalIDNamespace scopes the name-based UUIDs the engine generates
+var journalIDNamespace = uuid.MustParse("6f1c3b0e-2d4a-4e8b-9a57-0c9e8d1f4b23")
+
+// CommandClock is the engine's source of time and IDs. While a command is applied
+// the time is the command's journal timestamp and IDs are derived from the
+// journal name, the command's sequence and a counter, so they come out the same
+// on every replay.
+type CommandClock struct {
+	namespace string
+	now       time.Time
+	sequence  uint64
+	ids       uint64
+	events    uint64
+}
+
+func NewCommandClock(namespace string) *CommandClock {
+	return &CommandClock{namespace: namespace}
+}
+
+// Start moves the clock to a command that is about to be applied
+func (c *CommandClock) Start(entry JournalEntry) {
+	c.now = entry.Timestamp
+	c.sequence = entry.Sequence
+	c.ids = 0
+	c.events = 0
+}
+
+// Sequence is the journal sequence of the command being applied
+func (c *CommandClock) Sequence() uint64 {
+	return c.sequence
+}
+
+func (c *CommandClock) Now() time.Time {
+	return c.now
+}
+
+func (c *CommandClock) NewID() uuid.UUID {
+	c.ids++
+	name := fmt.Sprintf("%s/%d/%d", c.namespace, c.sequence, c.ids)
+	return uuid.NewSHA1(journalIDNamespace, []byte(name))
+}
+
+// NextEvent numbers an event the command sends to the database: the journal, the
+// command's sequence and a counter, which together order every event of the journal
+func (c *CommandClock) NextEvent() (string, uint64, uint64) {
+	c.events++
+	return c.namespace, c.sequence, c.events
+}
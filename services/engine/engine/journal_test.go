@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+// engineState is everything replaying a journal must reproduce, as JSON
+func engineState(t *testing.T, engine *Engine) string {
+	t.Helper()
+
+	ob, err := engine.FindOrderbook(testMarket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth, _ := engine.GetDepth(testMarket)
+
+	orders := map[string]*models.Order{}
+	for id, entry := range engine.OrderIndex {
+		orders[id.String()] = entry.order
+	}
+	stops := engine.triggerBook(testMarket).Orders
+
+	state, err := json.Marshal(map[string]interface{}{
+		"orders":     orders,
+		"stops":      stops,
+		"depth":      depth,
+		"last_price": ob.CurrentPrice,
+		"last_trade": ob.LastTradeId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(state)
+}
+
+func TestJournalReplay(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	tests := []struct {
+		name     string
+		commands func(engine *Engine)
+	}{
+		{
+			name: "resting orders",
+			commands: func(engine *Engine) {
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.SELL, "101", "1"))
+				send(engine, "CREATE_ORDER", limitOrder(bob, models.BUY, "99", "2"))
+			},
+		},
+		{
+			name: "fills, partial fills and a market order",
+			commands: func(engine *Engine) {
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.SELL, "100", "2"))
+				send(engine, "CREATE_ORDER", limitOrder(bob, models.BUY, "101", "0.5"))
+				send(engine, "CREATE_ORDER", messages.OrderRequest{
+					UserID: carol, MarketID: testMarket, Side: models.BUY, Type: models.MARKET, Quantity: *dec("1"),
+				})
+			},
+		},
+		{
+			name: "amends and cancels",
+			commands: func(engine *Engine) {
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.SELL, "102", "1"))
+				send(engine, "CREATE_ORDER", limitOrder(bob, models.BUY, "98", "1"))
+				send(engine, "MODIFY_ORDER", messages.ModifyOrderRequest{
+					UserID: alice, OrderID: userOrders(engine, alice)[0].ID.String(), Price: dec("101.5"),
+				})
+				send(engine, "CANCEL_ORDER", messages.CancelOrderRequest{
+					UserID: bob, OrderID: userOrders(engine, bob)[0].ID.String(),
+				})
+			},
+		},
+		{
+			name: "stop orders triggered by trades",
+			commands: func(engine *Engine) {
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.BUY, "99", "1"))
+				send(engine, "CREATE_ORDER", messages.OrderRequest{
+					UserID: carol, MarketID: testMarket, Side: models.SELL, Type: models.STOP_MARKET, StopPrice: dec("100"), Quantity: *dec("0.5"),
+				})
+				send(engine, "CREATE_ORDER", limitOrder(bob, models.BUY, "100", "1"))
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.SELL, "100", "1"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			original := openTestEngine(t, dir)
+			tt.commands(original)
+			want := engineState(t, original)
+			original.Journal.Close()
+
+			replayed := openTestEngine(t, dir)
+
+			if replayed.Journal.Sequence() != original.Journal.Sequence() {
+				t.Errorf("replayed %d commands, want %d", replayed.Journal.Sequence(), original.Journal.Sequence())
+			}
+			if got := engineState(t, replayed); got != want {
+				t.Errorf("replayed state differs\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestJournalReplayCutsTornEntry(t *testing.T) {
+	dir := t.TempDir()
+	original := openTestEngine(t, dir)
+	send(original, "CREATE_ORDER", limitOrder(uuid.New(), models.BUY, "99", "1"))
+	want := engineState(t, original)
+	original.Journal.Close()
+
+	// A crash in the middle of writing the next command
+	file, err := os.OpenFile(filepath.Join(dir, "BTC_USD.journal"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":2,"ts":`)
+	file.Close()
+
+	replayed := openTestEngine(t, dir)
+	if got := engineState(t, replayed); got != want {
+		t.Errorf("replayed state differs\n got: %s\nwant: %s", got, want)
+	}
+
+	// The journal carries on after the last complete entry
+	send(replayed, "CREATE_ORDER", limitOrder(uuid.New(), models.BUY, "98", "1"))
+	replayed.Journal.Close()
+	if again := openTestEngine(t, dir); again.Journal.Sequence() != 2 || len(again.OrderIndex) != 2 {
+		t.Errorf("got %d commands and %d orders after the torn entry, want 2 and 2", again.Journal.Sequence(), len(again.OrderIndex))
+	}
+}
+
+func TestCommandClock(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		namespace string
+		sequence  uint64
+		same      bool
+	}{
+		{"same journal and command", "BTC_USD", 7, true},
+		{"another command", "BTC_USD", 8, false},
+		{"another journal", "ETH_USD", 7, false},
+	}
+
+	reference := NewCommandClock("BTC_USD")
+	reference.Start(JournalEntry{Sequence: 7, Timestamp: at})
+	first, second := reference.NewID(), reference.NewID()
+	if first == second {
+		t.Fatal("one command got the same ID twice")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewCommandClock(tt.namespace)
+			clock.Start(JournalEntry{Sequence: tt.sequence, Timestamp: at})
+
+			if got := clock.NewID() == first && clock.NewID() == second; got != tt.same {
+				t.Errorf("same IDs: got %v, want %v", got, tt.same)
+			}
+			if !clock.Now().Equal(at) {
+				t.Errorf("time: got %s, want the command's %s", clock.Now(), at)
+			}
+		})
+	}
+}
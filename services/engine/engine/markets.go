@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Reasons set on orders for markets that are not trading
+const (
+	reasonUnknownMarket  = "UNKNOWN_MARKET"
+	reasonMarketInactive = "MARKET_INACTIVE"
+	reasonMarketDelisted = "MARKET_DELISTED"
+)
+
+// ErrUnknownMarket is returned by reads for a market the engine has no orderbook for
+var ErrUnknownMarket = errors.New("market is not configured")
+
+// DefaultMarkets are written to an empty markets table, so a new installation
+// has something to trade. After that the table is the only source of markets.
+var DefaultMarkets = []models.Market{
+	defaultMarket("Bitcoin", "BTC", 2, 5, "1000", "10"),
+	defaultMarket("Ethereum", "ETH", 2, 4, "10000", "10"),
+	defaultMarket("USDT", "USDT", 4, 2, "10000000", "10"),
+	defaultMarket("Solana", "SOL", 2, 3, "1000000", "10"),
+	defaultMarket("Dogecoin", "DOGE", 5, 0, "100000000", "10"),
+	defaultMarket("Chainlink", "LINK", 3, 2, "1000000", "10"),
+	defaultMarket("Sui", "SUI", 4, 1, "10000000", "10"),
+	defaultMarket("Shiba Inu", "SHIB", 8, 0, "100000000000", "10"),
+	defaultMarket("Render", "RENDER", 4, 1, "10000000", "10"),
+	defaultMarket("Sei", "SEI", 5, 0, "100000000", "10"),
+	defaultMarket("Ondo", "ONDO", 4, 1, "10000000", "10"),
+	defaultMarket("Worldcoin", "WLD", 4, 1, "10000000", "10"),
+	defaultMarket("Pudgy Penguins", "PENGU", 6, 0, "1000000000", "10"),
+	defaultMarket("Pepe", "PEPE", 8, 0, "100000000000", "10"),
+	defaultMarket("Aptos", "APT", 4, 2, "10000000", "10"),
+	defaultMarket("POL (ex-MATIC)", "POL", 5, 0, "100000000", "10"),
+	defaultMarket("Uniswap", "UNI", 3, 2, "1000000", "10"),
+	defaultMarket("Ethena", "ENA", 4, 1, "10000000", "10"),
+	defaultMarket("Aave", "AAVE", 2, 3, "1000000", "10"),
+}
+
+// defaultTierFees are the maker and taker rates of the default markets' fee
+// tiers, starting at tier 1. Tier 0 pays the market's own rates.
+var defaultTierFees = [][2]string{
+	{"0.0008", "0.0018"},
+	{"0.0006", "0.0015"},
+	{"0.0004", "0.0012"},
+	{"0.0002", "0.0010"},
+}
+
+// defaultMarket describes an active USD market whose smallest price and quantity
+// are one tick and one step
+func defaultMarket(name, baseAsset string, pricePrecision, quantityPrecision int, maxQuantity, minNotional string) models.Market {
+	fees := []models.MarketFee{}
+	for i, rates := range defaultTierFees {
+		fees = append(fees, models.MarketFee{
+			MarketID: baseAsset + "USD",
+			Tier:     i + 1,
+			MakerFee: decimal.RequireFromString(rates[0]),
+			TakerFee: decimal.RequireFromString(rates[1]),
+		})
+	}
+
+	return models.Market{
+		ID:                baseAsset + "USD",
+		BaseAsset:         baseAsset,
+		QuoteAsset:        "USD",
+		Name:              name,
+		MinQuantity:       decimal.New(1, -int32(quantityPrecision)),
+		MinPrice:          decimal.New(1, -int32(pricePrecision)),
+		PricePrecision:    pricePrecision,
+		QuantityPrecision: quantityPrecision,
+		MaxQuantity:       decimal.RequireFromString(maxQuantity),
+		MinNotional:       decimal.RequireFromString(minNotional),
+		IsActive:          true,
+		Status:            models.MARKET_OPEN,
+		// Halt for five minutes on a move of more than 10% within five minutes, then
+		// reopen with a one minute auction
+		PriceBand:               decimal.New(1, -1),
+		PriceBandWindowSeconds:  300,
+		HaltCooldownSeconds:     300,
+		ReopeningAuctionSeconds: 60,
+		// 0.1% for makers, 0.2% for takers
+		MakerFee: decimal.New(1, -3),
+		TakerFee: decimal.New(2, -3),
+		Fees:     fees,
+	}
+}
+
+// MarketFromModel turns a row of the markets table into the market the engine
+// runs. The tick and step are one unit in the last decimal place of the market's
+// price and quantity precision.
+func MarketFromModel(m models.Market) Market {
+	name := m.Name
+	if name == "" {
+		name = m.BaseAsset
+	}
+
+	status := m.Status
+	if status == "" {
+		status = models.MARKET_OPEN
+	}
+
+	return Market{
+		Name:   name,
+		Ticker: m.Ticker(),
+		Rules: TradingRules{
+			TickSize:    decimal.New(1, -int32(m.PricePrecision)),
+			StepSize:    decimal.New(1, -int32(m.QuantityPrecision)),
+			MinPrice:    m.MinPrice,
+			MinQuantity: m.MinQuantity,
+			MaxQuantity: m.MaxQuantity,
+			MinNotional: m.MinNotional,
+		},
+		Breaker: CircuitBreaker{
+			Band:      m.PriceBand,
+			Window:    time.Duration(m.PriceBandWindowSeconds) * time.Second,
+			Cooldown:  time.Duration(m.HaltCooldownSeconds) * time.Second,
+			Reopening: time.Duration(m.ReopeningAuctionSeconds) * time.Second,
+		},
+		Fees:   feeScheduleFromModel(m),
+		Active: m.IsActive,
+		Status: status,
+	}
+}
+
+// LoadMarkets reads every market that is not delisted from the markets table,
+// filling an empty table with DefaultMarkets first
+func LoadMarkets(db *gorm.DB) ([]models.Market, error) {
+	var count int64
+	if err := db.Model(&models.Market{}).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("counting markets: %w", err)
+	}
+
+	if count == 0 {
+		defaults := append([]models.Market{}, DefaultMarkets...)
+		if err := db.Create(&defaults).Error; err != nil {
+			return nil, fmt.Errorf("listing default markets: %w", err)
+		}
+		log.Printf("🏪 Listed %d default markets", len(defaults))
+	}
+
+	var markets []models.Market
+	if err := db.Preload("Fees").Where("delisted_at IS NULL").Order("id ASC").Find(&markets).Error; err != nil {
+		return nil, fmt.Errorf("loading markets: %w", err)
+	}
+
+	log.Printf("🏪 Loaded %d markets from the database", len(markets))
+	return markets, nil
+}
+
+// marketUnavailable returns why the market takes no new orders, or an empty
+// string if it does
+func (e *Engine) marketUnavailable(ticker string) string {
+	market := e.GetMarketByTicker(ticker)
+	if market == nil {
+		return reasonUnknownMarket
+	}
+	if !market.Active {
+		return reasonMarketInactive
+	}
+	return ""
+}
+
+// SyncMarket journals the market's definition from the database if the engine
+// recovered a different one, or has no history yet. Every order is then replayed
+// under the rules it was accepted with, whatever the table says by then.
+func (e *Engine) SyncMarket(definition models.Market) {
+	market := MarketFromModel(definition)
+	if current := e.GetMarketByTicker(market.Ticker); current != nil && e.Journal.Sequence() > 0 && current.Equal(market) {
+		return
+	}
+
+	e.Consume(&messages.MessageFromAPI{
+		MessageType: "UPDATE_MARKET",
+		Data:        messages.UpdateMarketRequest{Market: definition},
+	})
+}
+
+// UpdateMarket applies a market definition from the markets table. New rules
+// apply to orders from now on; orders already resting are left alone. Delisting
+// cancels every open order and takes the market off the engine's list.
+func (e *Engine) UpdateMarket(definition models.Market) messages.UpdateMarketResponse {
+	market := MarketFromModel(definition)
+
+	if definition.DelistedAt != nil {
+		for i := range e.Markets {
+			if e.Markets[i].Ticker == market.Ticker {
+				e.Markets = append(e.Markets[:i], e.Markets[i+1:]...)
+				break
+			}
+		}
+
+		cancelled := 0
+		if ob, err := e.FindOrderbook(market.Ticker); err == nil {
+			cancelled = e.closeMarket(ob, reasonMarketDelisted)
+		}
+
+		log.Printf("🪦 Market %s delisted, %d open orders cancelled", market.Ticker, cancelled)
+		return messages.UpdateMarketResponse{
+			Success: true,
+			Message: fmt.Sprintf("Market delisted, %d open orders cancelled", cancelled),
+		}
+	}
+
+	// The trading state only changes with SET_MARKET_STATUS, never with the listing
+	if current := e.GetMarketByTicker(market.Ticker); current != nil {
+		market.Status = current.Status
+		market.HaltedUntil = current.HaltedUntil
+		market.AuctionEndsAt = current.AuctionEndsAt
+		*current = market
+	} else {
+		e.Markets = append(e.Markets, market)
+	}
+
+	ob, _ := e.FindOrCreateOrderbook(market.Ticker)
+	if market.Rules.TickSize.IsPositive() {
+		ob.TickSize = market.Rules.TickSize
+	}
+
+	log.Printf("🏪 Market %s updated (active: %t, tick %s, step %s, fees %s)",
+		market.Ticker, market.Active, market.Rules.TickSize.String(), market.Rules.StepSize.String(), market.Fees.String())
+	return messages.UpdateMarketResponse{Success: true, Message: "Market updated"}
+}
+
+// closeMarket cancels every resting and untriggered stop order in a market and
+// returns how many there were. Cancelling a bracket entry can release its legs,
+// so it sweeps until the market is empty.
+func (e *Engine) closeMarket(ob *orderbook.OrderBook, reason string) int {
+	cancelled := 0
+
+	for {
+		open := []*models.Order{}
+		for _, side := range []*orderbook.BookSide{ob.Bids, ob.Asks} {
+			side.Each(func(order *models.Order) bool {
+				open = append(open, order)
+				return true
+			})
+		}
+		open = append(open, e.triggerBook(ob.GetTicker()).Orders...)
+
+		removed := 0
+		for _, order := range open {
+			if _, found := e.removeOpenOrder(ob, order.ID, order.UserID, reason); found {
+				removed++
+			}
+		}
+
+		if removed == 0 {
+			return cancelled
+		}
+		cancelled += removed
+	}
+}
+
+// Equal reports whether two markets are defined the same. The trading state is
+// not part of the definition.
+func (m Market) Equal(other Market) bool {
+	return m.Name == other.Name && m.Ticker == other.Ticker && m.Active == other.Active &&
+		m.Rules.Equal(other.Rules) && m.Breaker.Equal(other.Breaker) && m.Fees.Equal(other.Fees)
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+func TestUpdateMarket(t *testing.T) {
+	delisted := time.Now()
+
+	tests := []struct {
+		name       string
+		change     func(market *models.Market)
+		newOrder   string // Reason a new order is rejected with, empty if it is accepted
+		amend      string // Reason an amend of the resting order is refused with
+		resting    models.OrderStatus
+		restReason string
+	}{
+		{
+			name:     "new rules apply to new orders only",
+			change:   func(market *models.Market) { market.PricePrecision = 0 },
+			newOrder: reasonInvalidTickSize,
+			amend:    reasonInvalidTickSize,
+			resting:  models.PENDING,
+		},
+		{
+			name:     "inactive market takes no orders but keeps its book",
+			change:   func(market *models.Market) { market.IsActive = false },
+			newOrder: reasonMarketInactive,
+			amend:    reasonMarketInactive,
+			resting:  models.PENDING,
+		},
+		{
+			name:       "delisted market cancels every open order",
+			change:     func(market *models.Market) { market.DelistedAt = &delisted },
+			newOrder:   reasonUnknownMarket,
+			amend:      "",
+			resting:    models.CANCELLED,
+			restReason: reasonMarketDelisted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			engine := openTestEngine(t, dir)
+			user := uuid.New()
+			resting := placeOrder(t, engine, limitOrder(user, models.BUY, "99.5", "1"))
+			stop := placeOrder(t, engine, stopOrder(user, models.SELL, "90.5", "", "1"))
+
+			definition := DefaultMarkets[0]
+			tt.change(&definition)
+			send(engine, "UPDATE_MARKET", messages.UpdateMarketRequest{Market: definition})
+
+			order := placeOrder(t, engine, limitOrder(user, models.BUY, "98.5", "1"))
+			if tt.newOrder == "" && order.Status == models.REJECTED || tt.newOrder != "" && order.StatusReason != tt.newOrder {
+				t.Errorf("new order: got %s (%s), want %s", order.Status, order.StatusReason, tt.newOrder)
+			}
+
+			_, err := engine.ModifyOrder(messages.ModifyOrderRequest{UserID: user, OrderID: resting.ID.String(), Price: dec("97.5")})
+			var rejection *RejectionError
+			if tt.amend != "" && (!errors.As(err, &rejection) || rejection.Reason != tt.amend) {
+				t.Errorf("amend: got %v, want %s", err, tt.amend)
+			}
+
+			for _, open := range []*models.Order{resting, stop} {
+				if open.Status != tt.resting || open.StatusReason != tt.restReason {
+					t.Errorf("%s order: got %s (%s), want %s (%s)", open.Type, open.Status, open.StatusReason, tt.resting, tt.restReason)
+				}
+			}
+
+			// The change is journaled, so a restart comes back under the same market
+			want := engineState(t, engine)
+			engine.Journal.Close()
+			if got := engineState(t, openTestEngine(t, dir)); got != want {
+				t.Errorf("restarted state differs\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestReadsOfUnknownMarkets(t *testing.T) {
+	engine := newTestEngine(t)
+	books := len(engine.Orderbooks)
+
+	if _, err := engine.GetDepth("DOGE_USD"); err != ErrUnknownMarket {
+		t.Errorf("depth: got %v, want %v", err, ErrUnknownMarket)
+	}
+	if _, err := engine.GetOpenOrders(uuid.New(), "DOGE_USD"); err != ErrUnknownMarket {
+		t.Errorf("open orders: got %v, want %v", err, ErrUnknownMarket)
+	}
+	if created := len(engine.Orderbooks) - books; created != 0 {
+		t.Errorf("reads created %d orderbooks, want none", created)
+	}
+
+	if depth, err := engine.GetDepth(testMarket); err != nil || len(depth.Bids) != 0 {
+		t.Errorf("depth of an empty book: got %v, %v", depth, err)
+	}
+}
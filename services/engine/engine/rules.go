@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/shopspring/decimal"
+)
+
+// Reasons set on orders that break their market's trading rules
+const (
+	reasonInvalidTickSize      = "INVALID_TICK_SIZE"
+	reasonPriceBelowMinimum    = "PRICE_BELOW_MINIMUM"
+	reasonInvalidStepSize      = "INVALID_STEP_SIZE"
+	reasonQuantityBelowMinimum = "QUANTITY_BELOW_MINIMUM"
+	reasonQuantityAboveMaximum = "QUANTITY_ABOVE_MAXIMUM"
+	reasonNotionalBelowMinimum = "NOTIONAL_BELOW_MINIMUM"
+)
+
+// TradingRules are the limits every order in a market has to respect
+type TradingRules struct {
+	TickSize    decimal.Decimal `json:"tick_size"` // Prices are whole multiples of this
+	StepSize    decimal.Decimal `json:"step_size"` // Quantities are whole multiples of this
+	MinPrice    decimal.Decimal `json:"min_price"`
+	MinQuantity decimal.Decimal `json:"min_quantity"`
+	MaxQuantity decimal.Decimal `json:"max_quantity"` // Zero means no limit
+	MinNotional decimal.Decimal `json:"min_notional"` // Smallest price × quantity, in the quote asset
+}
+
+// Check returns the reason the order breaks the rules, or an empty string if it
+// doesn't. referencePrice values orders without a price of their own, such as
+// market orders; when there is none the notional check is skipped.
+func (r TradingRules) Check(order *models.Order, referencePrice *decimal.Decimal) string {
+	for _, price := range []*decimal.Decimal{order.Price, order.StopPrice, order.ProtectionPrice} {
+		if price == nil {
+			continue
+		}
+		if price.LessThan(r.MinPrice) {
+			return reasonPriceBelowMinimum
+		}
+		if !isMultiple(*price, r.TickSize) {
+			return reasonInvalidTickSize
+		}
+	}
+
+	if !isMultiple(order.Quantity, r.StepSize) {
+		return reasonInvalidStepSize
+	}
+	if order.DisplayQuantity != nil && !isMultiple(*order.DisplayQuantity, r.StepSize) {
+		return reasonInvalidStepSize
+	}
+	if order.Quantity.LessThan(r.MinQuantity) {
+		return reasonQuantityBelowMinimum
+	}
+	if r.MaxQuantity.IsPositive() && order.Quantity.GreaterThan(r.MaxQuantity) {
+		return reasonQuantityAboveMaximum
+	}
+
+	price := referencePrice
+	if order.StopPrice != nil {
+		price = order.StopPrice
+	}
+	if order.Price != nil {
+		price = order.Price
+	}
+	if price != nil && price.Mul(order.Quantity).LessThan(r.MinNotional) {
+		return reasonNotionalBelowMinimum
+	}
+
+	return ""
+}
+
+// Equal reports whether two sets of rules are the same
+func (r TradingRules) Equal(other TradingRules) bool {
+	return r.TickSize.Equal(other.TickSize) && r.StepSize.Equal(other.StepSize) &&
+		r.MinPrice.Equal(other.MinPrice) && r.MinQuantity.Equal(other.MinQuantity) &&
+		r.MaxQuantity.Equal(other.MaxQuantity) && r.MinNotional.Equal(other.MinNotional)
+}
+
+// RoundPrice moves a price to the nearest tick
+func (r TradingRules) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	if !r.TickSize.IsPositive() {
+		return price
+	}
+	return price.Div(r.TickSize).Round(0).Mul(r.TickSize)
+}
+
+// RoundQuantity cuts a quantity down to a whole number of steps
+func (r TradingRules) RoundQuantity(quantity decimal.Decimal) decimal.Decimal {
+	if !r.StepSize.IsPositive() {
+		return quantity
+	}
+	return quantity.Div(r.StepSize).Floor().Mul(r.StepSize)
+}
+
+func isMultiple(value, increment decimal.Decimal) bool {
+	if !increment.IsPositive() {
+		return true
+	}
+	return value.Mod(increment).IsZero()
+}
+
+// RejectionError is returned when the engine refuses an amend, e.g. because it
+// would break the market's rules. Its message is the machine-readable reason.
+type RejectionError struct {
+	Reason string
+}
+
+func (e *RejectionError) Error() string {
+	return e.Reason
+}
+
+// marketRules returns the rules of the market, or no restrictions for one the
+// engine doesn't know
+func (e *Engine) marketRules(market string) TradingRules {
+	if m := e.GetMarketByTicker(market); m != nil {
+		return m.Rules
+	}
+	return TradingRules{}
+}
+
+// checkTradingRules checks an order against its market's rules. Orders without a
+// price are valued at the best price on the other side, or the last trade.
+func (e *Engine) checkTradingRules(ob *orderbook.OrderBook, order *models.Order) string {
+	referencePrice := ob.BestAsk()
+	if order.Side == models.SELL {
+		referencePrice = ob.BestBid()
+	}
+	if referencePrice == nil && ob.CurrentPrice.IsPositive() {
+		referencePrice = &ob.CurrentPrice
+	}
+
+	return e.marketRules(order.MarketID).Check(order, referencePrice)
+}
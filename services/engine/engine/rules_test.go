@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+func TestTradingRules(t *testing.T) {
+	// BTC/USD: tick 0.01, step 0.00001, at most 1000 per order, notional of at least 10
+	tests := []struct {
+		name    string
+		request func(userID uuid.UUID) messages.OrderRequest
+		reason  string
+	}{
+		{
+			name: "order on the rules rests",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				return limitOrder(userID, models.BUY, "99.99", "0.20001")
+			},
+		},
+		{
+			name:    "price between ticks",
+			request: func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99.995", "1") },
+			reason:  reasonInvalidTickSize,
+		},
+		{
+			name:    "price below the first tick",
+			request: func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "0.001", "1") },
+			reason:  reasonPriceBelowMinimum,
+		},
+		{
+			name: "stop price between ticks",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				return stopOrder(userID, models.SELL, "90.001", "", "1")
+			},
+			reason: reasonInvalidTickSize,
+		},
+		{
+			name:    "quantity between steps",
+			request: func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99", "0.100005") },
+			reason:  reasonInvalidStepSize,
+		},
+		{
+			name:    "quantity above the maximum",
+			request: func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99", "1000.5") },
+			reason:  reasonQuantityAboveMaximum,
+		},
+		{
+			name:    "limit order worth less than the minimum notional",
+			request: func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99", "0.1") },
+			reason:  reasonNotionalBelowMinimum,
+		},
+		{
+			name: "market order valued at the best ask is worth less than the minimum",
+			request: func(userID uuid.UUID) messages.OrderRequest {
+				return messages.OrderRequest{UserID: userID, MarketID: testMarket, Side: models.BUY, Type: models.MARKET, Quantity: *dec("0.05")}
+			},
+			reason: reasonNotionalBelowMinimum,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "101", "1"))
+
+			order := placeOrder(t, engine, tt.request(uuid.New()))
+
+			status := models.REJECTED
+			if tt.reason == "" {
+				status = models.PENDING
+			}
+			if order.Status != status || order.StatusReason != tt.reason {
+				t.Errorf("got %s (%s), want %s (%s)", order.Status, order.StatusReason, status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAmendFollowsTradingRules(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+	order := placeOrder(t, engine, limitOrder(user, models.BUY, "99", "1"))
+
+	tests := []struct {
+		name   string
+		amend  messages.ModifyOrderRequest
+		reason string
+	}{
+		{"price between ticks", messages.ModifyOrderRequest{Price: dec("99.005")}, reasonInvalidTickSize},
+		{"quantity between steps", messages.ModifyOrderRequest{Quantity: dec("1.000001")}, reasonInvalidStepSize},
+		{"notional below the minimum", messages.ModifyOrderRequest{Quantity: dec("0.1")}, reasonNotionalBelowMinimum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.amend.UserID, tt.amend.OrderID = user, order.ID.String()
+
+			_, err := engine.ModifyOrder(tt.amend)
+
+			var ruleErr *RejectionError
+			if !errors.As(err, &ruleErr) || ruleErr.Reason != tt.reason {
+				t.Fatalf("got %v, want %s", err, tt.reason)
+			}
+			if !order.Price.Equal(*dec("99")) || !order.Quantity.Equal(*dec("1")) {
+				t.Errorf("refused amend changed the order to %s @ %s", order.Quantity, order.Price)
+			}
+		})
+	}
+}
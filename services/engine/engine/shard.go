@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+)
+
+// Shard is the worker for one market. It owns an Engine holding only that
+// market's orderbook and processes everything for it on a single goroutine, so a
+// burst on one market never queues behind another.
+type Shard struct {
+	Market Market
+	Queue  string // Redis list the gateway sends this market's requests to
+
+	engine   *Engine
+	broker   *broker.Broker
+	requests chan *messages.MessageFromAPI
+	calls    chan func(*Engine)
+	stopped  bool // Set by Stop, after which Run applies nothing more
+}
+
+// NewShard recovers the worker of a market from its snapshot and journal, or
+// bootstraps it if it has neither. definition is the market as the markets table
+// has it now. Without balances the worker moves no funds until they are attached.
+func NewShard(brokerClient *broker.Broker, definition models.Market, directory *OrderDirectory, balances *BalanceCache, bootstrap *BootstrapSource) (*Shard, error) {
+	market := MarketFromModel(definition)
+
+	journal, err := OpenJournal(JournalPath(market.Ticker))
+	if err != nil {
+		return nil, fmt.Errorf("opening journal for %s: %w", market.Ticker, err)
+	}
+
+	// A worker that can't rebuild its book must not start trading on a partial one
+	engine, err := NewEngine(brokerClient, []Market{market}, journal, SnapshotPath(market.Ticker))
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("recovering %s: %w", market.Ticker, err)
+	}
+	engine.Directory = directory
+
+	fresh := engine.Journal.Sequence() == 0
+	engine.SyncMarket(definition)
+	if fresh {
+		engine.Bootstrap(bootstrap)
+	}
+
+	// Orders restored before the directory was attached still need to be routable
+	for orderID := range engine.OrderIndex {
+		directory.Set(orderID, market.Ticker)
+	}
+	if balances != nil {
+		engine.AttachBalances(balances)
+	}
+
+	return &Shard{
+		Market:   market,
+		Queue:    broker.EngineQueue(market.Ticker),
+		engine:   engine,
+		broker:   brokerClient,
+		requests: make(chan *messages.MessageFromAPI, 1024),
+		calls:    make(chan func(*Engine)),
+	}, nil
+}
+
+// Run pops the market's queue and processes requests until the worker is stopped
+func (s *Shard) Run() {
+	go func() {
+		for {
+			message, err := s.broker.BRPop(s.Queue)
+			if err != nil {
+				log.Printf("error reading %s: %v", s.Queue, err)
+				time.Sleep(time.Second)
+				continue
+			}
+			s.requests <- message
+		}
+	}()
+
+	log.Printf("🧵 Engine worker for %s listening on %s", s.Market.Ticker, s.Queue)
+
+	// Snapshots keep the journal, and so the time a restart takes, bounded
+	snapshots := time.NewTicker(snapshotInterval())
+	defer snapshots.Stop()
+
+	for {
+		select {
+		case message := <-s.requests:
+			s.engine.Consume(message)
+		case call := <-s.calls:
+			call(s.engine)
+			if s.stopped {
+				log.Printf("🧵 Engine worker for %s stopped", s.Market.Ticker)
+				return
+			}
+		case <-snapshots.C:
+			if !s.engine.SnapshotDue() {
+				continue
+			}
+			if _, err := s.engine.TakeSnapshot(); err != nil {
+				log.Printf("❌ Failed to snapshot %s: %v", s.Market.Ticker, err)
+			}
+		}
+	}
+}
+
+// Snapshot writes the market's snapshot between two requests
+func (s *Shard) Snapshot() (uint64, error) {
+	var sequence uint64
+	var err error
+	s.Do(func(e *Engine) {
+		sequence, err = e.TakeSnapshot()
+	})
+	return sequence, err
+}
+
+// Stop writes the market's last snapshot, once every funds event is pushed, and
+// stops the worker, so nothing is applied after it
+func (s *Shard) Stop() (uint64, error) {
+	var sequence uint64
+	var err error
+	s.Do(func(e *Engine) {
+		sequence, err = e.TakeSnapshot()
+		s.stopped = true
+	})
+	return sequence, err
+}
+
+// snapshotInterval is SNAPSHOT_INTERVAL (e.g. "5m"), five minutes by default
+func snapshotInterval() time.Duration {
+	if value := os.Getenv("SNAPSHOT_INTERVAL"); value != "" {
+		if interval, err := time.ParseDuration(value); err == nil && interval > 0 {
+			return interval
+		}
+		log.Printf("Warning: invalid SNAPSHOT_INTERVAL %q, using 5m", value)
+	}
+	return 5 * time.Minute
+}
+
+// Submit hands a request to the worker as if it had arrived on its queue
+func (s *Shard) Submit(message *messages.MessageFromAPI) {
+	s.requests <- message
+}
+
+// Do runs fn on the worker's goroutine between two requests and waits for it.
+// This is how the coordinator reads or changes a market without locking it.
+func (s *Shard) Do(fn func(e *Engine)) {
+	done := make(chan struct{})
+	s.calls <- func(e *Engine) {
+		fn(e)
+		close(done)
+	}
+	<-done
+}
@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// SnapshotVersion is bumped whenever the snapshot layout changes. Snapshots of
+// another version are refused rather than half-loaded.
+//
+// 2: markets, fee tiers, price history and fund locks
+// 3: the quantities bracket legs were placed with
+// 4: the positions of bracket entries
+const SnapshotVersion = 4
+
+// Snapshot is the complete state of an engine after the journaled command with
+// sequence number Sequence. Recovery loads it and replays only the journal after it.
+type Snapshot struct {
+	Version             int                                      `json:"version"`
+	Sequence            uint64                                   `json:"sequence"`
+	TakenAt             time.Time                                `json:"taken_at"`
+	Markets             []Market                                 `json:"markets"` // As last updated through the journal
+	Orderbooks          []OrderbookSnapshot                      `json:"orderbooks"`
+	Groups              []*OrderGroupState                       `json:"groups"`
+	SelfTradePrevention map[uuid.UUID]models.SelfTradePrevention `json:"self_trade_prevention"`
+	FeeTiers            map[uuid.UUID]int                        `json:"fee_tiers"`
+	PriceHistory        map[string][]PricePoint                  `json:"price_history"`
+	Locks               map[uuid.UUID]*FundLock                  `json:"locks"`
+}
+
+// OrderbookSnapshot is one market's book. Resting orders are listed in matching
+// priority so loading them back in order restores every queue exactly.
+type OrderbookSnapshot struct {
+	Market       string          `json:"market"`
+	CurrentPrice decimal.Decimal `json:"current_price"`
+	LastTradeId  string          `json:"last_trade_id"`
+	TickSize     decimal.Decimal `json:"tick_size"`
+	Auction      bool            `json:"auction"` // Collecting orders for a call auction; the book may be crossed
+	Bids         []*models.Order `json:"bids"`
+	Asks         []*models.Order `json:"asks"`
+	Triggers     []*models.Order `json:"triggers"` // Untriggered stop orders, oldest first
+}
+
+// SnapshotPath is where the snapshot of a market worker lives, next to its journal
+func SnapshotPath(market string) string {
+	return filepath.Join(journalDir(), strings.Replace(market, "/", "_", 1)+".snapshot")
+}
+
+// TakeSnapshot writes the engine state to its snapshot file and empties the
+// journal, which the snapshot now covers. It returns the sequence number of the
+// last command included. The funds events of those commands are pushed first, as
+// they won't be replayed again.
+func (e *Engine) TakeSnapshot() (uint64, error) {
+	e.FlushFundsEvents()
+
+	snapshot := e.snapshot()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write beside the old snapshot and swap it in, so a crash never leaves a torn one
+	tmpPath := e.SnapshotPath + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, e.SnapshotPath); err != nil {
+		return 0, err
+	}
+
+	if err := e.Journal.Reset(); err != nil {
+		return 0, fmt.Errorf("snapshot %d written but journal not reset: %w", snapshot.Sequence, err)
+	}
+
+	e.snapshotSequence = snapshot.Sequence
+	log.Printf("📸 Snapshot %d written to %s (%d live orders)", snapshot.Sequence, e.SnapshotPath, len(e.OrderIndex))
+	return snapshot.Sequence, nil
+}
+
+// SnapshotDue reports whether commands were applied since the last snapshot
+func (e *Engine) SnapshotDue() bool {
+	return e.Journal.Sequence() != e.snapshotSequence
+}
+
+func (e *Engine) snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Version:             SnapshotVersion,
+		Sequence:            e.Journal.Sequence(),
+		TakenAt:             time.Now().UTC(),
+		Markets:             e.Markets,
+		Orderbooks:          []OrderbookSnapshot{},
+		Groups:              []*OrderGroupState{},
+		SelfTradePrevention: e.SelfTradePrevention,
+		FeeTiers:            e.FeeTiers,
+		PriceHistory:        e.PriceHistory,
+		Locks:               e.Locks,
+	}
+
+	for _, ob := range e.Orderbooks {
+		book := OrderbookSnapshot{
+			Market:       ob.GetTicker(),
+			CurrentPrice: ob.CurrentPrice,
+			LastTradeId:  ob.LastTradeId,
+			TickSize:     ob.TickSize,
+			Auction:      ob.Auction,
+			Bids:         []*models.Order{},
+			Asks:         []*models.Order{},
+			Triggers:     e.triggerBook(ob.GetTicker()).Orders,
+		}
+
+		ob.Bids.Each(func(order *models.Order) bool {
+			book.Bids = append(book.Bids, order)
+			return true
+		})
+		ob.Asks.Each(func(order *models.Order) bool {
+			book.Asks = append(book.Asks, order)
+			return true
+		})
+
+		snapshot.Orderbooks = append(snapshot.Orderbooks, book)
+	}
+
+	for _, state := range e.Groups {
+		snapshot.Groups = append(snapshot.Groups, state)
+	}
+
+	return snapshot
+}
+
+// loadSnapshot restores the engine from its snapshot file, if there is one, and
+// returns the sequence number the journal continues from
+func (e *Engine) loadSnapshot() (uint64, error) {
+	data, err := os.ReadFile(e.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("%s: %w", e.SnapshotPath, err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return 0, fmt.Errorf("%s: snapshot version %d, expected %d", e.SnapshotPath, snapshot.Version, SnapshotVersion)
+	}
+
+	e.restore(&snapshot)
+	e.snapshotSequence = snapshot.Sequence
+
+	log.Printf("📸 Loaded snapshot %d from %s (%d live orders)", snapshot.Sequence, e.SnapshotPath, len(e.OrderIndex))
+	return snapshot.Sequence, nil
+}
+
+// restore rebuilds books, trigger books, groups and account settings from a
+// snapshot. An order can appear both in a book and in a group; the group is
+// pointed at the book's order again so fills seen by one are seen by the other.
+func (e *Engine) restore(snapshot *Snapshot) {
+	orders := make(map[uuid.UUID]*models.Order)
+
+	for _, book := range snapshot.Orderbooks {
+		ob, err := e.FindOrCreateOrderbook(book.Market)
+		if err != nil {
+			continue
+		}
+
+		ob.CurrentPrice = book.CurrentPrice
+		ob.LastTradeId = book.LastTradeId
+		ob.TickSize = book.TickSize
+		ob.Auction = book.Auction
+
+		for _, order := range append(book.Bids, book.Asks...) {
+			ob.RestOrder(order)
+			orders[order.ID] = order
+		}
+
+		triggerBook := e.triggerBook(book.Market)
+		for _, order := range book.Triggers {
+			triggerBook.Add(order)
+			orders[order.ID] = order
+		}
+	}
+
+	for _, order := range orders {
+		e.updateOrderIndex(order)
+	}
+
+	for _, state := range snapshot.Groups {
+		for _, leg := range []**models.Order{&state.Entry, &state.TakeProfit, &state.StopLoss} {
+			if *leg == nil {
+				continue
+			}
+			if order, exists := orders[(*leg).ID]; exists {
+				*leg = order
+			}
+		}
+		e.Groups[state.Group.ID] = state
+
+		// Legs held back by their group are indexed too
+		if state.Group.Status == models.GROUP_PENDING && state.Entry != nil {
+			e.updateOrderIndex(state.TakeProfit)
+			e.updateOrderIndex(state.StopLoss)
+		}
+	}
+
+	// A snapshot without markets leaves the engine the ones it was started with
+	if len(snapshot.Markets) > 0 {
+		e.Markets = snapshot.Markets
+	}
+	if snapshot.SelfTradePrevention != nil {
+		e.SelfTradePrevention = snapshot.SelfTradePrevention
+	}
+	if snapshot.FeeTiers != nil {
+		e.FeeTiers = snapshot.FeeTiers
+	}
+	if snapshot.PriceHistory != nil {
+		e.PriceHistory = snapshot.PriceHistory
+	}
+	if snapshot.Locks != nil {
+		e.Locks = snapshot.Locks
+	}
+}
+
+// writeFileSync writes a file and waits until it is on disk
+func writeFileSync(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+func TestSnapshotRecovery(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name  string
+		after func(engine *Engine) // Commands journaled after the snapshot
+	}{
+		{
+			name:  "snapshot alone",
+			after: func(engine *Engine) {},
+		},
+		{
+			name: "snapshot and the journal after it",
+			after: func(engine *Engine) {
+				send(engine, "CANCEL_ORDER", messages.CancelOrderRequest{
+					UserID: alice, OrderID: userOrders(engine, alice)[0].ID.String(),
+				})
+				send(engine, "CREATE_ORDER", limitOrder(alice, models.SELL, "102", "2"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			original := openTestEngine(t, dir)
+
+			send(original, "SET_SELF_TRADE_PREVENTION", messages.SelfTradePreventionRequest{UserID: alice, Mode: models.STP_CANCEL_BOTH})
+			send(original, "CREATE_ORDER", limitOrder(alice, models.SELL, "101", "1"))
+			send(original, "CREATE_ORDER", limitOrder(bob, models.BUY, "99", "1"))
+			send(original, "CREATE_ORDER", limitOrder(bob, models.BUY, "101", "0.5"))
+			send(original, "CREATE_ORDER", messages.OrderRequest{
+				UserID: bob, MarketID: testMarket, Side: models.SELL, Type: models.STOP_MARKET, StopPrice: dec("95"), Quantity: *dec("1"),
+			})
+
+			sequence, err := original.TakeSnapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sequence != original.Journal.Sequence() || original.SnapshotDue() {
+				t.Errorf("snapshot at %d, want the journal's %d and nothing due", sequence, original.Journal.Sequence())
+			}
+			if info, err := os.Stat(original.Journal.path); err != nil || info.Size() != 0 {
+				t.Errorf("journal was not emptied by the snapshot")
+			}
+
+			tt.after(original)
+			want := engineState(t, original)
+			original.Journal.Close()
+
+			recovered := openTestEngine(t, dir)
+
+			if recovered.Journal.Sequence() != original.Journal.Sequence() {
+				t.Errorf("recovered to command %d, want %d", recovered.Journal.Sequence(), original.Journal.Sequence())
+			}
+			if got := engineState(t, recovered); got != want {
+				t.Errorf("recovered state differs\n got: %s\nwant: %s", got, want)
+			}
+			if mode := recovered.accountSelfTradePrevention(alice); mode != models.STP_CANCEL_BOTH {
+				t.Errorf("self-trade prevention: got %s, want CANCEL_BOTH", mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+)
+
+// Reasons set on orders and amends a market's trading state does not allow
+const (
+	reasonMarketHalted     = "MARKET_HALTED"
+	reasonMarketCancelOnly = "MARKET_CANCEL_ONLY"
+	reasonMarketPostOnly   = "MARKET_POST_ONLY"
+	reasonMarketInAuction  = "MARKET_IN_AUCTION"
+)
+
+func validMarketStatus(status models.MarketStatus) bool {
+	switch status {
+	case models.MARKET_OPEN, models.MARKET_HALTED, models.MARKET_CANCEL_ONLY, models.MARKET_POST_ONLY, models.MARKET_AUCTION:
+		return true
+	}
+	return false
+}
+
+// marketStatus returns the trading state of a market. Markets the engine doesn't
+// know are left to marketUnavailable, so they count as open here.
+func (e *Engine) marketStatus(ticker string) models.MarketStatus {
+	if market := e.GetMarketByTicker(ticker); market != nil && market.Status != "" {
+		return market.Status
+	}
+	return models.MARKET_OPEN
+}
+
+// admitOrder returns why the market's trading state refuses a new order, or an
+// empty string if it takes it. While only passive orders are allowed, limit
+// orders that don't say what to do if they would cross are rejected rather than
+// matched. An auction takes resting limit orders only, crossing or not.
+func (e *Engine) admitOrder(order *models.Order) string {
+	switch e.marketStatus(order.MarketID) {
+	case models.MARKET_HALTED:
+		return reasonMarketHalted
+	case models.MARKET_CANCEL_ONLY:
+		return reasonMarketCancelOnly
+	case models.MARKET_POST_ONLY:
+		if !restingLimitOrder(order) {
+			return reasonMarketPostOnly
+		}
+		if order.PostOnly == "" {
+			order.PostOnly = models.POST_ONLY_REJECT
+		}
+	case models.MARKET_AUCTION:
+		if !restingLimitOrder(order) {
+			return reasonMarketInAuction
+		}
+	}
+
+	return ""
+}
+
+// restingLimitOrder reports whether an order is a limit order that may rest
+func restingLimitOrder(order *models.Order) bool {
+	if order.Type != models.LIMIT || order.Price == nil {
+		return false
+	}
+	return order.TimeInForce != models.IOC && order.TimeInForce != models.FOK
+}
+
+// admitGroup returns why the market's trading state refuses a new order group.
+// Groups need stop legs, which only continuous trading takes.
+func (e *Engine) admitGroup(market string) string {
+	switch e.marketStatus(market) {
+	case models.MARKET_HALTED:
+		return reasonMarketHalted
+	case models.MARKET_CANCEL_ONLY:
+		return reasonMarketCancelOnly
+	case models.MARKET_POST_ONLY:
+		return reasonMarketPostOnly
+	case models.MARKET_AUCTION:
+		return reasonMarketInAuction
+	}
+	return ""
+}
+
+// admitAmend returns why the market's trading state refuses an amend, or an empty
+// string if it is allowed. amended is the order as it would be afterwards. In an
+// auction amended orders go back to resting, so any amend is fine.
+func (e *Engine) admitAmend(ob *orderbook.OrderBook, amended *models.Order) string {
+	switch e.marketStatus(ob.GetTicker()) {
+	case models.MARKET_HALTED:
+		return reasonMarketHalted
+	case models.MARKET_CANCEL_ONLY:
+		return reasonMarketCancelOnly
+	case models.MARKET_POST_ONLY:
+		if ob.WouldCross(amended) {
+			return reasonMarketPostOnly
+		}
+	}
+	return ""
+}
+
+// SetMarketStatus moves a market to another trading state. Orders already in the
+// book stay where they are whatever the new state.
+func (e *Engine) SetMarketStatus(req messages.MarketStatusRequest) messages.MarketStatusResponse {
+	market := e.GetMarketByTicker(strings.Replace(req.Market, "_", "/", 1))
+	if market == nil {
+		return messages.MarketStatusResponse{Success: false, Message: reasonUnknownMarket}
+	}
+
+	if !validMarketStatus(req.Status) {
+		return messages.MarketStatusResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown market status %q", req.Status),
+			Status:  market.Status,
+		}
+	}
+
+	// An operator's decision replaces any circuit breaker halt or timed auction,
+	// even one that already has the market in the requested state
+	market.HaltedUntil = nil
+	market.AuctionEndsAt = nil
+
+	if market.Status == req.Status {
+		return messages.MarketStatusResponse{
+			Success: true,
+			Message: fmt.Sprintf("Market is already %s", req.Status),
+			Status:  market.Status,
+		}
+	}
+
+	e.transitionMarket(market, req.Status, req.Reason)
+
+	return messages.MarketStatusResponse{
+		Success: true,
+		Message: fmt.Sprintf("Market is now %s", req.Status),
+		Status:  market.Status,
+	}
+}
+
+// transitionMarket changes a market's trading state and announces it. Entering
+// an auction starts collecting orders; the book uncrosses once the market trades
+// again, so halting an auction keeps its orders for later.
+func (e *Engine) transitionMarket(market *Market, status models.MarketStatus, reason string) {
+	previous := market.Status
+	market.Status = status
+	if status != models.MARKET_AUCTION {
+		market.AuctionEndsAt = nil
+	}
+
+	log.Printf("🚦 Market %s %s → %s (%s)", market.Ticker, previous, status, reason)
+	e.EmitMarketStatus(market.Ticker, previous, status, reason)
+
+	ob, err := e.FindOrCreateOrderbook(market.Ticker)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case status == models.MARKET_AUCTION && !ob.Auction:
+		ob.StartAuction()
+		e.EmitAuctionUpdate(market.Ticker, ob.IndicativeAuction(), false)
+	case ob.Auction && (status == models.MARKET_OPEN || status == models.MARKET_POST_ONLY):
+		e.uncross(ob)
+	}
+}
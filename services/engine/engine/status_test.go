@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+)
+
+func TestMarketStatusAdmission(t *testing.T) {
+	passive := func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "99", "1") }
+	crossing := func(userID uuid.UUID) messages.OrderRequest { return limitOrder(userID, models.BUY, "101", "1") }
+	market := func(userID uuid.UUID) messages.OrderRequest {
+		return messages.OrderRequest{UserID: userID, MarketID: testMarket, Side: models.BUY, Type: models.MARKET, Quantity: *dec("1")}
+	}
+	ioc := func(userID uuid.UUID) messages.OrderRequest {
+		request := passive(userID)
+		request.TimeInForce = models.IOC
+		return request
+	}
+
+	tests := []struct {
+		name    string
+		status  models.MarketStatus
+		request func(userID uuid.UUID) messages.OrderRequest
+		reason  string // Empty when the order is admitted
+		cancel  string // Reason cancelling the resting order is refused with
+	}{
+		{"open market takes crossing orders", models.MARKET_OPEN, crossing, "", ""},
+		{"halted market refuses orders", models.MARKET_HALTED, passive, reasonMarketHalted, reasonMarketHalted},
+		{"cancel-only market refuses orders", models.MARKET_CANCEL_ONLY, passive, reasonMarketCancelOnly, ""},
+		{"post-only market takes passive limits", models.MARKET_POST_ONLY, passive, "", ""},
+		{"post-only market rejects limits that would cross", models.MARKET_POST_ONLY, crossing, orderbook.StopReasonPostOnly, ""},
+		{"post-only market refuses market orders", models.MARKET_POST_ONLY, market, reasonMarketPostOnly, ""},
+		{"post-only market refuses IOC orders", models.MARKET_POST_ONLY, ioc, reasonMarketPostOnly, ""},
+		{"auction refuses market orders", models.MARKET_AUCTION, market, reasonMarketInAuction, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			user := uuid.New()
+			placeOrder(t, engine, limitOrder(uuid.New(), models.SELL, "100", "1"))
+			resting := placeOrder(t, engine, limitOrder(user, models.BUY, "98", "1"))
+
+			send(engine, "SET_MARKET_STATUS", messages.MarketStatusRequest{Market: testMarket, Status: tt.status, Reason: "test"})
+			if status := engine.marketStatus(testMarket); status != tt.status {
+				t.Fatalf("market is %s, want %s", status, tt.status)
+			}
+
+			order := placeOrder(t, engine, tt.request(uuid.New()))
+			if tt.reason == "" && order.Status == models.REJECTED || tt.reason != "" && order.StatusReason != tt.reason {
+				t.Errorf("order: got %s (%s), want reason %q", order.Status, order.StatusReason, tt.reason)
+			}
+
+			_, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: resting.ID.String()})
+			var rejection *RejectionError
+			switch {
+			case tt.cancel == "" && err != nil:
+				t.Errorf("cancel refused: %v", err)
+			case tt.cancel != "" && (!errors.As(err, &rejection) || rejection.Reason != tt.cancel):
+				t.Errorf("cancel: got %v, want %s", err, tt.cancel)
+			}
+		})
+	}
+}
+
+func TestSetMarketStatus(t *testing.T) {
+	engine := newTestEngine(t)
+
+	tests := []struct {
+		name    string
+		request messages.MarketStatusRequest
+		success bool
+		status  models.MarketStatus
+	}{
+		{"unknown status is refused", messages.MarketStatusRequest{Market: testMarket, Status: "CLOSED_FOR_LUNCH"}, false, models.MARKET_OPEN},
+		{"unknown market is refused", messages.MarketStatusRequest{Market: "XYZ/USD", Status: models.MARKET_HALTED}, false, models.MARKET_OPEN},
+		{"halting an open market", messages.MarketStatusRequest{Market: "BTC_USD", Status: models.MARKET_HALTED}, true, models.MARKET_HALTED},
+		{"halting it again changes nothing", messages.MarketStatusRequest{Market: testMarket, Status: models.MARKET_HALTED}, true, models.MARKET_HALTED},
+		{"reopening it", messages.MarketStatusRequest{Market: testMarket, Status: models.MARKET_OPEN}, true, models.MARKET_OPEN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := engine.SetMarketStatus(tt.request)
+			if response.Success != tt.success {
+				t.Errorf("success: got %v (%s), want %v", response.Success, response.Message, tt.success)
+			}
+			if status := engine.marketStatus(testMarket); status != tt.status {
+				t.Errorf("market is %s, want %s", status, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/orderbook"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ErrStopNotTriggered is returned for amends of stop orders that are still in the
+// trigger book. Cancel and place them again instead.
+var ErrStopNotTriggered = errors.New("stop orders cannot be amended before they trigger")
+
+// TriggerBook holds the stop orders of one market until the last trade price
+// reaches their stop price. Trailing stops move their stop price with the last
+// trade or with the best bid/ask. Orders are kept oldest first so that stops
+// sharing a trigger level fire in time priority.
+type TriggerBook struct {
+	Orders []*models.Order
+}
+
+func NewTriggerBook() *TriggerBook {
+	return &TriggerBook{Orders: []*models.Order{}}
+}
+
+func (t *TriggerBook) Add(order *models.Order) {
+	t.Orders = append(t.Orders, order)
+	sort.SliceStable(t.Orders, func(i, j int) bool {
+		return t.Orders[i].CreatedAt.Before(t.Orders[j].CreatedAt)
+	})
+}
+
+// Remove takes a stop order out of the book if it belongs to the user
+func (t *TriggerBook) Remove(orderID uuid.UUID, userID uuid.UUID) (*models.Order, bool) {
+	for i, order := range t.Orders {
+		if order.ID == orderID && order.UserID == userID {
+			t.Orders = append(t.Orders[:i], t.Orders[i+1:]...)
+			return order, true
+		}
+	}
+	return nil, false
+}
+
+// Triggered removes and returns every stop order whose stop price has been
+// reached by the given trade price
+func (t *TriggerBook) Triggered(lastPrice decimal.Decimal) []*models.Order {
+	triggered := []*models.Order{}
+	waiting := t.Orders[:0]
+
+	for _, order := range t.Orders {
+		if isTriggered(order, lastPrice) {
+			triggered = append(triggered, order)
+			continue
+		}
+		waiting = append(waiting, order)
+	}
+
+	t.Orders = waiting
+	return triggered
+}
+
+// Trail ratchets the trailing stops that follow the last trade towards a new
+// trade price
+func (t *TriggerBook) Trail(lastPrice decimal.Decimal) {
+	for _, order := range t.Orders {
+		if order.Type == models.TRAILING_STOP && order.TrailingReference != models.TRAIL_BEST_PRICE {
+			trail(order, lastPrice)
+		}
+	}
+}
+
+// TrailBest ratchets the trailing stops that follow the best price: sell stops
+// towards the best bid, buy stops towards the best ask. A missing side leaves
+// its stops where they are.
+func (t *TriggerBook) TrailBest(bestBid, bestAsk *decimal.Decimal) {
+	for _, order := range t.Orders {
+		if order.Type != models.TRAILING_STOP || order.TrailingReference != models.TRAIL_BEST_PRICE {
+			continue
+		}
+
+		if order.Side == models.SELL && bestBid != nil {
+			trail(order, *bestBid)
+		} else if order.Side == models.BUY && bestAsk != nil {
+			trail(order, *bestAsk)
+		}
+	}
+}
+
+// trail moves a trailing stop after its reference price. Sell stops only move
+// up and buy stops only move down, so a trailing stop never loosens.
+func trail(order *models.Order, reference decimal.Decimal) {
+	if order.StopPrice == nil {
+		return
+	}
+
+	stopPrice := trailingStopPrice(order, reference)
+	if order.Side == models.SELL && stopPrice.GreaterThan(*order.StopPrice) ||
+		order.Side == models.BUY && stopPrice.LessThan(*order.StopPrice) {
+		order.StopPrice = &stopPrice
+	}
+}
+
+// ExpiryDue reports whether any GTD stop order has reached its expiry
+func (t *TriggerBook) ExpiryDue(now time.Time) bool {
+	for _, order := range t.Orders {
+		if order.TimeInForce == models.GTD && order.ExpiresAt != nil && !now.Before(*order.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expire removes GTD stop orders past their expiry and returns them marked as EXPIRED
+func (t *TriggerBook) Expire(now time.Time) []*models.Order {
+	expired := []*models.Order{}
+	waiting := t.Orders[:0]
+
+	for _, order := range t.Orders {
+		if order.TimeInForce == models.GTD && order.ExpiresAt != nil && !now.Before(*order.ExpiresAt) {
+			order.Status = models.EXPIRED
+			order.UpdatedAt = now
+			expired = append(expired, order)
+			continue
+		}
+		waiting = append(waiting, order)
+	}
+
+	t.Orders = waiting
+	return expired
+}
+
+func (t *TriggerBook) GetOpenOrders(userID uuid.UUID) []models.Order {
+	openOrders := []models.Order{}
+	for _, order := range t.Orders {
+		if order.UserID == userID {
+			openOrders = append(openOrders, *order)
+		}
+	}
+	return openOrders
+}
+
+// isTriggered checks a stop order against a trade price: buy stops fire when the
+// market trades at or above the stop, sell stops at or below it
+func isTriggered(order *models.Order, lastPrice decimal.Decimal) bool {
+	if order.StopPrice == nil || lastPrice.LessThanOrEqual(decimal.Zero) {
+		return false
+	}
+	if order.Side == models.BUY {
+		return lastPrice.GreaterThanOrEqual(*order.StopPrice)
+	}
+	return lastPrice.LessThanOrEqual(*order.StopPrice)
+}
+
+// validTrailingDistance checks that a trailing stop has exactly one positive
+// distance, and that a percentage is below 100
+func validTrailingDistance(order *models.Order) bool {
+	if (order.TrailingOffset == nil) == (order.TrailingPercent == nil) {
+		return false
+	}
+	if order.TrailingOffset != nil {
+		return order.TrailingOffset.GreaterThan(decimal.Zero)
+	}
+	return order.TrailingPercent.GreaterThan(decimal.Zero) && order.TrailingPercent.LessThan(decimal.NewFromInt(100))
+}
+
+// trailingStopPrice is where a trailing stop triggers when the market is at the
+// given reference price: below it for sells, above it for buys
+func trailingStopPrice(order *models.Order, reference decimal.Decimal) decimal.Decimal {
+	distance := decimal.Zero
+	if order.TrailingOffset != nil {
+		distance = *order.TrailingOffset
+	} else if order.TrailingPercent != nil {
+		distance = reference.Mul(*order.TrailingPercent).Div(decimal.NewFromInt(100))
+	}
+
+	if order.Side == models.SELL {
+		return reference.Sub(distance)
+	}
+	return reference.Add(distance)
+}
+
+// validTrailingReference checks that a trailing stop follows a price the engine knows
+func validTrailingReference(order *models.Order) bool {
+	switch order.TrailingReference {
+	case "", models.TRAIL_LAST_PRICE, models.TRAIL_BEST_PRICE:
+		return true
+	}
+	return false
+}
+
+// trailingReference is the price a new trailing stop starts from: the price it
+// follows, or the other one if the market doesn't have that yet
+func trailingReference(ob *orderbook.OrderBook, order *models.Order) *decimal.Decimal {
+	best := ob.BestAsk()
+	if order.Side == models.SELL {
+		best = ob.BestBid()
+	}
+
+	if order.TrailingReference == models.TRAIL_BEST_PRICE && best != nil {
+		return best
+	}
+	if ob.CurrentPrice.GreaterThan(decimal.Zero) {
+		price := ob.CurrentPrice
+		return &price
+	}
+	return best
+}
+
+// activate turns a triggered stop order into the order type it stands for
+func activate(order *models.Order, now time.Time) {
+	switch order.Type {
+	case models.STOP_MARKET:
+		order.Type = models.MARKET
+		order.TimeInForce = models.IOC
+	case models.STOP_LIMIT:
+		order.Type = models.LIMIT
+	case models.TRAILING_STOP:
+		if order.Price == nil {
+			order.Type = models.MARKET
+			order.TimeInForce = models.IOC
+		} else {
+			order.Type = models.LIMIT
+		}
+	}
+	order.UpdatedAt = now
+}
@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestIsTriggered(t *testing.T) {
+	tests := []struct {
+		name      string
+		side      models.OrderSide
+		lastPrice string
+		triggered bool
+	}{
+		{"buy stop below its price waits", models.BUY, "99", false},
+		{"buy stop fires at its price", models.BUY, "100", true},
+		{"buy stop fires above its price", models.BUY, "101", true},
+		{"sell stop above its price waits", models.SELL, "101", false},
+		{"sell stop fires at its price", models.SELL, "100", true},
+		{"sell stop fires below its price", models.SELL, "99", true},
+		{"no trade yet fires nothing", models.SELL, "0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{Side: tt.side, Type: models.STOP_MARKET, StopPrice: dec("100")}
+			if got := isTriggered(order, decimal.RequireFromString(tt.lastPrice)); got != tt.triggered {
+				t.Errorf("got %v, want %v", got, tt.triggered)
+			}
+		})
+	}
+}
+
+func TestStopOrders(t *testing.T) {
+	tests := []struct {
+		name      string
+		stop      func(userID uuid.UUID) messages.OrderRequest
+		status    models.OrderStatus
+		reason    string
+		orderType models.OrderType
+		filled    string
+	}{
+		{
+			name:      "stop-market sell fires as a market order once the market trades through",
+			stop:      func(userID uuid.UUID) messages.OrderRequest { return stopOrder(userID, models.SELL, "99.5", "", "1") },
+			status:    models.FILLED,
+			orderType: models.MARKET,
+			filled:    "1",
+		},
+		{
+			name:      "stop-limit sell fires as a limit order and rests what it can't fill",
+			stop:      func(userID uuid.UUID) messages.OrderRequest { return stopOrder(userID, models.SELL, "99.5", "99", "2") },
+			status:    models.PARTIAL,
+			orderType: models.LIMIT,
+			filled:    "1",
+		},
+		{
+			name:      "stop-market buy above the market waits",
+			stop:      func(userID uuid.UUID) messages.OrderRequest { return stopOrder(userID, models.BUY, "110", "", "1") },
+			status:    models.PENDING,
+			orderType: models.STOP_MARKET,
+			filled:    "0",
+		},
+		{
+			name:      "stop the last trade has already gone through is rejected",
+			stop:      func(userID uuid.UUID) messages.OrderRequest { return stopOrder(userID, models.BUY, "95", "", "1") },
+			status:    models.REJECTED,
+			reason:    "STOP_ALREADY_TRIGGERED",
+			orderType: models.STOP_MARKET,
+			filled:    "0",
+		},
+		{
+			name: "stop without a stop price is rejected",
+			stop: func(userID uuid.UUID) messages.OrderRequest {
+				request := stopOrder(userID, models.SELL, "90", "", "1")
+				request.StopPrice = nil
+				return request
+			},
+			status:    models.REJECTED,
+			reason:    "INVALID_STOP_PRICE",
+			orderType: models.STOP_MARKET,
+			filled:    "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			maker, taker := uuid.New(), uuid.New()
+
+			// The market last traded at 100
+			placeOrder(t, engine, limitOrder(maker, models.SELL, "100", "1"))
+			placeOrder(t, engine, limitOrder(taker, models.BUY, "100", "1"))
+
+			stop := placeOrder(t, engine, tt.stop(uuid.New()))
+
+			// Bids at 99 and 98, then a trade at 99 takes the market through a stop at 99.5
+			placeOrder(t, engine, limitOrder(maker, models.BUY, "99", "2"))
+			placeOrder(t, engine, limitOrder(maker, models.BUY, "98", "1"))
+			placeOrder(t, engine, limitOrder(taker, models.SELL, "99", "1"))
+
+			if stop.Status != tt.status || stop.StatusReason != tt.reason {
+				t.Errorf("got %s (%s), want %s (%s)", stop.Status, stop.StatusReason, tt.status, tt.reason)
+			}
+			if stop.Type != tt.orderType {
+				t.Errorf("type: got %s, want %s", stop.Type, tt.orderType)
+			}
+			if !stop.FilledQuantity.Equal(decimal.RequireFromString(tt.filled)) {
+				t.Errorf("filled: got %s, want %s", stop.FilledQuantity, tt.filled)
+			}
+		})
+	}
+}
+
+func TestCancelStopOrder(t *testing.T) {
+	engine := newTestEngine(t)
+	user := uuid.New()
+	stop := placeOrder(t, engine, stopOrder(user, models.SELL, "90", "", "1"))
+
+	if _, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: uuid.New(), OrderID: stop.ID.String()}); err == nil {
+		t.Fatal("cancelled another user's stop order")
+	}
+	if _, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: user, OrderID: stop.ID.String()}); err != nil {
+		t.Fatal("failed to cancel a waiting stop order")
+	}
+	if stop.Status != models.CANCELLED || len(engine.triggerBook(testMarket).Orders) != 0 {
+		t.Errorf("got %s with %d stops waiting, want CANCELLED and none", stop.Status, len(engine.triggerBook(testMarket).Orders))
+	}
+}
+
+func TestTrail(t *testing.T) {
+	tests := []struct {
+		name    string
+		side    models.OrderSide
+		offset  string
+		percent string
+		prices  []string
+		stops   []string
+	}{
+		{
+			name:   "sell offset follows the market up but not down",
+			side:   models.SELL,
+			offset: "5",
+			prices: []string{"110", "107", "112"},
+			stops:  []string{"105", "105", "107"},
+		},
+		{
+			name:   "buy offset follows the market down but not up",
+			side:   models.BUY,
+			offset: "5",
+			prices: []string{"90", "93", "88"},
+			stops:  []string{"95", "95", "93"},
+		},
+		{
+			name:    "sell percent keeps its distance in proportion",
+			side:    models.SELL,
+			percent: "10",
+			prices:  []string{"120", "110", "150"},
+			stops:   []string{"108", "108", "135"},
+		},
+		{
+			name:    "buy percent keeps its distance in proportion",
+			side:    models.BUY,
+			percent: "10",
+			prices:  []string{"80", "90", "50"},
+			stops:   []string{"88", "88", "55"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{ID: uuid.New(), Side: tt.side, Type: models.TRAILING_STOP}
+			if tt.offset != "" {
+				order.TrailingOffset = dec(tt.offset)
+			} else {
+				order.TrailingPercent = dec(tt.percent)
+			}
+			stopPrice := trailingStopPrice(order, decimal.NewFromInt(100))
+			order.StopPrice = &stopPrice
+
+			book := NewTriggerBook()
+			book.Add(order)
+			for i, price := range tt.prices {
+				book.Trail(decimal.RequireFromString(price))
+				if !order.StopPrice.Equal(decimal.RequireFromString(tt.stops[i])) {
+					t.Errorf("after %s: got stop %s, want %s", price, order.StopPrice, tt.stops[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrailBest(t *testing.T) {
+	newStop := func(side models.OrderSide, reference models.TrailingReference, stop string) *models.Order {
+		return &models.Order{ID: uuid.New(), Side: side, Type: models.TRAILING_STOP, TrailingReference: reference,
+			TrailingOffset: dec("5"), StopPrice: dec(stop)}
+	}
+	sellBest := newStop(models.SELL, models.TRAIL_BEST_PRICE, "95")
+	buyBest := newStop(models.BUY, models.TRAIL_BEST_PRICE, "105")
+	sellLast := newStop(models.SELL, models.TRAIL_LAST_PRICE, "95")
+
+	book := NewTriggerBook()
+	for _, order := range []*models.Order{sellBest, buyBest, sellLast} {
+		book.Add(order)
+	}
+
+	steps := []struct {
+		name                        string
+		apply                       func()
+		sellBest, buyBest, sellLast string
+	}{
+		{"sell follows the best bid and buy the best ask", func() { book.TrailBest(dec("102"), dec("98")) }, "97", "103", "95"},
+		{"a missing side leaves its stops alone", func() { book.TrailBest(nil, dec("96")) }, "97", "101", "95"},
+		{"stops don't loosen when the book moves back", func() { book.TrailBest(dec("99"), dec("104")) }, "97", "101", "95"},
+		{"trades only move stops that follow the last trade", func() { book.Trail(decimal.NewFromInt(110)) }, "97", "101", "105"},
+	}
+	for _, step := range steps {
+		step.apply()
+		for _, check := range []struct {
+			order *models.Order
+			want  string
+		}{{sellBest, step.sellBest}, {buyBest, step.buyBest}, {sellLast, step.sellLast}} {
+			if !check.order.StopPrice.Equal(decimal.RequireFromString(check.want)) {
+				t.Errorf("%s: %s %s stop at %s, want %s", step.name, check.order.Side, check.order.TrailingReference, check.order.StopPrice, check.want)
+			}
+		}
+	}
+}
+
+func TestTrailingStopReference(t *testing.T) {
+	engine := newTestEngine(t)
+	trade(t, engine, "100")
+	placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "98", "1"))
+
+	trailing := func(reference models.TrailingReference) *models.Order {
+		request := stopOrder(uuid.New(), models.SELL, "0", "", "1")
+		request.Type, request.StopPrice, request.TrailingOffset, request.TrailingReference = models.TRAILING_STOP, nil, dec("5"), reference
+		return placeOrder(t, engine, request)
+	}
+	best := trailing(models.TRAIL_BEST_PRICE)
+	last := trailing(models.TRAIL_LAST_PRICE)
+	if !best.StopPrice.Equal(decimal.NewFromInt(93)) || !last.StopPrice.Equal(decimal.NewFromInt(95)) {
+		t.Fatalf("got stops %s and %s, want 93 from the best bid and 95 from the last trade", best.StopPrice, last.StopPrice)
+	}
+
+	// A better bid re-trails the stop that follows the book without a trade
+	bid := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "102", "1"))
+	if !best.StopPrice.Equal(decimal.NewFromInt(97)) || !last.StopPrice.Equal(decimal.NewFromInt(95)) {
+		t.Errorf("after a 102 bid: got stops %s and %s, want 97 and 95", best.StopPrice, last.StopPrice)
+	}
+
+	// and it stays there when the bid goes away
+	if _, err := engine.CancelOrder(messages.CancelOrderRequest{UserID: bid.UserID, OrderID: bid.ID.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if !best.StopPrice.Equal(decimal.NewFromInt(97)) {
+		t.Errorf("after the bid was cancelled: got stop %s, want 97", best.StopPrice)
+	}
+
+	if invalid := trailing("MID_PRICE"); invalid.Status != models.REJECTED || invalid.StatusReason != "INVALID_TRAILING_REFERENCE" {
+		t.Errorf("unknown reference: got %s (%s), want REJECTED", invalid.Status, invalid.StatusReason)
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	engine := newTestEngine(t)
+	trade(t, engine, "100")
+
+	request := stopOrder(uuid.New(), models.SELL, "0", "", "1")
+	request.Type, request.StopPrice, request.TrailingOffset = models.TRAILING_STOP, nil, dec("5")
+	stop := placeOrder(t, engine, request)
+	if stop.Status != models.PENDING || !stop.StopPrice.Equal(decimal.NewFromInt(95)) {
+		t.Fatalf("got %s with stop %s, want PENDING at 95", stop.Status, stop.StopPrice)
+	}
+
+	trade(t, engine, "110")
+	trade(t, engine, "107")
+	if !stop.StopPrice.Equal(decimal.NewFromInt(105)) {
+		t.Fatalf("got stop %s, want 105 from the high of 110", stop.StopPrice)
+	}
+
+	bid := placeOrder(t, engine, limitOrder(uuid.New(), models.BUY, "103", "2"))
+	trade(t, engine, "104")
+
+	if stop.Status != models.FILLED || stop.Type != models.MARKET {
+		t.Errorf("got %s %s, want a FILLED MARKET order", stop.Status, stop.Type)
+	}
+	if !bid.RemainingQuantity.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("bid: got %s left, want 1 after the stop sold into it once", bid.RemainingQuantity)
+	}
+	if stops := len(engine.triggerBook(testMarket).Orders); stops != 0 {
+		t.Errorf("got %d stops waiting, want none", stops)
+	}
+}
+
+func TestTrailingStopRejections(t *testing.T) {
+	tests := []struct {
+		name    string
+		traded  bool
+		offset  *decimal.Decimal
+		percent *decimal.Decimal
+		reason  string
+	}{
+		{"no distance", true, nil, nil, "INVALID_TRAILING_DISTANCE"},
+		{"both distances", true, dec("5"), dec("5"), "INVALID_TRAILING_DISTANCE"},
+		{"percent of 100 or more", true, nil, dec("100"), "INVALID_TRAILING_DISTANCE"},
+		{"nothing to trail", false, dec("5"), nil, "NO_REFERENCE_PRICE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newTestEngine(t)
+			if tt.traded {
+				trade(t, engine, "100")
+			}
+
+			request := stopOrder(uuid.New(), models.SELL, "0", "", "1")
+			request.Type, request.StopPrice = models.TRAILING_STOP, nil
+			request.TrailingOffset, request.TrailingPercent = tt.offset, tt.percent
+			order := placeOrder(t, engine, request)
+
+			if order.Status != models.REJECTED || order.StatusReason != tt.reason {
+				t.Errorf("got %s (%s), want REJECTED (%s)", order.Status, order.StatusReason, tt.reason)
+			}
+		})
+	}
+}
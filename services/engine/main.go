@@ -2,24 +2,66 @@ package main
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/KshitijBhardwaj18/Orbix/services/engine/config"
 	"github.com/KshitijBhardwaj18/Orbix/services/engine/engine"
 	"github.com/KshitijBhardwaj18/Orbix/shared/broker"
+	"github.com/KshitijBhardwaj18/Orbix/shared/messages"
 )
 
 func main() {
 	Broker := broker.NewRedisClient()
-	Engine := engine.NewEngine(Broker)
 
-	for {
-		message, err := Broker.BRPop("engine_requests")
+	db, err := config.ConnectDB()
+	if err != nil {
+		log.Fatalf("Database connection failed: %v", err)
+	}
 
-		Engine.Consume(message)
+	// Markets are listed in the database; admins add and change them at runtime
+	markets, err := engine.LoadMarkets(db)
+	if err != nil {
+		log.Fatalf("Failed to load markets: %v", err)
+	}
 
-		if err != nil {
-			log.Printf("error is %v", err)
-		}
+	// Markets with no journal yet start from the database and/or demo liquidity
+	bootstrap, err := engine.NewBootstrapSource(db, markets)
+	if err != nil {
+		log.Fatalf("Failed to load bootstrap state: %v", err)
+	}
+
+	Coordinator := engine.NewCoordinator(Broker, markets, bootstrap)
 
+	// Orders are checked against and lock funds in the balances every market
+	// shares, read once the database has caught up with the funds queue
+	if err := Coordinator.AttachBalances(db); err != nil {
+		log.Fatalf("Failed to load balances: %v", err)
 	}
 
+	// Time-based work (GTD expiry) goes through the coordinator, which hands the
+	// tick to every market worker so each still processes everything on its own goroutine
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := Broker.Enqueue(broker.CoordinatorQueue, &messages.MessageFromAPI{MessageType: "TICK"}); err != nil {
+				log.Printf("failed to enqueue engine tick: %v", err)
+			}
+		}
+	}()
+
+	go Coordinator.Run()
+
+	// Snapshot on the way down so the next start has no journal to replay. Each
+	// worker pushes its remaining funds events first and applies nothing after.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("Shutting down, pushing funds events and writing snapshots...")
+	Coordinator.Shutdown()
 }
@@ -0,0 +1,250 @@
+package orderbook
+
+import (
+	"sort"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// StopReasonAuctionPrice is set on orders without a price sent during a call
+// auction, which only collects limit orders
+const StopReasonAuctionPrice = "AUCTION_REQUIRES_PRICE"
+
+// AuctionState is where a call auction would uncross if it ended now
+type AuctionState struct {
+	Price       *decimal.Decimal `json:"price"`                  // Nil while the book doesn't cross
+	Volume      decimal.Decimal  `json:"volume"`                 // Quantity that trades at Price
+	Surplus     decimal.Decimal  `json:"surplus"`                // Quantity left over at Price on the heavier side
+	SurplusSide models.OrderSide `json:"surplus_side,omitempty"` // Side the surplus is on, empty when there is none
+}
+
+// auctionLevel is the total remaining quantity at one price on one side
+type auctionLevel struct {
+	price    decimal.Decimal
+	quantity decimal.Decimal
+}
+
+// StartAuction puts the book into a call auction: orders rest without matching,
+// even where they cross, until Uncross
+func (o *OrderBook) StartAuction() {
+	o.Auction = true
+}
+
+// IndicativeAuction works out the auction price: the single price that executes
+// the most volume. Ties go, in turn, to the price leaving the smallest surplus;
+// to the highest price if every tied price leaves buyers over, or the lowest if
+// every one leaves sellers over; to the price closest to the last trade; and
+// finally to the lowest price.
+func (o *OrderBook) IndicativeAuction() AuctionState {
+	bids := auctionLevels(o.Bids)
+	asks := auctionLevels(o.Asks)
+
+	// Every price on either side is a candidate, lowest first
+	prices := []decimal.Decimal{}
+	for _, level := range append(append([]auctionLevel{}, bids...), asks...) {
+		prices = append(prices, level.price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].LessThan(prices[j]) })
+
+	candidates := []decimal.Decimal{}
+	for _, price := range prices {
+		if len(candidates) == 0 || !price.Equal(candidates[len(candidates)-1]) {
+			candidates = append(candidates, price)
+		}
+	}
+
+	// Supply at a price is every ask at or below it, demand every bid at or above it
+	supply := make([]decimal.Decimal, len(candidates))
+	demand := make([]decimal.Decimal, len(candidates))
+
+	total, next := decimal.Zero, 0
+	for i, price := range candidates {
+		for next < len(asks) && asks[next].price.LessThanOrEqual(price) {
+			total = total.Add(asks[next].quantity)
+			next++
+		}
+		supply[i] = total
+	}
+
+	total, next = decimal.Zero, 0
+	for i := len(candidates) - 1; i >= 0; i-- {
+		for next < len(bids) && bids[next].price.GreaterThanOrEqual(candidates[i]) {
+			total = total.Add(bids[next].quantity)
+			next++
+		}
+		demand[i] = total
+	}
+
+	best := []int{}
+	bestVolume, bestSurplus := decimal.Zero, decimal.Zero
+	for i := range candidates {
+		volume := decimal.Min(supply[i], demand[i])
+		if !volume.IsPositive() {
+			continue
+		}
+		surplus := demand[i].Sub(supply[i]).Abs()
+
+		switch {
+		case len(best) == 0 || volume.GreaterThan(bestVolume) ||
+			(volume.Equal(bestVolume) && surplus.LessThan(bestSurplus)):
+			best = []int{i}
+			bestVolume, bestSurplus = volume, surplus
+		case volume.Equal(bestVolume) && surplus.Equal(bestSurplus):
+			best = append(best, i)
+		}
+	}
+
+	if len(best) == 0 {
+		return AuctionState{Volume: decimal.Zero, Surplus: decimal.Zero}
+	}
+
+	chosen := o.auctionTieBreak(best, candidates, supply, demand)
+	price := candidates[chosen]
+
+	state := AuctionState{Price: &price, Volume: bestVolume, Surplus: bestSurplus}
+	if demand[chosen].GreaterThan(supply[chosen]) {
+		state.SurplusSide = models.BUY
+	} else if supply[chosen].GreaterThan(demand[chosen]) {
+		state.SurplusSide = models.SELL
+	}
+	return state
+}
+
+// auctionTieBreak picks one of the candidate prices that execute the same volume
+// with the same surplus. tied is in ascending price order.
+func (o *OrderBook) auctionTieBreak(tied []int, candidates, supply, demand []decimal.Decimal) int {
+	if len(tied) == 1 {
+		return tied[0]
+	}
+
+	buyPressure, sellPressure := true, true
+	for _, i := range tied {
+		if !demand[i].GreaterThan(supply[i]) {
+			buyPressure = false
+		}
+		if !supply[i].GreaterThan(demand[i]) {
+			sellPressure = false
+		}
+	}
+	if buyPressure {
+		return tied[len(tied)-1]
+	}
+	if sellPressure {
+		return tied[0]
+	}
+
+	chosen := tied[0]
+	if o.CurrentPrice.IsPositive() {
+		for _, i := range tied[1:] {
+			if candidates[i].Sub(o.CurrentPrice).Abs().LessThan(candidates[chosen].Sub(o.CurrentPrice).Abs()) {
+				chosen = i
+			}
+		}
+	}
+	return chosen
+}
+
+// auctionLevels totals each price level of a side, best price first
+func auctionLevels(side *BookSide) []auctionLevel {
+	levels := []auctionLevel{}
+	side.EachLevel(func(level *PriceLevel) bool {
+		total := decimal.Zero
+		for element := level.Orders.Front(); element != nil; element = element.Next() {
+			total = total.Add(element.Value.(*models.Order).RemainingQuantity)
+		}
+		levels = append(levels, auctionLevel{price: level.Price, quantity: total})
+		return true
+	})
+	return levels
+}
+
+// Uncross ends the auction. Everything that can trade does so at the auction
+// price, bids and asks each taken in price-time priority, and the book goes back
+// to continuous matching. Neither side is the incoming order, so self-trade
+// prevention doesn't apply; the order that rested first counts as the maker.
+func (o *OrderBook) Uncross() (*MatchingResult, AuctionState) {
+	state := o.IndicativeAuction()
+	o.Auction = false
+
+	result := &MatchingResult{
+		UpdatedOrders:   []*models.Order{},
+		GeneratedTrades: []models.Trade{},
+		RemovedOrderIDs: []uuid.UUID{},
+		StopReason:      StopReasonFilled,
+	}
+	if state.Price == nil {
+		return result, state
+	}
+
+	price := *state.Price
+	updated := make(map[uuid.UUID]bool)
+	remaining := state.Volume
+
+	for remaining.IsPositive() {
+		bid, ask := o.Bids.Front(), o.Asks.Front()
+		if bid == nil || ask == nil || bid.Price.LessThan(price) || ask.Price.GreaterThan(price) {
+			break
+		}
+
+		quantity := decimal.Min(bid.RemainingQuantity, ask.RemainingQuantity, remaining)
+		remaining = remaining.Sub(quantity)
+
+		for _, order := range []*models.Order{bid, ask} {
+			o.fillAuctionOrder(order, quantity, result)
+			if !updated[order.ID] {
+				updated[order.ID] = true
+				result.UpdatedOrders = append(result.UpdatedOrders, order)
+			}
+		}
+
+		trade := models.Trade{
+			ID:            o.Clock.NewID(),
+			MarketID:      bid.MarketID,
+			BuyerID:       bid.UserID,
+			SellerID:      ask.UserID,
+			BuyerOrderID:  bid.ID,
+			SellerOrderID: ask.ID,
+			Price:         price,
+			IsBuyerMaker:  bid.CreatedAt.Before(ask.CreatedAt),
+			Quantity:      quantity,
+			QuoteQuantity: price.Mul(quantity),
+			CreatedAt:     o.Clock.Now(),
+		}
+		o.chargeFees(&trade)
+
+		result.GeneratedTrades = append(result.GeneratedTrades, trade)
+		o.CurrentPrice = trade.Price
+		o.LastTradeId = trade.ID.String()
+	}
+
+	return result, state
+}
+
+// fillAuctionOrder applies an uncross fill to a resting order. An auction can
+// take an iceberg's hidden quantity too; one that is left with nothing showing
+// refills and requeues as it would in continuous trading.
+func (o *OrderBook) fillAuctionOrder(order *models.Order, quantity decimal.Decimal, result *MatchingResult) {
+	order.FilledQuantity = order.FilledQuantity.Add(quantity)
+	order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
+	order.UpdatedAt = o.Clock.Now()
+
+	side := o.bookSide(order.Side)
+	if order.RemainingQuantity.IsZero() {
+		order.Status = models.FILLED
+		result.RemovedOrderIDs = append(result.RemovedOrderIDs, order.ID)
+		side.Remove(order.ID)
+		return
+	}
+
+	order.Status = models.PARTIAL
+	if order.DisplayQuantity != nil {
+		if quantity.GreaterThanOrEqual(order.VisibleQuantity) {
+			refillIceberg(order)
+			side.Requeue(order.ID)
+		} else {
+			order.VisibleQuantity = order.VisibleQuantity.Sub(quantity)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/shopspring/decimal"
+)
+
+// auctionBook starts an auction on a new book and rests the orders in it
+func auctionBook(lastPrice string, orders ...*models.Order) *OrderBook {
+	book := NewOrderBook("BTC", "USD")
+	if lastPrice != "" {
+		book.CurrentPrice = decimal.RequireFromString(lastPrice)
+	}
+	book.StartAuction()
+	for _, order := range orders {
+		book.AddOrder(order)
+	}
+	return book
+}
+
+func TestIndicativeAuction(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastPrice   string
+		orders      []*models.Order
+		price       string
+		volume      string
+		surplus     string
+		surplusSide models.OrderSide
+	}{
+		{
+			name:    "no price while the book doesn't cross",
+			orders:  []*models.Order{testOrder(models.BUY, "99", "1"), testOrder(models.SELL, "101", "1")},
+			volume:  "0",
+			surplus: "0",
+		},
+		{
+			name: "price executing the most volume",
+			orders: []*models.Order{
+				testOrder(models.BUY, "101", "2"), testOrder(models.BUY, "100", "1"),
+				testOrder(models.SELL, "99", "1"), testOrder(models.SELL, "100", "2"),
+			},
+			price:   "100",
+			volume:  "3",
+			surplus: "0",
+		},
+		{
+			name: "equal volume goes to the smallest surplus",
+			orders: []*models.Order{
+				testOrder(models.BUY, "100", "2"), testOrder(models.BUY, "99", "1"),
+				testOrder(models.SELL, "99", "2"),
+			},
+			price:   "100",
+			volume:  "2",
+			surplus: "0",
+		},
+		{
+			name:        "buyers left over at every tied price take the highest",
+			orders:      []*models.Order{testOrder(models.BUY, "102", "3"), testOrder(models.SELL, "100", "2")},
+			price:       "102",
+			volume:      "2",
+			surplus:     "1",
+			surplusSide: models.BUY,
+		},
+		{
+			name:        "sellers left over at every tied price take the lowest",
+			orders:      []*models.Order{testOrder(models.BUY, "102", "2"), testOrder(models.SELL, "100", "3")},
+			price:       "100",
+			volume:      "2",
+			surplus:     "1",
+			surplusSide: models.SELL,
+		},
+		{
+			name:      "balanced ties go to the price closest to the last trade",
+			lastPrice: "101.5",
+			orders:    []*models.Order{testOrder(models.BUY, "102", "2"), testOrder(models.SELL, "100", "2")},
+			price:     "102",
+			volume:    "2",
+			surplus:   "0",
+		},
+		{
+			name:    "balanced ties without a last trade take the lowest",
+			orders:  []*models.Order{testOrder(models.BUY, "102", "2"), testOrder(models.SELL, "100", "2")},
+			price:   "100",
+			volume:  "2",
+			surplus: "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := auctionBook(tt.lastPrice, tt.orders...).IndicativeAuction()
+
+			switch {
+			case tt.price == "" && state.Price != nil:
+				t.Errorf("got price %s, want none", state.Price)
+			case tt.price != "" && (state.Price == nil || !state.Price.Equal(decimal.RequireFromString(tt.price))):
+				t.Errorf("got price %v, want %s", state.Price, tt.price)
+			}
+			if !state.Volume.Equal(decimal.RequireFromString(tt.volume)) {
+				t.Errorf("volume: got %s, want %s", state.Volume, tt.volume)
+			}
+			if !state.Surplus.Equal(decimal.RequireFromString(tt.surplus)) || state.SurplusSide != tt.surplusSide {
+				t.Errorf("surplus: got %s %s, want %s %s", state.Surplus, state.SurplusSide, tt.surplus, tt.surplusSide)
+			}
+		})
+	}
+}
+
+func TestUncross(t *testing.T) {
+	highBid := testOrder(models.BUY, "101", "2")
+	lowBid := testOrder(models.BUY, "100", "2")
+	lowAsk := testOrder(models.SELL, "99", "1")
+	highAsk := testOrder(models.SELL, "100", "2")
+	book := auctionBook("", highBid, lowBid, lowAsk, highAsk)
+
+	if book.Bids.Len() != 2 || book.Asks.Len() != 2 {
+		t.Fatal("orders matched during the auction")
+	}
+
+	result, state := book.Uncross()
+
+	if book.Auction {
+		t.Error("book is still in the auction")
+	}
+	if state.Price == nil || !state.Price.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("uncrossed at %v, want 100", state.Price)
+	}
+
+	volume := decimal.Zero
+	for _, trade := range result.GeneratedTrades {
+		if !trade.Price.Equal(*state.Price) {
+			t.Errorf("trade at %s, not the auction price", trade.Price)
+		}
+		volume = volume.Add(trade.Quantity)
+	}
+	if !volume.Equal(state.Volume) {
+		t.Errorf("traded %s, want %s", volume, state.Volume)
+	}
+
+	// The better priced bid fills first, so what is left is on the lower bid
+	if highBid.Status != models.FILLED || lowBid.Status != models.PARTIAL {
+		t.Errorf("bids: got %s and %s, want FILLED and PARTIAL", highBid.Status, lowBid.Status)
+	}
+	if book.Asks.Len() != 0 || book.Bids.Len() != 1 || !lowBid.RemainingQuantity.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("left %d bids and %d asks, %s on the low bid", book.Bids.Len(), book.Asks.Len(), lowBid.RemainingQuantity)
+	}
+
+	// After the auction the book matches continuously again
+	incoming := testOrder(models.SELL, "100", "1")
+	if book.AddOrder(incoming); incoming.Status != models.FILLED {
+		t.Errorf("order after the auction: got %s, want FILLED", incoming.Status)
+	}
+}
+
+func TestAuctionRefusesMarketOrders(t *testing.T) {
+	book := auctionBook("")
+	order := testOrder(models.BUY, "", "1")
+
+	result := book.AddOrder(order)
+
+	if order.Status != models.REJECTED || result.StopReason != StopReasonAuctionPrice {
+		t.Errorf("got %s (%s), want REJECTED (%s)", order.Status, result.StopReason, StopReasonAuctionPrice)
+	}
+}
@@ -0,0 +1,42 @@
+package orderbook
+
+import (
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// FeePrecision is the number of decimal places fees are charged to. Fees are
+// rounded up, never down to nothing.
+const FeePrecision = 8
+
+// Fees supplies the rates the book charges on trades, as fractions of what each
+// side receives
+type Fees interface {
+	FeeRates(userID uuid.UUID) (maker, taker decimal.Decimal)
+}
+
+// NoFees charges nothing
+type NoFees struct{}
+
+func (NoFees) FeeRates(uuid.UUID) (maker, taker decimal.Decimal) {
+	return decimal.Zero, decimal.Zero
+}
+
+// chargeFees sets what each side pays for a trade, at their maker or taker rate
+// depending on IsBuyerMaker. The buyer pays in the base asset it receives and the
+// seller in the quote asset.
+func (o *OrderBook) chargeFees(trade *models.Trade) {
+	buyerMaker, buyerTaker := o.Fees.FeeRates(trade.BuyerID)
+	sellerMaker, sellerTaker := o.Fees.FeeRates(trade.SellerID)
+
+	buyerRate, sellerRate := buyerTaker, sellerMaker
+	if trade.IsBuyerMaker {
+		buyerRate, sellerRate = buyerMaker, sellerTaker
+	}
+
+	buyerFee := trade.Quantity.Mul(buyerRate).RoundCeil(FeePrecision)
+	sellerFee := trade.QuoteQuantity.Mul(sellerRate).RoundCeil(FeePrecision)
+	trade.BuyerFee = &buyerFee
+	trade.SellerFee = &sellerFee
+}
@@ -0,0 +1,93 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// flatFees charges every user the same maker and taker rates
+type flatFees struct {
+	maker, taker decimal.Decimal
+}
+
+func (f flatFees) FeeRates(uuid.UUID) (maker, taker decimal.Decimal) {
+	return f.maker, f.taker
+}
+
+func TestChargeFees(t *testing.T) {
+	rates := flatFees{maker: decimal.RequireFromString("0.001"), taker: decimal.RequireFromString("0.002")}
+
+	tests := []struct {
+		name          string
+		fees          Fees
+		buyerMaker    bool
+		quantity      string
+		quoteQuantity string
+		buyerFee      string
+		sellerFee     string
+	}{
+		{"taker buyer, maker seller", rates, false, "2", "200", "0.004", "0.2"},
+		{"maker buyer, taker seller", rates, true, "2", "200", "0.002", "0.4"},
+		{"rounded up to the fee precision", rates, false, "0.00000003", "0.0000030001", "0.00000001", "0.00000001"},
+		{"exact fees are not rounded", rates, false, "0.005", "0.5", "0.00001", "0.0005"},
+		{"no fees", NoFees{}, false, "2", "200", "0", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("BTC", "USD")
+			book.Fees = tt.fees
+			trade := models.Trade{
+				IsBuyerMaker:  tt.buyerMaker,
+				Quantity:      decimal.RequireFromString(tt.quantity),
+				QuoteQuantity: decimal.RequireFromString(tt.quoteQuantity),
+			}
+
+			book.chargeFees(&trade)
+
+			if trade.BuyerFee == nil || !trade.BuyerFee.Equal(decimal.RequireFromString(tt.buyerFee)) {
+				t.Errorf("buyer fee: got %v, want %s", trade.BuyerFee, tt.buyerFee)
+			}
+			if trade.SellerFee == nil || !trade.SellerFee.Equal(decimal.RequireFromString(tt.sellerFee)) {
+				t.Errorf("seller fee: got %v, want %s", trade.SellerFee, tt.sellerFee)
+			}
+		})
+	}
+}
+
+func TestMatchingChargesTakerFee(t *testing.T) {
+	tests := []struct {
+		name      string
+		incoming  models.OrderSide
+		buyerFee  string
+		sellerFee string
+	}{
+		{"incoming buy takes", models.BUY, "0.002", "0.1"},
+		{"incoming sell takes", models.SELL, "0.001", "0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("BTC", "USD")
+			book.Fees = flatFees{maker: decimal.RequireFromString("0.001"), taker: decimal.RequireFromString("0.002")}
+
+			resting := models.SELL
+			if tt.incoming == models.SELL {
+				resting = models.BUY
+			}
+			book.AddOrder(testOrder(resting, "100", "1"))
+			result := book.AddOrder(testOrder(tt.incoming, "100", "1"))
+
+			if len(result.GeneratedTrades) != 1 {
+				t.Fatalf("got %d trades, want 1", len(result.GeneratedTrades))
+			}
+			trade := result.GeneratedTrades[0]
+			if !trade.BuyerFee.Equal(decimal.RequireFromString(tt.buyerFee)) || !trade.SellerFee.Equal(decimal.RequireFromString(tt.sellerFee)) {
+				t.Errorf("got fees %s and %s, want %s and %s", trade.BuyerFee, trade.SellerFee, tt.buyerFee, tt.sellerFee)
+			}
+		})
+	}
+}
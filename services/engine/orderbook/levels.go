@@ -0,0 +1,296 @@
+package orderbook
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// PriceLevel holds every resting order at one price in time priority, oldest first
+type PriceLevel struct {
+	Price  decimal.Decimal
+	Orders *list.List // of *models.Order
+}
+
+// BookSide is one side of an orderbook. Price levels live in a balanced tree so
+// that adding or dropping a level is O(log n) in the number of levels, and the
+// best level is cached. Each order is indexed by ID to its place in its level's
+// queue, so cancelling or requeueing an order never scans the book.
+type BookSide struct {
+	side   models.OrderSide
+	root   *levelNode
+	best   *PriceLevel
+	orders map[uuid.UUID]queuePosition
+
+	// Resting GTD orders, so expiry checks don't walk the whole side
+	expiring map[uuid.UUID]*models.Order
+}
+
+type queuePosition struct {
+	level   *PriceLevel
+	element *list.Element
+}
+
+func newBookSide(side models.OrderSide) *BookSide {
+	return &BookSide{
+		side:     side,
+		orders:   make(map[uuid.UUID]queuePosition),
+		expiring: make(map[uuid.UUID]*models.Order),
+	}
+}
+
+// Len returns the number of resting orders on this side
+func (s *BookSide) Len() int {
+	return len(s.orders)
+}
+
+// Best returns the level with the best price (highest bid, lowest ask), or nil
+// if the side is empty
+func (s *BookSide) Best() *PriceLevel {
+	return s.best
+}
+
+// Front returns the order first in line: the oldest order at the best price
+func (s *BookSide) Front() *models.Order {
+	if s.best == nil {
+		return nil
+	}
+	return s.best.Orders.Front().Value.(*models.Order)
+}
+
+// Get returns a resting order by ID
+func (s *BookSide) Get(orderID uuid.UUID) (*models.Order, bool) {
+	position, exists := s.orders[orderID]
+	if !exists {
+		return nil, false
+	}
+	return position.element.Value.(*models.Order), true
+}
+
+// Push adds an order to the back of the queue at its price
+func (s *BookSide) Push(order *models.Order) {
+	level := s.find(*order.Price)
+	if level == nil {
+		level = &PriceLevel{Price: *order.Price, Orders: list.New()}
+		s.root = insertLevel(s.root, level)
+		s.updateBest()
+	}
+
+	s.orders[order.ID] = queuePosition{level: level, element: level.Orders.PushBack(order)}
+	if order.TimeInForce == models.GTD && order.ExpiresAt != nil {
+		s.expiring[order.ID] = order
+	}
+}
+
+// Remove takes an order off this side, dropping its price level if it was the last order there
+func (s *BookSide) Remove(orderID uuid.UUID) (*models.Order, bool) {
+	position, exists := s.orders[orderID]
+	if !exists {
+		return nil, false
+	}
+
+	position.level.Orders.Remove(position.element)
+	delete(s.orders, orderID)
+	delete(s.expiring, orderID)
+
+	if position.level.Orders.Len() == 0 {
+		s.root = deleteLevel(s.root, position.level.Price)
+		s.updateBest()
+	}
+
+	return position.element.Value.(*models.Order), true
+}
+
+// Requeue sends an order to the back of the queue at its price, losing time priority
+func (s *BookSide) Requeue(orderID uuid.UUID) {
+	if position, exists := s.orders[orderID]; exists {
+		position.level.Orders.MoveToBack(position.element)
+	}
+}
+
+// Expiring returns the resting GTD orders on this side, soonest expiry first. The
+// order is fixed so that replaying the same commands expires orders the same way.
+func (s *BookSide) Expiring() []*models.Order {
+	orders := make([]*models.Order, 0, len(s.expiring))
+	for _, order := range s.expiring {
+		orders = append(orders, order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].ExpiresAt.Equal(*orders[j].ExpiresAt) {
+			return orders[i].ExpiresAt.Before(*orders[j].ExpiresAt)
+		}
+		return bytes.Compare(orders[i].ID[:], orders[j].ID[:]) < 0
+	})
+	return orders
+}
+
+// EachLevel calls fn for every price level, best price first, until fn returns false
+func (s *BookSide) EachLevel(fn func(level *PriceLevel) bool) {
+	s.walk(s.root, fn)
+}
+
+// Each calls fn for every resting order in matching priority until fn returns false
+func (s *BookSide) Each(fn func(order *models.Order) bool) {
+	s.EachLevel(func(level *PriceLevel) bool {
+		for element := level.Orders.Front(); element != nil; element = element.Next() {
+			if !fn(element.Value.(*models.Order)) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s *BookSide) walk(node *levelNode, fn func(level *PriceLevel) bool) bool {
+	if node == nil {
+		return true
+	}
+
+	// The tree is ordered by ascending price: asks walk it forwards, bids backwards
+	first, second := node.left, node.right
+	if s.side == models.BUY {
+		first, second = node.right, node.left
+	}
+
+	return s.walk(first, fn) && fn(node.level) && s.walk(second, fn)
+}
+
+func (s *BookSide) find(price decimal.Decimal) *PriceLevel {
+	node := s.root
+	for node != nil {
+		switch price.Cmp(node.level.Price) {
+		case -1:
+			node = node.left
+		case 1:
+			node = node.right
+		default:
+			return node.level
+		}
+	}
+	return nil
+}
+
+func (s *BookSide) updateBest() {
+	node := s.root
+	if node == nil {
+		s.best = nil
+		return
+	}
+
+	for {
+		next := node.left
+		if s.side == models.BUY {
+			next = node.right
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	s.best = node.level
+}
+
+// levelNode is a node of an AVL tree of price levels keyed by price
+type levelNode struct {
+	level  *PriceLevel
+	left   *levelNode
+	right  *levelNode
+	height int
+}
+
+func nodeHeight(node *levelNode) int {
+	if node == nil {
+		return 0
+	}
+	return node.height
+}
+
+func (n *levelNode) updateHeight() {
+	n.height = 1 + max(nodeHeight(n.left), nodeHeight(n.right))
+}
+
+func rotateRight(node *levelNode) *levelNode {
+	left := node.left
+	node.left = left.right
+	left.right = node
+	node.updateHeight()
+	left.updateHeight()
+	return left
+}
+
+func rotateLeft(node *levelNode) *levelNode {
+	right := node.right
+	node.right = right.left
+	right.left = node
+	node.updateHeight()
+	right.updateHeight()
+	return right
+}
+
+func rebalance(node *levelNode) *levelNode {
+	node.updateHeight()
+
+	switch balance := nodeHeight(node.left) - nodeHeight(node.right); {
+	case balance > 1:
+		if nodeHeight(node.left.left) < nodeHeight(node.left.right) {
+			node.left = rotateLeft(node.left)
+		}
+		return rotateRight(node)
+	case balance < -1:
+		if nodeHeight(node.right.right) < nodeHeight(node.right.left) {
+			node.right = rotateRight(node.right)
+		}
+		return rotateLeft(node)
+	}
+
+	return node
+}
+
+func insertLevel(node *levelNode, level *PriceLevel) *levelNode {
+	if node == nil {
+		return &levelNode{level: level, height: 1}
+	}
+
+	if level.Price.LessThan(node.level.Price) {
+		node.left = insertLevel(node.left, level)
+	} else {
+		node.right = insertLevel(node.right, level)
+	}
+
+	return rebalance(node)
+}
+
+func deleteLevel(node *levelNode, price decimal.Decimal) *levelNode {
+	if node == nil {
+		return nil
+	}
+
+	switch price.Cmp(node.level.Price) {
+	case -1:
+		node.left = deleteLevel(node.left, price)
+	case 1:
+		node.right = deleteLevel(node.right, price)
+	default:
+		if node.left == nil {
+			return node.right
+		}
+		if node.right == nil {
+			return node.left
+		}
+
+		// Replace with the next higher level and delete that one from the right subtree
+		successor := node.right
+		for successor.left != nil {
+			successor = successor.left
+		}
+		node.level = successor.level
+		node.right = deleteLevel(node.right, successor.level.Price)
+	}
+
+	return rebalance(node)
+}
@@ -0,0 +1,159 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/shopspring/decimal"
+)
+
+// checkTree fails the test unless the tree under node is a valid AVL tree: keys in
+// order, heights correct and every node balanced. It returns the prices in order.
+func checkTree(t *testing.T, node *levelNode) []decimal.Decimal {
+	t.Helper()
+	if node == nil {
+		return nil
+	}
+
+	left := checkTree(t, node.left)
+	right := checkTree(t, node.right)
+
+	if want := 1 + max(nodeHeight(node.left), nodeHeight(node.right)); node.height != want {
+		t.Fatalf("node %s has height %d, want %d", node.level.Price, node.height, want)
+	}
+	if balance := nodeHeight(node.left) - nodeHeight(node.right); balance < -1 || balance > 1 {
+		t.Fatalf("node %s is unbalanced by %d", node.level.Price, balance)
+	}
+
+	prices := append(append(left, node.level.Price), right...)
+	for i := 1; i < len(prices); i++ {
+		if !prices[i-1].LessThan(prices[i]) {
+			t.Fatalf("prices out of order: %s before %s", prices[i-1], prices[i])
+		}
+	}
+	return prices
+}
+
+func TestLevelTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		inserts []int64
+		deletes []int64
+		want    []int64
+		height  int
+	}{
+		{"ascending inserts rotate left", []int64{1, 2, 3, 4, 5, 6, 7}, nil, []int64{1, 2, 3, 4, 5, 6, 7}, 3},
+		{"descending inserts rotate right", []int64{7, 6, 5, 4, 3, 2, 1}, nil, []int64{1, 2, 3, 4, 5, 6, 7}, 3},
+		{"left-right case", []int64{30, 10, 20}, nil, []int64{10, 20, 30}, 2},
+		{"right-left case", []int64{10, 30, 20}, nil, []int64{10, 20, 30}, 2},
+		{"delete a leaf", []int64{2, 1, 3}, []int64{3}, []int64{1, 2}, 2},
+		{"delete the root with two children", []int64{4, 2, 6, 1, 3, 5, 7}, []int64{4}, []int64{1, 2, 3, 5, 6, 7}, 3},
+		{"deletes that unbalance the tree", []int64{4, 2, 6, 1, 3, 5, 7, 8}, []int64{1, 3, 2}, []int64{4, 5, 6, 7, 8}, 3},
+		{"delete a missing price", []int64{1, 2}, []int64{5}, []int64{1, 2}, 2},
+		{"delete everything", []int64{1, 2, 3}, []int64{2, 1, 3}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root *levelNode
+			for _, price := range tt.inserts {
+				root = insertLevel(root, &PriceLevel{Price: decimal.NewFromInt(price)})
+				checkTree(t, root)
+			}
+			for _, price := range tt.deletes {
+				root = deleteLevel(root, decimal.NewFromInt(price))
+				checkTree(t, root)
+			}
+
+			prices := checkTree(t, root)
+			if len(prices) != len(tt.want) {
+				t.Fatalf("got %d levels, want %d", len(prices), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !prices[i].Equal(decimal.NewFromInt(want)) {
+					t.Errorf("level %d: got %s, want %d", i, prices[i], want)
+				}
+			}
+			if nodeHeight(root) != tt.height {
+				t.Errorf("height: got %d, want %d", nodeHeight(root), tt.height)
+			}
+		})
+	}
+}
+
+func TestLevelTreeStaysBalanced(t *testing.T) {
+	var root *levelNode
+	for price := int64(1); price <= 1000; price++ {
+		root = insertLevel(root, &PriceLevel{Price: decimal.NewFromInt(price)})
+	}
+	// An AVL tree of n nodes is at most about 1.44 log2(n) high
+	if height := nodeHeight(root); height > 14 {
+		t.Fatalf("1000 levels are %d high", height)
+	}
+
+	for price := int64(1); price <= 1000; price += 2 {
+		root = deleteLevel(root, decimal.NewFromInt(price))
+	}
+	if prices := checkTree(t, root); len(prices) != 500 {
+		t.Fatalf("got %d levels after deleting half, want 500", len(prices))
+	}
+}
+
+func TestBookSideBest(t *testing.T) {
+	tests := []struct {
+		name    string
+		side    models.OrderSide
+		prices  []string
+		removed int
+		best    string
+	}{
+		{"highest bid", models.BUY, []string{"99", "101", "100"}, -1, "101"},
+		{"lowest ask", models.SELL, []string{"101", "99", "100"}, -1, "99"},
+		{"next bid once the best is gone", models.BUY, []string{"99", "101", "100"}, 1, "100"},
+		{"next ask once the best is gone", models.SELL, []string{"101", "99", "100"}, 1, "100"},
+		{"empty once the last is gone", models.SELL, []string{"100"}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			side := newBookSide(tt.side)
+			orders := []*models.Order{}
+			for _, price := range tt.prices {
+				order := testOrder(tt.side, price, "1")
+				side.Push(order)
+				orders = append(orders, order)
+			}
+			if tt.removed >= 0 {
+				side.Remove(orders[tt.removed].ID)
+			}
+
+			best := side.Best()
+			switch {
+			case tt.best == "" && best != nil:
+				t.Errorf("got best %s, want none", best.Price)
+			case tt.best != "" && (best == nil || !best.Price.Equal(decimal.RequireFromString(tt.best))):
+				t.Errorf("got best %v, want %s", best, tt.best)
+			}
+		})
+	}
+}
+
+func TestBookSideTimePriority(t *testing.T) {
+	side := newBookSide(models.SELL)
+	first := testOrder(models.SELL, "100", "1")
+	second := testOrder(models.SELL, "100", "1")
+	side.Push(first)
+	side.Push(second)
+
+	if side.Front() != first {
+		t.Fatal("front is not the oldest order")
+	}
+	side.Requeue(first.ID)
+	if side.Front() != second {
+		t.Fatal("requeued order kept its priority")
+	}
+	side.Remove(second.ID)
+	if side.Front() != first || side.Len() != 1 {
+		t.Fatal("removing an order lost the rest of its level")
+	}
+}
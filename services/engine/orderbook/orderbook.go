@@ -1,6 +1,7 @@
 package orderbook
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,34 +9,83 @@ import (
 	"github.com/KshitijBhardwaj18/Orbix/shared/models"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
-
-	"sort"
 )
 
 // MatchingResult contains all the changes that happened during order processing
 type MatchingResult struct {
-	IncomingOrder    *models.Order   `json:"incoming_order"`
-	UpdatedOrders    []*models.Order `json:"updated_orders"`    // Orders that were modified
-	GeneratedTrades  []models.Trade  `json:"generated_trades"`  // Trades that happened
-	RemovedOrderIDs  []uuid.UUID     `json:"removed_order_ids"` // Orders that were filled and removed
+	IncomingOrder   *models.Order   `json:"incoming_order"`
+	UpdatedOrders   []*models.Order `json:"updated_orders"`    // Orders that were modified
+	GeneratedTrades []models.Trade  `json:"generated_trades"`  // Trades that happened
+	RemovedOrderIDs []uuid.UUID     `json:"removed_order_ids"` // Orders that were filled and removed
+	StopReason      string          `json:"stop_reason"`       // Why the incoming order stopped matching
+	Repriced        bool            `json:"repriced"`          // Post-only order was moved behind the best opposite price
+}
+
+// Reasons reported in MatchingResult.StopReason
+const (
+	StopReasonFilled          = "FILLED"               // Incoming order was filled in full
+	StopReasonBookExhausted   = "BOOK_EXHAUSTED"       // No more liquidity on the opposite side
+	StopReasonPriceLimit      = "PRICE_LIMIT"          // Next level is beyond the limit price
+	StopReasonPriceProtection = "PRICE_PROTECTION"     // Next level is beyond a market order's protection price
+	StopReasonFillOrKill      = "FOK_UNFILLABLE"       // FOK order rejected before matching, not enough liquidity
+	StopReasonPostOnly        = "POST_ONLY_CROSS"      // Post-only order rejected because it would take liquidity
+	StopReasonSelfTrade       = "SELF_TRADE_PREVENTED" // Next resting order belongs to the same user
+)
+
+// Reason set on a post-only order the book moved to avoid taking liquidity
+const PostOnlyRepriced = "POST_ONLY_REPRICED"
+
+// Errors returned by ModifyOrder. The order is left untouched when any of them is returned.
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidAmendPrice = errors.New("price must be positive")
+	ErrInvalidAmendSize  = errors.New("quantity must be above the filled quantity")
+	ErrAmendPostOnly     = errors.New("new price would take liquidity on a post-only order")
+)
+
+// DefaultTickSize is the price increment used when repricing post-only orders
+var DefaultTickSize = decimal.New(1, -8)
+
+// Clock supplies the time and IDs the book stamps on orders and trades
+type Clock interface {
+	Now() time.Time
+	NewID() uuid.UUID
+}
+
+// SystemClock is the wall clock and random IDs
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) NewID() uuid.UUID {
+	return uuid.New()
 }
 
 type OrderBook struct {
 	BaseAsset    string
 	QuoteAsset   string
-	Bids         []*models.Order
-	Asks         []*models.Order
+	Bids         *BookSide
+	Asks         *BookSide
 	LastTradeId  string
 	CurrentPrice decimal.Decimal
+	TickSize     decimal.Decimal
+	Clock        Clock
+	Fees         Fees
+	Auction      bool // In a call auction: orders rest without matching until Uncross
 }
 
 func NewOrderBook(BaseAsset, QuoteAsset string) *OrderBook {
 	orderbook := OrderBook{BaseAsset: BaseAsset,
 		QuoteAsset:   QuoteAsset,
-		Bids:         []*models.Order{},
-		Asks:         []*models.Order{},
+		Bids:         newBookSide(models.BUY),
+		Asks:         newBookSide(models.SELL),
 		LastTradeId:  "nil",
 		CurrentPrice: decimal.Zero,
+		TickSize:     DefaultTickSize,
+		Clock:        SystemClock{},
+		Fees:         NoFees{},
 	}
 	return &orderbook
 }
@@ -44,24 +94,27 @@ func (o *OrderBook) GetTicker() string {
 	return fmt.Sprintf("%s/%s", o.BaseAsset, o.QuoteAsset)
 }
 
-// sortBids sorts bids by price (highest first), then by time (oldest first)
-func (o *OrderBook) sortBids() {
-	sort.Slice(o.Bids, func(i, j int) bool {
-		if o.Bids[i].Price.Equal(*o.Bids[j].Price) {
-			return o.Bids[i].CreatedAt.Before(o.Bids[j].CreatedAt)
-		}
-		return o.Bids[i].Price.GreaterThan(*o.Bids[j].Price)
-	})
+// bookSide returns the side of the book orders of the given side rest on
+func (o *OrderBook) bookSide(side models.OrderSide) *BookSide {
+	if side == models.BUY {
+		return o.Bids
+	}
+	return o.Asks
 }
 
-// sortAsks sorts asks by price (lowest first), then by time (oldest first)
-func (o *OrderBook) sortAsks() {
-	sort.Slice(o.Asks, func(i, j int) bool {
-		if o.Asks[i].Price.Equal(*o.Asks[j].Price) {
-			return o.Asks[i].CreatedAt.Before(o.Asks[j].CreatedAt)
-		}
-		return o.Asks[i].Price.LessThan(*o.Asks[j].Price)
-	})
+// visibleQuantity is how much of a resting order the book shows and lets a single
+// pass of the matching loop take. Only icebergs show less than their remainder.
+func visibleQuantity(order *models.Order) decimal.Decimal {
+	if order.DisplayQuantity == nil {
+		return order.RemainingQuantity
+	}
+	return order.VisibleQuantity
+}
+
+// refillIceberg shows the next slice of an iceberg from its hidden reserve. A
+// refill of a resting iceberg must also go to the back of the queue at its price.
+func refillIceberg(order *models.Order) {
+	order.VisibleQuantity = decimal.Min(*order.DisplayQuantity, order.RemainingQuantity)
 }
 
 func (o *OrderBook) AddOrder(order *models.Order) *MatchingResult {
@@ -72,164 +125,557 @@ func (o *OrderBook) AddOrder(order *models.Order) *MatchingResult {
 		RemovedOrderIDs: []uuid.UUID{},
 	}
 
-	if order.Side == "BUY" {
-		o.matchBid(order, result)
-		if order.FilledQuantity.Equal(order.Quantity) {
-			order.Status = models.FILLED
-		} else if order.FilledQuantity.GreaterThan(decimal.Zero) {
-			order.Status = models.PARTIAL
+	// A call auction only collects orders; Uncross matches them all at once
+	if o.Auction {
+		if order.Price == nil {
+			order.Status = models.REJECTED
+			order.StatusReason = StopReasonAuctionPrice
+			result.StopReason = StopReasonAuctionPrice
+			return result
 		}
-		
-		// Only add to orderbook if not fully filled
-		if order.Status != models.FILLED {
-			o.Bids = append(o.Bids, order)
-			o.sortBids()
+		o.RestOrder(order)
+		return result
+	}
+
+	// Post-only orders are resolved before matching so they can never take liquidity
+	if order.PostOnly != "" && o.WouldCross(order) {
+		if order.PostOnly == models.POST_ONLY_REJECT || !o.repricePostOnly(order) {
+			order.Status = models.REJECTED
+			order.StatusReason = StopReasonPostOnly
+			result.StopReason = StopReasonPostOnly
+			return result
 		}
+		order.StatusReason = PostOnlyRepriced
+		result.Repriced = true
+	}
+
+	// Fill-or-kill is checked against the book before anything is touched
+	if order.TimeInForce == models.FOK && order.RemainingQuantity.GreaterThan(o.availableLiquidity(order)) {
+		order.Status = models.REJECTED
+		order.StatusReason = StopReasonFillOrKill
+		result.StopReason = StopReasonFillOrKill
+		return result
+	}
+
+	if order.Side == models.BUY {
+		o.matchBid(order, result)
 	} else {
 		o.matchAsk(order, result)
-		if order.FilledQuantity.Equal(order.Quantity) {
-			order.Status = models.FILLED
-		} else if order.FilledQuantity.GreaterThan(decimal.Zero) {
-			order.Status = models.PARTIAL
-		}
-		
-		// Only add to orderbook if not fully filled
+	}
+
+	if order.FilledQuantity.Equal(order.Quantity) {
+		order.Status = models.FILLED
+	} else if order.FilledQuantity.GreaterThan(decimal.Zero) {
+		order.Status = models.PARTIAL
+	}
+
+	// Self-trade prevention cancelled whatever was left of the incoming order
+	if result.StopReason == StopReasonSelfTrade {
+		order.Status = models.CANCELLED
+		order.StatusReason = StopReasonSelfTrade
+		return result
+	}
+
+	// Market and IOC orders never rest: whatever the sweep could not fill is cancelled
+	if order.Type == models.MARKET || order.TimeInForce == models.IOC || order.TimeInForce == models.FOK {
 		if order.Status != models.FILLED {
-			o.Asks = append(o.Asks, order)
-			o.sortAsks()
+			order.Status = models.CANCELLED
+			order.StatusReason = result.StopReason
+		}
+		return result
+	}
+
+	// Only add to orderbook if not fully filled
+	if order.Status != models.FILLED {
+		if order.DisplayQuantity != nil {
+			refillIceberg(order)
 		}
+		o.bookSide(order.Side).Push(order)
 	}
 
 	return result
 }
 
-func (o *OrderBook) matchBid(order *models.Order, result *MatchingResult) {
-	// Sort asks to ensure best prices (lowest) are matched first
-	o.sortAsks()
-	
-	for i := 0; i < len(o.Asks); i++ {
-		if o.Asks[i].Price.LessThanOrEqual(*order.Price) && order.RemainingQuantity.GreaterThan(decimal.Zero) {
-			filledQuantity := decimal.Min(o.Asks[i].RemainingQuantity, order.RemainingQuantity)
-
-			order.FilledQuantity = order.FilledQuantity.Add(filledQuantity)
-			order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
-
-			o.Asks[i].FilledQuantity = o.Asks[i].FilledQuantity.Add(filledQuantity)
-			o.Asks[i].RemainingQuantity = o.Asks[i].Quantity.Sub(o.Asks[i].FilledQuantity)
-
-			// Update ask order status
-			if o.Asks[i].RemainingQuantity.Equal(decimal.Zero) {
-				o.Asks[i].Status = models.FILLED
-				result.RemovedOrderIDs = append(result.RemovedOrderIDs, o.Asks[i].ID)
-			} else if o.Asks[i].FilledQuantity.GreaterThan(decimal.Zero) {
-				o.Asks[i].Status = models.PARTIAL
-			}
+// priceLimit returns the worst price the order is allowed to trade at, along with
+// the stop reason to report when the sweep reaches it. A market order without a
+// protection price has no limit and sweeps until filled or the book is exhausted.
+func priceLimit(order *models.Order) (*decimal.Decimal, string) {
+	if order.Type == models.MARKET {
+		return order.ProtectionPrice, StopReasonPriceProtection
+	}
+	return order.Price, StopReasonPriceLimit
+}
+
+// BestBid returns the highest resting bid price, or nil if there are no bids
+func (o *OrderBook) BestBid() *decimal.Decimal {
+	return bestPrice(o.Bids)
+}
 
-			// Track this order was updated
-			result.UpdatedOrders = append(result.UpdatedOrders, o.Asks[i])
-
-			trade := models.Trade{
-				ID:            uuid.New(),
-				MarketID:      order.MarketID,
-				BuyerID:       order.UserID,
-				SellerID:      o.Asks[i].UserID,
-				BuyerOrderID:  order.ID,
-				SellerOrderID: o.Asks[i].ID,
-				Price:         *o.Asks[i].Price, // Trade happens at the maker's price (ask price)
-				IsBuyerMaker:  false, // Incoming buy order is the taker, existing ask is the maker
-				Quantity:      filledQuantity,
-				QuoteQuantity: o.Asks[i].Price.Mul(filledQuantity),
-				CreatedAt:     time.Now(),
+// BestAsk returns the lowest resting ask price, or nil if there are no asks
+func (o *OrderBook) BestAsk() *decimal.Decimal {
+	return bestPrice(o.Asks)
+}
+
+func bestPrice(side *BookSide) *decimal.Decimal {
+	best := side.Best()
+	if best == nil {
+		return nil
+	}
+	price := best.Price
+	return &price
+}
+
+// WouldCross reports whether a limit order would trade immediately on arrival
+func (o *OrderBook) WouldCross(order *models.Order) bool {
+	if order.Price == nil {
+		return false
+	}
+	if order.Side == models.BUY {
+		bestAsk := o.BestAsk()
+		return bestAsk != nil && order.Price.GreaterThanOrEqual(*bestAsk)
+	}
+	bestBid := o.BestBid()
+	return bestBid != nil && order.Price.LessThanOrEqual(*bestBid)
+}
+
+// repricePostOnly moves a crossing post-only order one tick behind the best opposite
+// price. It returns false if that would leave the order without a valid price.
+func (o *OrderBook) repricePostOnly(order *models.Order) bool {
+	var price decimal.Decimal
+	if order.Side == models.BUY {
+		price = o.BestAsk().Sub(o.TickSize)
+	} else {
+		price = o.BestBid().Add(o.TickSize)
+	}
+
+	if price.LessThanOrEqual(decimal.Zero) {
+		return false
+	}
+
+	order.Price = &price
+	return true
+}
+
+// availableLiquidity sums the opposite side quantity the order could trade against
+// without breaching its limit or protection price. It stops counting as soon as it
+// has seen enough to fill the order. The user's own orders never count, and unless
+// self-trade prevention cancels them out of the way they end the count.
+func (o *OrderBook) availableLiquidity(order *models.Order) decimal.Decimal {
+	limit, _ := priceLimit(order)
+	available := decimal.Zero
+
+	if order.Side == models.BUY {
+		o.Asks.Each(func(ask *models.Order) bool {
+			if (limit != nil && ask.Price.GreaterThan(*limit)) || available.GreaterThanOrEqual(order.RemainingQuantity) {
+				return false
+			}
+			if ask.UserID == order.UserID {
+				return order.SelfTradePrevention == models.STP_CANCEL_OLDEST
+			}
+			available = available.Add(ask.RemainingQuantity)
+			return true
+		})
+	} else {
+		o.Bids.Each(func(bid *models.Order) bool {
+			if (limit != nil && bid.Price.LessThan(*limit)) || available.GreaterThanOrEqual(order.RemainingQuantity) {
+				return false
+			}
+			if bid.UserID == order.UserID {
+				return order.SelfTradePrevention == models.STP_CANCEL_OLDEST
 			}
+			available = available.Add(bid.RemainingQuantity)
+			return true
+		})
+	}
 
-			// Track this trade was generated
-			result.GeneratedTrades = append(result.GeneratedTrades, trade)
-			order.Trades = append(order.Trades, trade)
-			o.CurrentPrice = trade.Price
-			o.LastTradeId = trade.ID.String()
+	return available
+}
+
+// SweepPrice returns the furthest price the order would trade at if it arrived
+// now, or nil if it would not trade. Like availableLiquidity it stops at the
+// order's limit or protection price and at the user's own orders.
+func (o *OrderBook) SweepPrice(order *models.Order) *decimal.Decimal {
+	limit, _ := priceLimit(order)
+	filled := decimal.Zero
+	var sweep *decimal.Decimal
+
+	side := o.Asks
+	beyond := func(price decimal.Decimal) bool { return limit != nil && price.GreaterThan(*limit) }
+	if order.Side == models.SELL {
+		side = o.Bids
+		beyond = func(price decimal.Decimal) bool { return limit != nil && price.LessThan(*limit) }
+	}
+
+	side.Each(func(resting *models.Order) bool {
+		if beyond(*resting.Price) || filled.GreaterThanOrEqual(order.RemainingQuantity) {
+			return false
 		}
+		if resting.UserID == order.UserID {
+			return order.SelfTradePrevention == models.STP_CANCEL_OLDEST
+		}
+		price := *resting.Price
+		sweep = &price
+		filled = filled.Add(resting.RemainingQuantity)
+		return true
+	})
+
+	return sweep
+}
+
+// SweepCost returns what the order would pay in the quote asset, or receive for a
+// sell, if it arrived now. Unlike SweepPrice it follows self-trade prevention past
+// the user's own orders the way matching does.
+func (o *OrderBook) SweepCost(order *models.Order) decimal.Decimal {
+	cost, _ := o.sweep(order, nil)
+	return cost
+}
+
+// AffordableQuantity returns how much of the order the budget, in the quote asset,
+// would buy if it arrived now
+func (o *OrderBook) AffordableQuantity(order *models.Order, budget decimal.Decimal) decimal.Decimal {
+	_, quantity := o.sweep(order, &budget)
+	return quantity
+}
+
+// sweep walks the opposite side like the matching loop and returns the quote value
+// and quantity the order would trade, stopping early once budget is spent
+func (o *OrderBook) sweep(order *models.Order, budget *decimal.Decimal) (cost, quantity decimal.Decimal) {
+	limit, _ := priceLimit(order)
+	remaining := order.RemainingQuantity
+
+	side := o.Asks
+	beyond := func(price decimal.Decimal) bool { return limit != nil && price.GreaterThan(*limit) }
+	if order.Side == models.SELL {
+		side = o.Bids
+		beyond = func(price decimal.Decimal) bool { return limit != nil && price.LessThan(*limit) }
 	}
 
-	// Remove fully filled ask orders
-	for i := len(o.Asks) - 1; i >= 0; i-- {
-		if o.Asks[i].RemainingQuantity.Equal(decimal.Zero) {
-			o.Asks = append(o.Asks[:i], o.Asks[i+1:]...)
+	side.Each(func(resting *models.Order) bool {
+		if !remaining.IsPositive() || beyond(*resting.Price) {
+			return false
 		}
+
+		if resting.UserID == order.UserID {
+			switch order.SelfTradePrevention {
+			case models.STP_CANCEL_OLDEST:
+				return true
+			case models.STP_DECREMENT_AND_CANCEL:
+				if resting.RemainingQuantity.GreaterThanOrEqual(remaining) {
+					return false
+				}
+				remaining = remaining.Sub(resting.RemainingQuantity)
+				return true
+			}
+			return false
+		}
+
+		take := decimal.Min(resting.RemainingQuantity, remaining)
+		if budget != nil {
+			if affordable := budget.Sub(cost).Div(*resting.Price); affordable.LessThan(take) {
+				take = affordable
+				remaining = take
+			}
+		}
+
+		cost = cost.Add(resting.Price.Mul(take))
+		quantity = quantity.Add(take)
+		remaining = remaining.Sub(take)
+		return true
+	})
+
+	return cost, quantity
+}
+
+// preventSelfTrade resolves an incoming order meeting a resting order of the same
+// user, following the incoming order's self-trade prevention mode. Resting orders it
+// cancels or shrinks are reported in the result. It returns false once the incoming
+// order must stop matching and be cancelled.
+func (o *OrderBook) preventSelfTrade(order *models.Order, resting *models.Order, result *MatchingResult) bool {
+	switch order.SelfTradePrevention {
+	case models.STP_CANCEL_OLDEST:
+		o.cancelSelfTrade(resting, result)
+		return true
+
+	case models.STP_CANCEL_BOTH:
+		o.cancelSelfTrade(resting, result)
+		return false
+
+	case models.STP_DECREMENT_AND_CANCEL:
+		incomingQuantity, restingQuantity := order.RemainingQuantity, resting.RemainingQuantity
+
+		if restingQuantity.LessThanOrEqual(incomingQuantity) {
+			o.cancelSelfTrade(resting, result)
+		} else {
+			decrementQuantity(resting, incomingQuantity, o.Clock.Now())
+			result.UpdatedOrders = append(result.UpdatedOrders, resting)
+		}
+
+		if incomingQuantity.LessThanOrEqual(restingQuantity) {
+			return false
+		}
+		decrementQuantity(order, restingQuantity, o.Clock.Now())
+		return true
+
+	default:
+		return false
 	}
 }
 
-func (o *OrderBook) matchAsk(order *models.Order, result *MatchingResult) {
-	// Sort bids to ensure best prices (highest) are matched first
-	o.sortBids()
-	
-	for i := 0; i < len(o.Bids); i++ {
-		if o.Bids[i].Price.GreaterThanOrEqual(*order.Price) && order.RemainingQuantity.GreaterThan(decimal.Zero) {
-			filledQuantity := decimal.Min(o.Bids[i].RemainingQuantity, order.RemainingQuantity)
-
-			order.FilledQuantity = order.FilledQuantity.Add(filledQuantity)
-			order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
-
-			o.Bids[i].FilledQuantity = o.Bids[i].FilledQuantity.Add(filledQuantity)
-			o.Bids[i].RemainingQuantity = o.Bids[i].Quantity.Sub(o.Bids[i].FilledQuantity)
-
-			// Update bid order status
-			if o.Bids[i].RemainingQuantity.Equal(decimal.Zero) {
-				o.Bids[i].Status = models.FILLED
-				result.RemovedOrderIDs = append(result.RemovedOrderIDs, o.Bids[i].ID)
-			} else if o.Bids[i].FilledQuantity.GreaterThan(decimal.Zero) {
-				o.Bids[i].Status = models.PARTIAL
+// cancelSelfTrade takes a resting order out of the book as cancelled by self-trade prevention
+func (o *OrderBook) cancelSelfTrade(resting *models.Order, result *MatchingResult) {
+	resting.Status = models.CANCELLED
+	resting.StatusReason = StopReasonSelfTrade
+	resting.UpdatedAt = o.Clock.Now()
+
+	o.bookSide(resting.Side).Remove(resting.ID)
+
+	result.UpdatedOrders = append(result.UpdatedOrders, resting)
+	result.RemovedOrderIDs = append(result.RemovedOrderIDs, resting.ID)
+}
+
+// decrementQuantity shrinks an order without trading it, keeping its fills
+func decrementQuantity(order *models.Order, quantity decimal.Decimal, now time.Time) {
+	order.Quantity = order.Quantity.Sub(quantity)
+	order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
+	if order.DisplayQuantity != nil {
+		order.VisibleQuantity = decimal.Min(order.VisibleQuantity, order.RemainingQuantity)
+	}
+	order.UpdatedAt = now
+}
+
+func (o *OrderBook) matchBid(order *models.Order, result *MatchingResult) {
+	limit, limitReason := priceLimit(order)
+
+	for order.RemainingQuantity.GreaterThan(decimal.Zero) {
+		// Best price first, oldest first within a price
+		ask := o.Asks.Front()
+		if ask == nil {
+			result.StopReason = StopReasonBookExhausted
+			return
+		}
+		if limit != nil && ask.Price.GreaterThan(*limit) {
+			result.StopReason = limitReason
+			return
+		}
+
+		if ask.UserID == order.UserID {
+			if !o.preventSelfTrade(order, ask, result) {
+				result.StopReason = StopReasonSelfTrade
+				return
 			}
+			continue
+		}
+
+		filledQuantity := decimal.Min(visibleQuantity(ask), order.RemainingQuantity)
+
+		order.FilledQuantity = order.FilledQuantity.Add(filledQuantity)
+		order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
 
-			// Track this order was updated
-			result.UpdatedOrders = append(result.UpdatedOrders, o.Bids[i])
-
-			trade := models.Trade{
-				ID:            uuid.New(),
-				MarketID:      order.MarketID,
-				BuyerID:       o.Bids[i].UserID,
-				SellerID:      order.UserID,
-				BuyerOrderID:  o.Bids[i].ID,
-				SellerOrderID: order.ID,
-				Price:         *o.Bids[i].Price, // Trade happens at the maker's price (bid price)
-				Quantity:      filledQuantity,
-				QuoteQuantity: o.Bids[i].Price.Mul(filledQuantity),
-				IsBuyerMaker:  true, // Existing bid is the maker, incoming sell order is the taker
-				CreatedAt:     time.Now(),
+		ask.FilledQuantity = ask.FilledQuantity.Add(filledQuantity)
+		ask.RemainingQuantity = ask.Quantity.Sub(ask.FilledQuantity)
+
+		// Update ask order status
+		if ask.RemainingQuantity.Equal(decimal.Zero) {
+			ask.Status = models.FILLED
+			result.RemovedOrderIDs = append(result.RemovedOrderIDs, ask.ID)
+			o.Asks.Remove(ask.ID)
+		} else {
+			ask.Status = models.PARTIAL
+		}
+
+		// An iceberg whose visible slice is gone refills and requeues behind its level
+		if ask.DisplayQuantity != nil && ask.RemainingQuantity.GreaterThan(decimal.Zero) {
+			ask.VisibleQuantity = ask.VisibleQuantity.Sub(filledQuantity)
+			if ask.VisibleQuantity.Equal(decimal.Zero) {
+				refillIceberg(ask)
+				o.Asks.Requeue(ask.ID)
 			}
+		}
 
-			// Track this trade was generated
-			result.GeneratedTrades = append(result.GeneratedTrades, trade)
-			order.Trades = append(order.Trades, trade)
-			o.CurrentPrice = trade.Price
-			o.LastTradeId = trade.ID.String()
+		// Track this order was updated
+		result.UpdatedOrders = append(result.UpdatedOrders, ask)
+
+		trade := models.Trade{
+			ID:            o.Clock.NewID(),
+			MarketID:      order.MarketID,
+			BuyerID:       order.UserID,
+			SellerID:      ask.UserID,
+			BuyerOrderID:  order.ID,
+			SellerOrderID: ask.ID,
+			Price:         *ask.Price, // Trade happens at the maker's price (ask price)
+			IsBuyerMaker:  false,      // Incoming buy order is the taker, existing ask is the maker
+			Quantity:      filledQuantity,
+			QuoteQuantity: ask.Price.Mul(filledQuantity),
+			CreatedAt:     o.Clock.Now(),
 		}
+		o.chargeFees(&trade)
+
+		// Track this trade was generated
+		result.GeneratedTrades = append(result.GeneratedTrades, trade)
+		order.Trades = append(order.Trades, trade)
+		o.CurrentPrice = trade.Price
+		o.LastTradeId = trade.ID.String()
 	}
 
-	// Remove fully filled bid orders
-	for i := len(o.Bids) - 1; i >= 0; i-- {
-		if o.Bids[i].RemainingQuantity.Equal(decimal.Zero) {
-			o.Bids = append(o.Bids[:i], o.Bids[i+1:]...)
+	result.StopReason = StopReasonFilled
+}
+
+func (o *OrderBook) matchAsk(order *models.Order, result *MatchingResult) {
+	limit, limitReason := priceLimit(order)
+
+	for order.RemainingQuantity.GreaterThan(decimal.Zero) {
+		// Best price first, oldest first within a price
+		bid := o.Bids.Front()
+		if bid == nil {
+			result.StopReason = StopReasonBookExhausted
+			return
+		}
+		if limit != nil && bid.Price.LessThan(*limit) {
+			result.StopReason = limitReason
+			return
+		}
+
+		if bid.UserID == order.UserID {
+			if !o.preventSelfTrade(order, bid, result) {
+				result.StopReason = StopReasonSelfTrade
+				return
+			}
+			continue
 		}
+
+		filledQuantity := decimal.Min(visibleQuantity(bid), order.RemainingQuantity)
+
+		order.FilledQuantity = order.FilledQuantity.Add(filledQuantity)
+		order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
+
+		bid.FilledQuantity = bid.FilledQuantity.Add(filledQuantity)
+		bid.RemainingQuantity = bid.Quantity.Sub(bid.FilledQuantity)
+
+		// Update bid order status
+		if bid.RemainingQuantity.Equal(decimal.Zero) {
+			bid.Status = models.FILLED
+			result.RemovedOrderIDs = append(result.RemovedOrderIDs, bid.ID)
+			o.Bids.Remove(bid.ID)
+		} else {
+			bid.Status = models.PARTIAL
+		}
+
+		// An iceberg whose visible slice is gone refills and requeues behind its level
+		if bid.DisplayQuantity != nil && bid.RemainingQuantity.GreaterThan(decimal.Zero) {
+			bid.VisibleQuantity = bid.VisibleQuantity.Sub(filledQuantity)
+			if bid.VisibleQuantity.Equal(decimal.Zero) {
+				refillIceberg(bid)
+				o.Bids.Requeue(bid.ID)
+			}
+		}
+
+		// Track this order was updated
+		result.UpdatedOrders = append(result.UpdatedOrders, bid)
+
+		trade := models.Trade{
+			ID:            o.Clock.NewID(),
+			MarketID:      order.MarketID,
+			BuyerID:       bid.UserID,
+			SellerID:      order.UserID,
+			BuyerOrderID:  bid.ID,
+			SellerOrderID: order.ID,
+			Price:         *bid.Price, // Trade happens at the maker's price (bid price)
+			Quantity:      filledQuantity,
+			QuoteQuantity: bid.Price.Mul(filledQuantity),
+			IsBuyerMaker:  true, // Existing bid is the maker, incoming sell order is the taker
+			CreatedAt:     o.Clock.Now(),
+		}
+		o.chargeFees(&trade)
+
+		// Track this trade was generated
+		result.GeneratedTrades = append(result.GeneratedTrades, trade)
+		order.Trades = append(order.Trades, trade)
+		o.CurrentPrice = trade.Price
+		o.LastTradeId = trade.ID.String()
 	}
+
+	result.StopReason = StopReasonFilled
 }
 
 func (o *OrderBook) GetOpenOrders(userID uuid.UUID) []models.Order {
 
-	openOrders := make([]models.Order, 0, len(o.Asks)+len(o.Bids))
+	openOrders := make([]models.Order, 0)
+
+	for _, side := range []*BookSide{o.Asks, o.Bids} {
+		side.Each(func(order *models.Order) bool {
+			if order.UserID == userID {
+				openOrders = append(openOrders, *order) // Dereference pointer to get value
+			}
+			return true
+		})
+	}
+
+	return openOrders
+}
+
+// ModifyOrder amends the price and/or total quantity of a resting order in place,
+// keeping its ID. Reducing the quantity keeps the order's time priority. A new
+// price or a larger quantity sends it back through matching as if it had just
+// arrived, so it may trade and then rests at the back of its new price level.
+func (o *OrderBook) ModifyOrder(orderID uuid.UUID, userID uuid.UUID, price *decimal.Decimal, quantity *decimal.Decimal) (*MatchingResult, error) {
+	order := o.findOrder(orderID, userID)
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if price != nil && price.LessThanOrEqual(decimal.Zero) {
+		return nil, ErrInvalidAmendPrice
+	}
+	if quantity != nil && quantity.LessThanOrEqual(order.FilledQuantity) {
+		return nil, ErrInvalidAmendSize
+	}
+
+	repriced := price != nil && !price.Equal(*order.Price)
+	increased := quantity != nil && quantity.GreaterThan(order.Quantity)
 
-	for _, ask := range o.Asks {
-		if ask.UserID == userID {
-			openOrders = append(openOrders, *ask) // Dereference pointer to get value
+	if !repriced && !increased {
+		if quantity != nil {
+			decrementQuantity(order, order.Quantity.Sub(*quantity), o.Clock.Now())
 		}
+		return &MatchingResult{
+			IncomingOrder:   order,
+			UpdatedOrders:   []*models.Order{},
+			GeneratedTrades: []models.Trade{},
+			RemovedOrderIDs: []uuid.UUID{},
+		}, nil
 	}
 
-	for _, bid := range o.Bids {
-		if bid.UserID == userID {
-			openOrders = append(openOrders, *bid) // Dereference pointer to get value
+	if repriced && order.PostOnly == models.POST_ONLY_REJECT && !o.Auction {
+		amended := *order
+		amended.Price = price
+		if o.WouldCross(&amended) {
+			return nil, ErrAmendPostOnly
 		}
 	}
 
-	return openOrders
+	// Lose priority: take the order out and bring it back in with its new terms
+	o.bookSide(order.Side).Remove(order.ID)
+
+	if repriced {
+		order.Price = price
+	}
+	if quantity != nil {
+		order.Quantity = *quantity
+		order.RemainingQuantity = order.Quantity.Sub(order.FilledQuantity)
+	}
+	order.UpdatedAt = o.Clock.Now()
+
+	return o.AddOrder(order), nil
+}
+
+// findOrder returns the user's resting order with the given ID, or nil
+func (o *OrderBook) findOrder(orderID uuid.UUID, userID uuid.UUID) *models.Order {
+	for _, side := range []*BookSide{o.Bids, o.Asks} {
+		if order, exists := side.Get(orderID); exists && order.UserID == userID {
+			return order
+		}
+	}
+	return nil
 }
 
 // RemoveOrder removes an order from the orderbook by order ID and user ID
@@ -241,36 +687,58 @@ func (o *OrderBook) RemoveOrder(orderID string, userID uuid.UUID) (*models.Order
 		return nil, false
 	}
 
-	// Check in asks first
-	for i, ask := range o.Asks {
-		if ask.ID == orderUUID && ask.UserID == userID {
-			// Found the order in asks, remove it
-			removedOrder := *ask // Copy the order before removing
-			removedOrder.Status = models.CANCELLED
-			removedOrder.UpdatedAt = time.Now()
-			
-			// Remove from slice
-			o.Asks = append(o.Asks[:i], o.Asks[i+1:]...)
-			return &removedOrder, true
+	order := o.findOrder(orderUUID, userID)
+	if order == nil {
+		return nil, false
+	}
+
+	// The order itself is marked so anything still holding it (e.g. an order
+	// group) sees the cancellation
+	o.bookSide(order.Side).Remove(order.ID)
+	order.Status = models.CANCELLED
+	order.UpdatedAt = o.Clock.Now()
+	return order, true
+}
+
+// RestOrder puts an order on the book as it is, without matching it. It is for
+// restoring a saved book, where orders must be added in time priority, and for
+// collecting orders during a call auction.
+func (o *OrderBook) RestOrder(order *models.Order) {
+	if order.DisplayQuantity != nil && order.VisibleQuantity.LessThanOrEqual(decimal.Zero) {
+		refillIceberg(order)
+	}
+	o.bookSide(order.Side).Push(order)
+}
+
+// ExpiryDue reports whether any resting GTD order has reached its expiry
+func (o *OrderBook) ExpiryDue(now time.Time) bool {
+	for _, side := range []*BookSide{o.Bids, o.Asks} {
+		for _, order := range side.expiring {
+			if !now.Before(*order.ExpiresAt) {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	// Check in bids
-	for i, bid := range o.Bids {
-		if bid.ID == orderUUID && bid.UserID == userID {
-			// Found the order in bids, remove it
-			removedOrder := *bid // Copy the order before removing
-			removedOrder.Status = models.CANCELLED
-			removedOrder.UpdatedAt = time.Now()
-			
-			// Remove from slice
-			o.Bids = append(o.Bids[:i], o.Bids[i+1:]...)
-			return &removedOrder, true
+// ExpireOrders removes every resting GTD order whose expiry is at or before now
+// and returns them marked as EXPIRED
+func (o *OrderBook) ExpireOrders(now time.Time) []*models.Order {
+	expired := []*models.Order{}
+
+	for _, side := range []*BookSide{o.Bids, o.Asks} {
+		for _, order := range side.Expiring() {
+			if !now.Before(*order.ExpiresAt) {
+				side.Remove(order.ID)
+				order.Status = models.EXPIRED
+				order.UpdatedAt = now
+				expired = append(expired, order)
+			}
 		}
 	}
 
-	// Order not found
-	return nil, false
+	return expired
 }
 
 type DepthLevel struct {
@@ -287,16 +755,9 @@ type MarketDepth struct {
 }
 
 func (o *OrderBook) GetDepth(maxLevels int) *MarketDepth {
-	// Aggregate orders by price level
-	bidLevels := o.aggregateOrdersByPrice(o.Bids)
-	askLevels := o.aggregateOrdersByPrice(o.Asks)
-
-	sort.Slice(bidLevels, func(i, j int) bool {
-		return bidLevels[i].Price.GreaterThan(bidLevels[j].Price)
-	})
-	sort.Slice(askLevels, func(i, j int) bool {
-		return askLevels[i].Price.LessThan(askLevels[j].Price)
-	})
+	// Aggregate orders by price level, best price first
+	bidLevels := o.aggregateOrdersByPrice(o.Bids, maxLevels)
+	askLevels := o.aggregateOrdersByPrice(o.Asks, maxLevels)
 
 	bids := o.calculateCumulativeTotals(bidLevels, maxLevels)
 	asks := o.calculateCumulativeTotals(askLevels, maxLevels)
@@ -310,16 +771,15 @@ func (o *OrderBook) GetDepth(maxLevels int) *MarketDepth {
 }
 
 type DepthResponse struct {
-	Market string     `json:"market"`
+	Market string      `json:"market"`
 	Bids   [][2]string `json:"bids"`
 	Asks   [][2]string `json:"asks"`
 }
 
 func (o *OrderBook) GetDepthResponse(maxLevels int) *messages.DepthResponse {
-	
+
 	marketDepth := o.GetDepth(maxLevels)
-	
-	
+
 	bids := make([][2]string, len(marketDepth.Bids))
 	for i, bid := range marketDepth.Bids {
 		bids[i] = [2]string{
@@ -327,7 +787,7 @@ func (o *OrderBook) GetDepthResponse(maxLevels int) *messages.DepthResponse {
 			bid.Quantity.String(),
 		}
 	}
-	
+
 	asks := make([][2]string, len(marketDepth.Asks))
 	for i, ask := range marketDepth.Asks {
 		asks[i] = [2]string{
@@ -335,7 +795,7 @@ func (o *OrderBook) GetDepthResponse(maxLevels int) *messages.DepthResponse {
 			ask.Quantity.String(),
 		}
 	}
-	
+
 	return &messages.DepthResponse{
 		Market: marketDepth.Symbol,
 		Bids:   bids,
@@ -343,30 +803,26 @@ func (o *OrderBook) GetDepthResponse(maxLevels int) *messages.DepthResponse {
 	}
 }
 
-func (o *OrderBook) aggregateOrdersByPrice(orders []*models.Order) []DepthLevel {
-	priceMap := make(map[string]decimal.Decimal)
+func (o *OrderBook) aggregateOrdersByPrice(side *BookSide, maxLevels int) []DepthLevel {
+	levels := []DepthLevel{}
 
-	for _, order := range orders {
-		if order.Price == nil {
-			continue
+	side.EachLevel(func(level *PriceLevel) bool {
+		if maxLevels > 0 && len(levels) == maxLevels {
+			return false
 		}
 
-		priceStr := order.Price.String()
-		if existing, exists := priceMap[priceStr]; exists {
-			priceMap[priceStr] = existing.Add(order.RemainingQuantity)
-		} else {
-			priceMap[priceStr] = order.RemainingQuantity
+		// Icebergs only contribute their visible slice
+		quantity := decimal.Zero
+		for element := level.Orders.Front(); element != nil; element = element.Next() {
+			quantity = quantity.Add(visibleQuantity(element.Value.(*models.Order)))
 		}
-	}
 
-	levels := make([]DepthLevel, 0, len(priceMap))
-	for priceStr, quantity := range priceMap {
-		price, _ := decimal.NewFromString(priceStr)
 		levels = append(levels, DepthLevel{
-			Price:    price,
+			Price:    level.Price,
 			Quantity: quantity,
 		})
-	}
+		return true
+	})
 
 	return levels
 }
@@ -0,0 +1,606 @@
+package orderbook
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KshitijBhardwaj18/Orbix/shared/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// testTime moves on a second for every test order, so that orders rest in the
+// order they were made
+var testTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testOrder builds an order for tests. A zero price makes a market order.
+func testOrder(side models.OrderSide, price, quantity string) *models.Order {
+	testTime = testTime.Add(time.Second)
+	order := &models.Order{
+		ID:                uuid.New(),
+		UserID:            uuid.New(),
+		MarketID:          "BTC/USD",
+		Side:              side,
+		Type:              models.MARKET,
+		TimeInForce:       models.GTC,
+		Quantity:          decimal.RequireFromString(quantity),
+		RemainingQuantity: decimal.RequireFromString(quantity),
+		FilledQuantity:    decimal.Zero,
+		Status:            models.PENDING,
+		CreatedAt:         testTime,
+		UpdatedAt:         testTime,
+	}
+	if price != "" {
+		p := decimal.RequireFromString(price)
+		order.Type = models.LIMIT
+		order.Price = &p
+	}
+	return order
+}
+
+// protected sets a market order's protection price
+func protected(order *models.Order, price string) *models.Order {
+	p := decimal.RequireFromString(price)
+	order.ProtectionPrice = &p
+	return order
+}
+
+// withTimeInForce sets an order's time in force
+func withTimeInForce(order *models.Order, timeInForce models.TimeInForce) *models.Order {
+	order.TimeInForce = timeInForce
+	return order
+}
+
+// selfTrader owns the orders that own marks, so they meet each other in the book
+var selfTrader = uuid.New()
+
+func own(order *models.Order) *models.Order {
+	order.UserID = selfTrader
+	return order
+}
+
+// withSelfTradePrevention sets an order's self-trade prevention mode
+func withSelfTradePrevention(order *models.Order, mode models.SelfTradePrevention) *models.Order {
+	order.SelfTradePrevention = mode
+	return order
+}
+
+type fill struct {
+	price, quantity string
+}
+
+func TestAddOrderMatching(t *testing.T) {
+	tests := []struct {
+		name       string
+		resting    []*models.Order
+		incoming   *models.Order
+		fills      []fill
+		status     models.OrderStatus
+		stopReason string
+		bids, asks int
+
+		// Checked when set: what is left of the incoming and resting orders, and
+		// which resting orders (by index) left the book
+		left        string
+		restingLeft []string
+		removed     []int
+	}{
+		{
+			name:       "limit buy crossing an ask fills at the ask price",
+			resting:    []*models.Order{testOrder(models.SELL, "100", "1")},
+			incoming:   testOrder(models.BUY, "101", "1"),
+			fills:      []fill{{"100", "1"}},
+			status:     models.FILLED,
+			stopReason: StopReasonFilled,
+		},
+		{
+			name:       "limit sell crossing a bid fills at the bid price",
+			resting:    []*models.Order{testOrder(models.BUY, "100", "2")},
+			incoming:   testOrder(models.SELL, "99", "1"),
+			fills:      []fill{{"100", "1"}},
+			status:     models.FILLED,
+			stopReason: StopReasonFilled,
+			bids:       1,
+		},
+		{
+			name:       "remainder of a partly filled limit order rests",
+			resting:    []*models.Order{testOrder(models.SELL, "100", "1")},
+			incoming:   testOrder(models.BUY, "100", "3"),
+			fills:      []fill{{"100", "1"}},
+			status:     models.PARTIAL,
+			stopReason: StopReasonBookExhausted,
+			bids:       1,
+		},
+		{
+			name: "better price first, then oldest first within a price",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				testOrder(models.SELL, "99", "1"),
+				testOrder(models.SELL, "100", "2"),
+			},
+			incoming:   testOrder(models.BUY, "100", "3"),
+			fills:      []fill{{"99", "1"}, {"100", "1"}, {"100", "1"}},
+			status:     models.FILLED,
+			stopReason: StopReasonFilled,
+			asks:       1,
+		},
+		{
+			name: "limit order stops at its price",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				testOrder(models.SELL, "102", "1"),
+			},
+			incoming:   testOrder(models.BUY, "101", "2"),
+			fills:      []fill{{"100", "1"}},
+			status:     models.PARTIAL,
+			stopReason: StopReasonPriceLimit,
+			bids:       1,
+			asks:       1,
+		},
+		{
+			name:       "limit order that doesn't cross rests untouched",
+			resting:    []*models.Order{testOrder(models.SELL, "101", "1")},
+			incoming:   testOrder(models.BUY, "100", "1"),
+			status:     models.PENDING,
+			stopReason: StopReasonPriceLimit,
+			bids:       1,
+			asks:       1,
+		},
+		{
+			name: "market order sweeps levels and cancels what the book can't fill",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				testOrder(models.SELL, "105", "1"),
+			},
+			incoming:   testOrder(models.BUY, "", "3"),
+			fills:      []fill{{"100", "1"}, {"105", "1"}},
+			status:     models.CANCELLED,
+			stopReason: StopReasonBookExhausted,
+		},
+		{
+			name: "market order stops at its protection price",
+			resting: []*models.Order{
+				testOrder(models.BUY, "100", "1"),
+				testOrder(models.BUY, "95", "1"),
+			},
+			incoming:   protected(testOrder(models.SELL, "", "2"), "98"),
+			fills:      []fill{{"100", "1"}},
+			status:     models.CANCELLED,
+			stopReason: StopReasonPriceProtection,
+			bids:       1,
+		},
+		{
+			name:       "IOC remainder is cancelled instead of resting",
+			resting:    []*models.Order{testOrder(models.SELL, "100", "1")},
+			incoming:   withTimeInForce(testOrder(models.BUY, "100", "3"), models.IOC),
+			fills:      []fill{{"100", "1"}},
+			status:     models.CANCELLED,
+			stopReason: StopReasonBookExhausted,
+		},
+		{
+			name: "FOK fills across levels when the book has enough",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				testOrder(models.SELL, "101", "1"),
+			},
+			incoming:   withTimeInForce(testOrder(models.BUY, "101", "2"), models.FOK),
+			fills:      []fill{{"100", "1"}, {"101", "1"}},
+			status:     models.FILLED,
+			stopReason: StopReasonFilled,
+		},
+		{
+			name: "FOK is rejected without a partial fill when the book is short",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				testOrder(models.SELL, "102", "1"),
+			},
+			incoming:   withTimeInForce(testOrder(models.BUY, "101", "2"), models.FOK),
+			status:     models.REJECTED,
+			stopReason: StopReasonFillOrKill,
+			asks:       2,
+		},
+		{
+			name:        "CANCEL_NEWEST cancels the incoming order and leaves the resting one",
+			resting:     []*models.Order{own(testOrder(models.SELL, "100", "1"))},
+			incoming:    withSelfTradePrevention(own(testOrder(models.BUY, "100", "2")), models.STP_CANCEL_NEWEST),
+			status:      models.CANCELLED,
+			stopReason:  StopReasonSelfTrade,
+			asks:        1,
+			left:        "2",
+			restingLeft: []string{"1"},
+			removed:     []int{},
+		},
+		{
+			name: "CANCEL_OLDEST cancels the resting order and keeps matching",
+			resting: []*models.Order{
+				own(testOrder(models.SELL, "100", "1")),
+				testOrder(models.SELL, "100", "1"),
+			},
+			incoming:    withSelfTradePrevention(own(testOrder(models.BUY, "100", "2")), models.STP_CANCEL_OLDEST),
+			fills:       []fill{{"100", "1"}},
+			status:      models.PARTIAL,
+			stopReason:  StopReasonBookExhausted,
+			bids:        1,
+			left:        "1",
+			restingLeft: []string{"1", "0"},
+			removed:     []int{0, 1},
+		},
+		{
+			name: "CANCEL_BOTH trades up to the own order, then cancels both",
+			resting: []*models.Order{
+				testOrder(models.SELL, "100", "1"),
+				own(testOrder(models.SELL, "100", "1")),
+			},
+			incoming:    withSelfTradePrevention(own(testOrder(models.BUY, "100", "3")), models.STP_CANCEL_BOTH),
+			fills:       []fill{{"100", "1"}},
+			status:      models.CANCELLED,
+			stopReason:  StopReasonSelfTrade,
+			left:        "2",
+			restingLeft: []string{"0", "1"},
+			removed:     []int{0, 1},
+		},
+		{
+			name:        "DECREMENT shrinks a larger resting order and cancels the incoming one",
+			resting:     []*models.Order{own(testOrder(models.SELL, "100", "3"))},
+			incoming:    withSelfTradePrevention(own(testOrder(models.BUY, "100", "1")), models.STP_DECREMENT_AND_CANCEL),
+			status:      models.CANCELLED,
+			stopReason:  StopReasonSelfTrade,
+			asks:        1,
+			left:        "1",
+			restingLeft: []string{"2"},
+			removed:     []int{},
+		},
+		{
+			name: "DECREMENT cancels a smaller resting order and matches on with the rest",
+			resting: []*models.Order{
+				own(testOrder(models.SELL, "100", "1")),
+				testOrder(models.SELL, "101", "1"),
+			},
+			incoming:    withSelfTradePrevention(own(testOrder(models.BUY, "101", "3")), models.STP_DECREMENT_AND_CANCEL),
+			fills:       []fill{{"101", "1"}},
+			status:      models.PARTIAL,
+			stopReason:  StopReasonBookExhausted,
+			bids:        1,
+			left:        "1",
+			restingLeft: []string{"1", "0"},
+			removed:     []int{0, 1},
+		},
+		{
+			name:        "an order without a self-trade prevention mode stops at its own order",
+			resting:     []*models.Order{own(testOrder(models.SELL, "100", "1"))},
+			incoming:    own(testOrder(models.BUY, "100", "1")),
+			status:      models.CANCELLED,
+			stopReason:  StopReasonSelfTrade,
+			asks:        1,
+			left:        "1",
+			restingLeft: []string{"1"},
+			removed:     []int{},
+		},
+		{
+			name:       "market order on an empty book is cancelled",
+			incoming:   testOrder(models.SELL, "", "1"),
+			status:     models.CANCELLED,
+			stopReason: StopReasonBookExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("BTC", "USD")
+			for _, order := range tt.resting {
+				book.AddOrder(order)
+			}
+
+			result := book.AddOrder(tt.incoming)
+
+			if len(result.GeneratedTrades) != len(tt.fills) {
+				t.Fatalf("got %d trades, want %d", len(result.GeneratedTrades), len(tt.fills))
+			}
+			for i, want := range tt.fills {
+				trade := result.GeneratedTrades[i]
+				if !trade.Price.Equal(decimal.RequireFromString(want.price)) ||
+					!trade.Quantity.Equal(decimal.RequireFromString(want.quantity)) {
+					t.Errorf("trade %d: got %s @ %s, want %s @ %s", i, trade.Quantity, trade.Price, want.quantity, want.price)
+				}
+			}
+			if tt.incoming.Status != tt.status {
+				t.Errorf("status: got %s, want %s", tt.incoming.Status, tt.status)
+			}
+			if result.StopReason != tt.stopReason {
+				t.Errorf("stop reason: got %s, want %s", result.StopReason, tt.stopReason)
+			}
+			if book.Bids.Len() != tt.bids || book.Asks.Len() != tt.asks {
+				t.Errorf("resting: got %d bids and %d asks, want %d and %d", book.Bids.Len(), book.Asks.Len(), tt.bids, tt.asks)
+			}
+			if tt.left != "" && !tt.incoming.RemainingQuantity.Equal(decimal.RequireFromString(tt.left)) {
+				t.Errorf("incoming remaining: got %s, want %s", tt.incoming.RemainingQuantity, tt.left)
+			}
+			for i, want := range tt.restingLeft {
+				if got := tt.resting[i].RemainingQuantity; !got.Equal(decimal.RequireFromString(want)) {
+					t.Errorf("resting order %d remaining: got %s, want %s", i, got, want)
+				}
+			}
+			if tt.removed != nil {
+				removed := []uuid.UUID{}
+				for _, i := range tt.removed {
+					removed = append(removed, tt.resting[i].ID)
+				}
+				if fmt.Sprint(result.RemovedOrderIDs) != fmt.Sprint(removed) {
+					t.Errorf("removed: got %v, want %v", result.RemovedOrderIDs, removed)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveOrder(t *testing.T) {
+	book := NewOrderBook("BTC", "USD")
+	order := testOrder(models.BUY, "100", "1")
+	book.AddOrder(order)
+
+	if _, ok := book.RemoveOrder(order.ID.String(), uuid.New()); ok {
+		t.Fatal("removed another user's order")
+	}
+	if _, ok := book.RemoveOrder(order.ID.String(), order.UserID); !ok {
+		t.Fatal("failed to remove a resting order")
+	}
+	if book.Bids.Len() != 0 {
+		t.Fatal("removed order is still on the book")
+	}
+}
+
+func TestExpireOrders(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiring := func(side models.OrderSide, price string, expiresAt time.Time) *models.Order {
+		order := withTimeInForce(testOrder(side, price, "1"), models.GTD)
+		order.ExpiresAt = &expiresAt
+		return order
+	}
+
+	due := expiring(models.BUY, "99", now)
+	overdue := expiring(models.SELL, "101", now.Add(-time.Minute))
+	later := expiring(models.BUY, "98", now.Add(time.Minute))
+	gtc := testOrder(models.SELL, "102", "1")
+
+	book := NewOrderBook("BTC", "USD")
+	for _, order := range []*models.Order{due, overdue, later, gtc} {
+		book.AddOrder(order)
+	}
+
+	expired := book.ExpireOrders(now)
+
+	if len(expired) != 2 {
+		t.Fatalf("got %d expired orders, want 2", len(expired))
+	}
+	for _, order := range []*models.Order{due, overdue} {
+		if order.Status != models.EXPIRED {
+			t.Errorf("order expiring at %s: got %s, want EXPIRED", order.ExpiresAt, order.Status)
+		}
+	}
+	if later.Status != models.PENDING || gtc.Status != models.PENDING {
+		t.Errorf("orders not yet due: got %s and %s, want PENDING", later.Status, gtc.Status)
+	}
+	if book.Bids.Len() != 1 || book.Asks.Len() != 1 {
+		t.Errorf("resting: got %d bids and %d asks, want 1 and 1", book.Bids.Len(), book.Asks.Len())
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     models.OrderSide
+		price    string
+		mode     models.PostOnlyMode
+		status   models.OrderStatus
+		reason   string
+		repriced string
+		rests    bool
+	}{
+		{"buy below the ask rests as sent", models.BUY, "99", models.POST_ONLY_REJECT, models.PENDING, "", "99", true},
+		{"crossing buy is rejected", models.BUY, "100", models.POST_ONLY_REJECT, models.REJECTED, StopReasonPostOnly, "100", false},
+		{"crossing sell is rejected", models.SELL, "90", models.POST_ONLY_REJECT, models.REJECTED, StopReasonPostOnly, "90", false},
+		{"crossing buy is repriced a tick below the ask", models.BUY, "101", models.POST_ONLY_REPRICE, models.PENDING, PostOnlyRepriced, "99.99", true},
+		{"crossing sell is repriced a tick above the bid", models.SELL, "90", models.POST_ONLY_REPRICE, models.PENDING, PostOnlyRepriced, "95.01", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("BTC", "USD")
+			book.TickSize = decimal.RequireFromString("0.01")
+			book.AddOrder(testOrder(models.SELL, "100", "1"))
+			book.AddOrder(testOrder(models.BUY, "95", "1"))
+
+			order := testOrder(tt.side, tt.price, "1")
+			order.PostOnly = tt.mode
+			result := book.AddOrder(order)
+
+			if len(result.GeneratedTrades) != 0 {
+				t.Fatalf("post-only order took liquidity: %d trades", len(result.GeneratedTrades))
+			}
+			if order.Status != tt.status || order.StatusReason != tt.reason {
+				t.Errorf("got %s (%s), want %s (%s)", order.Status, order.StatusReason, tt.status, tt.reason)
+			}
+			if !order.Price.Equal(decimal.RequireFromString(tt.repriced)) {
+				t.Errorf("price: got %s, want %s", order.Price, tt.repriced)
+			}
+			if rests := book.Bids.Len()+book.Asks.Len() == 3; rests != tt.rests {
+				t.Errorf("rests: got %v, want %v", rests, tt.rests)
+			}
+		})
+	}
+}
+
+// iceberg makes a resting order show only display of its quantity at a time
+func iceberg(order *models.Order, display string) *models.Order {
+	d := decimal.RequireFromString(display)
+	order.DisplayQuantity = &d
+	return order
+}
+
+func TestIceberg(t *testing.T) {
+	t.Run("depth shows only the visible slice", func(t *testing.T) {
+		book := NewOrderBook("BTC", "USD")
+		book.AddOrder(iceberg(testOrder(models.SELL, "100", "5"), "1"))
+		book.AddOrder(testOrder(models.SELL, "100", "2"))
+
+		depth := book.GetDepth(10)
+		if len(depth.Asks) != 1 || !depth.Asks[0].Quantity.Equal(decimal.NewFromInt(3)) {
+			t.Fatalf("got asks %v, want 3 at 100", depth.Asks)
+		}
+	})
+
+	t.Run("each slice fills separately and the reserve refills", func(t *testing.T) {
+		book := NewOrderBook("BTC", "USD")
+		hidden := iceberg(testOrder(models.SELL, "100", "3"), "1")
+		book.AddOrder(hidden)
+
+		result := book.AddOrder(testOrder(models.BUY, "100", "2"))
+
+		if len(result.GeneratedTrades) != 2 {
+			t.Fatalf("got %d trades, want one per slice", len(result.GeneratedTrades))
+		}
+		if !hidden.RemainingQuantity.Equal(decimal.NewFromInt(1)) || !hidden.VisibleQuantity.Equal(decimal.NewFromInt(1)) {
+			t.Errorf("iceberg: got %s left with %s visible, want 1 and 1", hidden.RemainingQuantity, hidden.VisibleQuantity)
+		}
+	})
+
+	t.Run("a refilled slice queues behind orders already at its price", func(t *testing.T) {
+		book := NewOrderBook("BTC", "USD")
+		hidden := iceberg(testOrder(models.SELL, "100", "3"), "1")
+		plain := testOrder(models.SELL, "100", "1")
+		book.AddOrder(hidden)
+		book.AddOrder(plain)
+
+		result := book.AddOrder(testOrder(models.BUY, "100", "2"))
+
+		if len(result.GeneratedTrades) != 2 {
+			t.Fatalf("got %d trades, want 2", len(result.GeneratedTrades))
+		}
+		for i, want := range []uuid.UUID{hidden.ID, plain.ID} {
+			if got := result.GeneratedTrades[i].SellerOrderID; got != want {
+				t.Errorf("trade %d: sold by %s, want %s", i, got, want)
+			}
+		}
+	})
+}
+
+func TestModifyOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		prices   []string // Amended one after the other
+		quantity string
+		err      error
+		first    int // Which of the two resting asks a buy for 1 at 100 fills after the amend
+	}{
+		{name: "decreasing the quantity keeps time priority", quantity: "2", first: 0},
+		{name: "increasing the quantity loses time priority", quantity: "4", first: 1},
+		{name: "moving the price away and back loses time priority", prices: []string{"101", "100"}, first: 1},
+		{name: "non-positive price is refused", prices: []string{"0"}, err: ErrInvalidAmendPrice, first: 0},
+		{name: "quantity at or below what filled is refused", quantity: "0", err: ErrInvalidAmendSize, first: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("BTC", "USD")
+			resting := []*models.Order{testOrder(models.SELL, "100", "3"), testOrder(models.SELL, "100", "3")}
+			for _, order := range resting {
+				book.AddOrder(order)
+			}
+
+			var err error
+			if tt.quantity != "" {
+				quantity := decimal.RequireFromString(tt.quantity)
+				_, err = book.ModifyOrder(resting[0].ID, resting[0].UserID, nil, &quantity)
+			}
+			for _, p := range tt.prices {
+				price := decimal.RequireFromString(p)
+				_, err = book.ModifyOrder(resting[0].ID, resting[0].UserID, &price, nil)
+			}
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			result := book.AddOrder(testOrder(models.BUY, "100", "1"))
+			if len(result.GeneratedTrades) != 1 {
+				t.Fatalf("got %d trades, want 1", len(result.GeneratedTrades))
+			}
+			if got := result.GeneratedTrades[0].SellerOrderID; got != resting[tt.first].ID {
+				t.Errorf("filled against resting order %v, want %d", got, tt.first)
+			}
+		})
+	}
+}
+
+func TestModifyOrderRefusals(t *testing.T) {
+	book := NewOrderBook("BTC", "USD")
+	book.AddOrder(testOrder(models.BUY, "99", "1"))
+	postOnly := testOrder(models.SELL, "101", "1")
+	postOnly.PostOnly = models.POST_ONLY_REJECT
+	book.AddOrder(postOnly)
+
+	crossing := decimal.RequireFromString("99")
+	if _, err := book.ModifyOrder(postOnly.ID, postOnly.UserID, &crossing, nil); err != ErrAmendPostOnly {
+		t.Errorf("crossing post-only amend: got %v, want %v", err, ErrAmendPostOnly)
+	}
+	if !postOnly.Price.Equal(decimal.NewFromInt(101)) {
+		t.Errorf("refused amend changed the price to %s", postOnly.Price)
+	}
+	if _, err := book.ModifyOrder(postOnly.ID, uuid.New(), &crossing, nil); err != ErrOrderNotFound {
+		t.Errorf("another user's order: got %v, want %v", err, ErrOrderNotFound)
+	}
+}
+
+func TestModifyOrderTradesOnArrival(t *testing.T) {
+	book := NewOrderBook("BTC", "USD")
+	book.AddOrder(testOrder(models.SELL, "101", "1"))
+	bid := testOrder(models.BUY, "99", "2")
+	book.AddOrder(bid)
+
+	price := decimal.RequireFromString("101")
+	result, err := book.ModifyOrder(bid.ID, bid.UserID, &price, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.GeneratedTrades) != 1 || bid.Status != models.PARTIAL {
+		t.Fatalf("got %d trades and %s, want 1 trade and PARTIAL", len(result.GeneratedTrades), bid.Status)
+	}
+	if book.Bids.Len() != 1 || book.Asks.Len() != 0 {
+		t.Errorf("resting: got %d bids and %d asks, want the amended bid alone", book.Bids.Len(), book.Asks.Len())
+	}
+}
+
+func TestExpireOrdersInExpiryOrder(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiring := func(expiresAt time.Time) *models.Order {
+		order := withTimeInForce(testOrder(models.BUY, "99", "1"), models.GTD)
+		order.ExpiresAt = &expiresAt
+		return order
+	}
+
+	latest := expiring(now)
+	tied := []*models.Order{expiring(now.Add(-time.Minute)), expiring(now.Add(-time.Minute))}
+	earliest := expiring(now.Add(-time.Hour))
+	if bytes.Compare(tied[0].ID[:], tied[1].ID[:]) > 0 {
+		tied[0], tied[1] = tied[1], tied[0]
+	}
+
+	book := NewOrderBook("BTC", "USD")
+	for _, order := range []*models.Order{latest, tied[1], earliest, tied[0]} {
+		book.AddOrder(order)
+	}
+
+	expired := book.ExpireOrders(now)
+
+	want := []*models.Order{earliest, tied[0], tied[1], latest}
+	if len(expired) != len(want) {
+		t.Fatalf("got %d expired orders, want %d", len(expired), len(want))
+	}
+	for i, order := range want {
+		if expired[i] != order {
+			t.Errorf("expiry %d: got order expiring at %s, want %s", i, expired[i].ExpiresAt, order.ExpiresAt)
+		}
+	}
+}
@@ -4,8 +4,64 @@ import (
 	"context"
 	"github.com/redis/go-redis/v9"
 	"os"
+	"strings"
 )
 
+// CoordinatorQueue receives engine requests that are not about a single market
+const CoordinatorQueue = "engine_requests"
+
+// EngineQueue is the request queue of the engine worker that owns a market, e.g.
+// engine_requests:BTC_USD. Without a market it is the coordinator queue.
+func EngineQueue(market string) string {
+	if market == "" {
+		return CoordinatorQueue
+	}
+	return CoordinatorQueue + ":" + strings.Replace(market, "/", "_", 1)
+}
+
+// FundsQueue is the Redis list the engine pushes every movement of funds onto,
+// in the order it made them, for the database to apply one at a time
+const FundsQueue = "db_funds"
+
+// EngineMarketsKey is the Redis set of markets that have an engine worker, as
+// BTC_USD. Requests for any other market go to the coordinator, which rejects them.
+const EngineMarketsKey = "engine_markets"
+
+// marketQueue is the queue for a request about one market: its worker's queue if
+// it has one, the coordinator queue otherwise
+func (r *Broker) marketQueue(market string) string {
+	if market == "" {
+		return CoordinatorQueue
+	}
+
+	member := strings.Replace(market, "/", "_", 1)
+	if running, err := r.rdb.SIsMember(r.ctx, EngineMarketsKey, member).Result(); err != nil || !running {
+		return CoordinatorQueue
+	}
+	return EngineQueue(market)
+}
+
+// SetEngineMarkets replaces the set of markets that have an engine worker
+func (r *Broker) SetEngineMarkets(markets []string) error {
+	members := make([]interface{}, len(markets))
+	for i, market := range markets {
+		members[i] = strings.Replace(market, "/", "_", 1)
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(r.ctx, EngineMarketsKey)
+	if len(members) > 0 {
+		pipe.SAdd(r.ctx, EngineMarketsKey, members...)
+	}
+	_, err := pipe.Exec(r.ctx)
+	return err
+}
+
+// AddEngineMarket routes a market's requests to the worker that was just started for it
+func (r *Broker) AddEngineMarket(market string) error {
+	return r.rdb.SAdd(r.ctx, EngineMarketsKey, strings.Replace(market, "/", "_", 1)).Err()
+}
+
 type Broker struct {
 	rdb *redis.Client
 	ctx context.Context
@@ -25,7 +25,7 @@ func (r *Broker) CreateOrder(order *messages.OrderRequest) (*models.Order, error
 	defer pubsub.Close()
 
 	requestData, _ := json.Marshal(request)
-	err := r.rdb.LPush(r.ctx, "engine_requests", requestData).Err()
+	err := r.rdb.LPush(r.ctx, r.marketQueue(order.MarketID), requestData).Err()
 
 	if err != nil {
 		return nil, err
@@ -42,6 +42,97 @@ func (r *Broker) CreateOrder(order *messages.OrderRequest) (*models.Order, error
 	}
 }
 
+func (r *Broker) CreateOrderGroup(req *messages.OrderGroupRequest) (*messages.OrderGroupResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "CREATE_ORDER_GROUP",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, r.marketQueue(req.MarketID), requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.OrderGroupResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+func (r *Broker) SetSelfTradePrevention(req *messages.SelfTradePreventionRequest) (*messages.SelfTradePreventionResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "SET_SELF_TRADE_PREVENTION",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.SelfTradePreventionResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+// SetFeeTier moves a user to another fee tier in every market
+func (r *Broker) SetFeeTier(req *messages.FeeTierRequest) (*messages.FeeTierResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "SET_FEE_TIER",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.FeeTierResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
 // OrderbookInfo represents individual orderbook data (same as in engine)
 type OrderbookInfo struct {
 	Ticker   string `json:"ticker"`
@@ -68,7 +159,7 @@ func (r *Broker) LogOrderbooks() (*OrderbooksResponse, error){
 
 	requestData, _ := json.Marshal(request)
 
-	err := r.rdb.LPush(r.ctx,"engine_requests",requestData).Err()
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
 
 	if err != nil {
 		return nil, err
@@ -90,6 +181,7 @@ type DepthResponse struct {
 	Market string     `json:"market"`
 	Bids   [][2]string `json:"bids"`
 	Asks   [][2]string `json:"asks"`
+	Error  string      `json:"error,omitempty"`
 }
 
 func (r *Broker) GetDepth(req *messages.GetDepthRequest) (*DepthResponse, error) {
@@ -106,7 +198,7 @@ func (r *Broker) GetDepth(req *messages.GetDepthRequest) (*DepthResponse, error)
 
 	requestData, _ := json.Marshal(request)
 
-	err := r.rdb.LPush(r.ctx,"engine_requests",requestData).Err()
+	err := r.rdb.LPush(r.ctx, r.marketQueue(req.Market), requestData).Err()
 
 	if err != nil {
 		return nil, err
@@ -137,7 +229,7 @@ func (r *Broker) CancelOrderRequest(req *messages.CancelOrderRequest) (messages.
 	}
 
 	requestData,_ := json.Marshal(request)
-	err := r.rdb.LPush(r.ctx, "engine_requests",requestData).Err()
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
 
 	if err != nil {
 		return messages.CancelOrderResponse{
@@ -163,7 +255,97 @@ func (r *Broker) CancelOrderRequest(req *messages.CancelOrderRequest) (messages.
 
 }
 
-func (r *Broker) GetOpenOrders(req *messages.GetOpenOrdersRequest) ([]models.Order, error) {
+func (r *Broker) GetOrder(req *messages.GetOrderRequest) (*messages.GetOrderResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "GET_ORDER",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.GetOrderResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+func (r *Broker) CancelAllOrders(req *messages.CancelAllOrdersRequest) (*messages.CancelAllOrdersResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "CANCEL_ALL",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, r.marketQueue(req.Market), requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.CancelAllOrdersResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+func (r *Broker) ModifyOrder(req *messages.ModifyOrderRequest) (*messages.ModifyOrderResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "MODIFY_ORDER",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.ModifyOrderResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+func (r *Broker) GetOpenOrders(req *messages.GetOpenOrdersRequest) (*messages.OpenOrdersResponse, error) {
 	clientId := uuid.New().String()
 	
 	pubsub := r.rdb.Subscribe(r.ctx, clientId)
@@ -176,7 +358,7 @@ func (r *Broker) GetOpenOrders(req *messages.GetOpenOrdersRequest) ([]models.Ord
 	}
 
 	requestData, _ := json.Marshal(request)
-	err := r.rdb.LPush(r.ctx, "engine_requests", requestData).Err()
+	err := r.rdb.LPush(r.ctx, r.marketQueue(req.Market), requestData).Err()
 
 	if err != nil {
 		return nil, err
@@ -184,15 +366,117 @@ func (r *Broker) GetOpenOrders(req *messages.GetOpenOrdersRequest) ([]models.Ord
 
 	select {
 	case msg := <-pubsub.Channel():
-		var response []models.Order
+		var response messages.OpenOrdersResponse
 		err := json.Unmarshal([]byte(msg.Payload), &response)
-		return response, err
+		return &response, err
 
 	case <-time.After(5 * time.Second):
 		return nil, errors.New("engine timeout")
 	}
 }
 
+// Snapshot asks every market worker to write a snapshot now. Writing every book
+// to disk can take longer than a normal request, so it waits longer.
+func (r *Broker) Snapshot() (*messages.SnapshotResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "SNAPSHOT",
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.SnapshotResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(30 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+// UpdateMarket pushes a listed, changed or delisted market to the engine
+func (r *Broker) UpdateMarket(req *messages.UpdateMarketRequest) (*messages.UpdateMarketResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "UPDATE_MARKET",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, CoordinatorQueue, requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.UpdateMarketResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+// SetMarketStatus moves a market to another trading state
+func (r *Broker) SetMarketStatus(req *messages.MarketStatusRequest) (*messages.MarketStatusResponse, error) {
+	clientId := uuid.New().String()
+
+	request := &messages.MessageFromAPI{
+		ClientId:    clientId,
+		MessageType: "SET_MARKET_STATUS",
+		Data:        req,
+	}
+
+	pubsub := r.rdb.Subscribe(r.ctx, clientId)
+	defer pubsub.Close()
+
+	requestData, _ := json.Marshal(request)
+	err := r.rdb.LPush(r.ctx, r.marketQueue(req.Market), requestData).Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-pubsub.Channel():
+		var response messages.MarketStatusResponse
+		err := json.Unmarshal([]byte(msg.Payload), &response)
+		return &response, err
+
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("engine timeout")
+	}
+}
+
+// Enqueue pushes a message onto an engine queue without waiting for a reply
+func (r *Broker) Enqueue(queueName string, message *messages.MessageFromAPI) error {
+	requestData, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return r.rdb.LPush(r.ctx, queueName, requestData).Err()
+}
 
 func (r *Broker) BRPop(queueName string) (*messages.MessageFromAPI, error) {
 	result, err := r.rdb.BRPop(r.ctx, 0, queueName).Result()
@@ -212,6 +496,47 @@ func (r *Broker) BRPop(queueName string) (*messages.MessageFromAPI, error) {
 	return &queueMsg, nil
 }
 
+// PushEvent appends an event to a queue that is consumed with ClaimEvent
+func (r *Broker) PushEvent(queueName string, data []byte) error {
+	return r.rdb.LPush(r.ctx, queueName, data).Err()
+}
+
+// ClaimEvent returns the oldest event of a queue, waiting for one if it is empty.
+// The event moves to the queue's processing list until AckEvent, so one claimed
+// before a crash is claimed again first.
+func (r *Broker) ClaimEvent(queueName string) (string, error) {
+	processing := queueName + ":processing"
+
+	payload, err := r.rdb.LIndex(r.ctx, processing, -1).Result()
+	if err == nil {
+		return payload, nil
+	}
+	if err != redis.Nil {
+		return "", err
+	}
+
+	return r.rdb.BLMove(r.ctx, queueName, processing, "RIGHT", "LEFT", 0).Result()
+}
+
+// PendingEvents counts the events of a queue that are not handled yet, whether
+// they are claimed or still waiting
+func (r *Broker) PendingEvents(queueName string) (int64, error) {
+	waiting, err := r.rdb.LLen(r.ctx, queueName).Result()
+	if err != nil {
+		return 0, err
+	}
+	claimed, err := r.rdb.LLen(r.ctx, queueName+":processing").Result()
+	if err != nil {
+		return 0, err
+	}
+	return waiting + claimed, nil
+}
+
+// AckEvent drops a claimed event once it has been handled
+func (r *Broker) AckEvent(queueName string, payload string) error {
+	return r.rdb.LRem(r.ctx, queueName+":processing", 1, payload).Err()
+}
+
 func (r *Broker) PublishToClient(Type string, clientID string, response interface{}) error {
 	data, err := json.Marshal(response)
 	if err != nil {
@@ -15,15 +15,87 @@ type OrderRequest struct {
 	Quantity decimal.Decimal  `gorm:"type:decimal(20,8);not null"`
 	Price    *decimal.Decimal `gorm:"type:decimal(20,8)"`
 	Type     models.OrderType `gorm:"type:varchar(5);not null"`
+	PostOnly models.PostOnlyMode
+
+	// Overrides the account's self-trade prevention mode for this order
+	SelfTradePrevention models.SelfTradePrevention
+
+	TimeInForce models.TimeInForce `gorm:"type:varchar(3)"` // Defaults to GTC for limit and IOC for market orders
+	ExpiresAt   *time.Time         // Required for GTD orders
+
+	// Optional for market orders: the sweep stops once the next level is worse than this
+	ProtectionPrice *decimal.Decimal `gorm:"type:decimal(20,8)"`
+
+	// Required for STOP_MARKET and STOP_LIMIT orders
+	StopPrice *decimal.Decimal `gorm:"type:decimal(20,8)"`
+
+	// TRAILING_STOP orders need exactly one of these; the engine derives the stop price
+	TrailingOffset  *decimal.Decimal `gorm:"type:decimal(20,8)"`
+	TrailingPercent *decimal.Decimal `gorm:"type:decimal(10,4)"`
+
+	// Optional for TRAILING_STOP orders: what the stop follows, the last trade by default
+	TrailingReference models.TrailingReference
+
+	// Optional for limit orders: only this much is shown in the book at a time
+	DisplayQuantity *decimal.Decimal `gorm:"type:decimal(20,8)"`
 }
 
 
 
+// SelfTradePreventionRequest sets the mode used for a user's orders that don't
+// choose one themselves
+type SelfTradePreventionRequest struct {
+	UserID uuid.UUID                  `json:"user_id"`
+	Mode   models.SelfTradePrevention `json:"mode"`
+}
+
+type SelfTradePreventionResponse struct {
+	Success bool                       `json:"success"`
+	Message string                     `json:"message"`
+	Mode    models.SelfTradePrevention `json:"mode"`
+}
+
+// FeeTierRequest moves a user to the fee tier whose rates they pay in every market
+type FeeTierRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+	Tier   int       `json:"tier"`
+}
+
+type FeeTierResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Tier    int    `json:"tier"`
+}
+
+// OrderGroupRequest places a take-profit limit and a stop-loss as one-cancels-other.
+// With an Entry it becomes a bracket: the legs wait for the entry's first fill and
+// then cover whatever it has filled net of the buyer fee, up to their own quantity.
+type OrderGroupRequest struct {
+	UserID     uuid.UUID     `json:"user_id"`
+	MarketID   string        `json:"market_id"`
+	Entry      *OrderRequest `json:"entry,omitempty"`
+	TakeProfit OrderRequest  `json:"take_profit"`
+	StopLoss   OrderRequest  `json:"stop_loss"`
+}
+
+type OrderGroupResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Group   models.OrderGroup `json:"group"`
+	Orders  []models.Order    `json:"orders"`
+}
+
 type GetOpenOrdersRequest struct {
 	UserID uuid.UUID `json:"user_id"`
 	Market string    `json:"market"` // Optional: filter by market
 }
 
+// OpenOrdersResponse lists a user's open orders, or says why it can't
+type OpenOrdersResponse struct {
+	Orders []models.Order `json:"orders"`
+	Error  string         `json:"error,omitempty"` // Set when the engine has no such market
+}
+
 type CancelOrderRequest struct {
 	UserID  uuid.UUID `json:"user_id"`
 	OrderID string `json:"order_id"`
@@ -35,6 +107,89 @@ type CancelOrderResponse struct {
 	OrderId string `json:"order_id"`
 }
 
+type GetOrderRequest struct {
+	UserID  uuid.UUID `json:"user_id"`
+	OrderID string    `json:"order_id"`
+}
+
+// GetOrderResponse carries the live state of an open order; orders that are no
+// longer open are not found
+type GetOrderResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Order   *models.Order `json:"order,omitempty"`
+}
+
+// CancelAllOrdersRequest cancels every open order of a user. Empty Market and
+// Side match all markets and both sides.
+type CancelAllOrdersRequest struct {
+	UserID uuid.UUID        `json:"user_id"`
+	Market string           `json:"market,omitempty"`
+	Side   models.OrderSide `json:"side,omitempty"`
+}
+
+type CancelAllOrdersResponse struct {
+	Success  bool     `json:"success"`
+	Message  string   `json:"message"`
+	OrderIDs []string `json:"order_ids"`
+}
+
+// ModifyOrderRequest amends a resting order. Nil fields are left unchanged;
+// Quantity is the new total quantity including what has already filled.
+type ModifyOrderRequest struct {
+	UserID   uuid.UUID        `json:"user_id"`
+	OrderID  string           `json:"order_id"`
+	Price    *decimal.Decimal `json:"price,omitempty"`
+	Quantity *decimal.Decimal `json:"quantity,omitempty"`
+}
+
+type ModifyOrderResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Order   *models.Order `json:"order,omitempty"`
+}
+
+// SnapshotResponse reports the snapshot every market worker wrote for an admin
+// snapshot request
+type SnapshotResponse struct {
+	Success   bool             `json:"success"`
+	Message   string           `json:"message"`
+	Snapshots []MarketSnapshot `json:"snapshots"`
+}
+
+// MarketSnapshot is one market's snapshot: the sequence number of the last
+// journaled command it includes, or why it could not be written
+type MarketSnapshot struct {
+	Market   string `json:"market"`
+	Sequence uint64 `json:"sequence"`
+	Error    string `json:"error,omitempty"`
+}
+
+// UpdateMarketRequest pushes a market as stored in the markets table to the
+// engine: an unknown market is listed, a known one takes the new parameters and
+// one with DelistedAt set is closed
+type UpdateMarketRequest struct {
+	Market models.Market `json:"market"`
+}
+
+type UpdateMarketResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// MarketStatusRequest moves a market to another trading state
+type MarketStatusRequest struct {
+	Market string              `json:"market"`
+	Status models.MarketStatus `json:"status"`
+	Reason string              `json:"reason"` // Why, for clients watching the status channel
+}
+
+type MarketStatusResponse struct {
+	Success bool                `json:"success"`
+	Message string              `json:"message"`
+	Status  models.MarketStatus `json:"status"` // The market's state after the request
+}
+
 type OrderResponse struct {
 	OrderID           string          `json:"order_id"`
 	Status            string          `json:"status"`
@@ -54,9 +209,57 @@ type TradeEvent struct {
 	Quantity    string `json:"quantity"`
 	BuyerID     string `json:"buyer_id"`
 	SellerID    string `json:"seller_id"`
+	BuyerFee    string `json:"buyer_fee"`  // In the base asset
+	SellerFee   string `json:"seller_fee"` // In the quote asset
 	Timestamp   string `json:"timestamp"`
 }
 
+// TradeSettlement is how a trade moves the balances of its two sides. A side whose
+// order locked no funds, such as demo liquidity, is left out.
+type TradeSettlement struct {
+	Buyer  *SettlementSide `json:"buyer,omitempty"`
+	Seller *SettlementSide `json:"seller,omitempty"`
+}
+
+// SettlementSide is one side of a trade: Unlocked comes out of the locked balance
+// of SpentAsset, of which Spent goes to the other side and the rest back to
+// Available, and Received, net of the fee, is added to ReceivedAsset. Reserved is
+// the part of it that goes to Locked instead, for the legs of a bracket entry.
+type SettlementSide struct {
+	UserID        uuid.UUID       `json:"user_id"`
+	SpentAsset    string          `json:"spent_asset"`
+	Spent         decimal.Decimal `json:"spent"`
+	Unlocked      decimal.Decimal `json:"unlocked"`
+	ReceivedAsset string          `json:"received_asset"`
+	Received      decimal.Decimal `json:"received"`
+	Reserved      decimal.Decimal `json:"reserved"`
+}
+
+// BalanceChange moves funds between a user's available and locked balance outside
+// a trade. Available and Locked are deltas.
+type BalanceChange struct {
+	UserID    uuid.UUID       `json:"user_id"`
+	Asset     string          `json:"asset"`
+	Available decimal.Decimal `json:"available"`
+	Locked    decimal.Decimal `json:"locked"`
+	Reason    string          `json:"reason"`              // LOCK, UNLOCK or RECONCILE
+	Reference *uuid.UUID      `json:"reference,omitempty"` // The order or OCO group the funds are locked for
+}
+
+// FundsEvent is one movement of funds by the engine: a lock change, or a trade
+// with its settlement. Both go through one queue so the database applies them in
+// the order the engine made them. Journal, Sequence and Index give that order:
+// the market worker's journal, the command that moved the funds and the event's
+// place among that command's events.
+type FundsEvent struct {
+	Journal    string           `json:"journal,omitempty"` // Empty for corrections made outside any command
+	Sequence   uint64           `json:"sequence,omitempty"`
+	Index      uint64           `json:"index,omitempty"`
+	Balance    *BalanceChange   `json:"balance,omitempty"`
+	Trade      *models.Trade    `json:"trade,omitempty"`
+	Settlement *TradeSettlement `json:"settlement,omitempty"`
+}
+
 
 
 type OrderBookUpdate struct {
@@ -87,6 +290,7 @@ type DepthResponse struct {
     Market string     `json:"market"`
     Bids   [][2]string `json:"bids"`  // [["price", "quantity"]] as strings
     Asks   [][2]string `json:"asks"`  // [["price", "quantity"]] as strings
+    Error  string      `json:"error,omitempty"` // Set when the engine has no such market
 }
 
 type MessageFromAPI struct {
@@ -0,0 +1,20 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// FeeTier is a step of the fee ladder. Users reach a tier once their 30-day quote
+// volume is at least MinVolume.
+type FeeTier struct {
+	Tier      int             `gorm:"primaryKey;autoIncrement:false"`
+	Name      string          `gorm:"type:varchar(20);not null"`
+	MinVolume decimal.Decimal `gorm:"type:decimal(30,8);not null"`
+}
+
+// MarketFee replaces a market's maker and taker rates for users in a fee tier.
+// Tiers without a row of their own pay the rates of the closest tier below.
+type MarketFee struct {
+	MarketID string          `gorm:"type:varchar(20);primaryKey"`
+	Tier     int             `gorm:"primaryKey;autoIncrement:false"`
+	MakerFee decimal.Decimal `gorm:"type:decimal(10,6);not null"`
+	TakerFee decimal.Decimal `gorm:"type:decimal(10,6);not null"`
+}
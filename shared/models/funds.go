@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// FundsCursor is the last funds event of an engine journal the database applied.
+// Events are ordered by the sequence of the command that made them and their
+// index within it; anything at or before the cursor is a redelivery.
+type FundsCursor struct {
+	Journal   string `gorm:"type:varchar(40);primaryKey"`
+	Sequence  uint64 `gorm:"not null"`
+	Index     uint64 `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// FailedFundsEvent is a funds event the database could not apply after retrying.
+// It is kept as received and retried until it applies.
+type FailedFundsEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	Payload   string `gorm:"type:text;not null"`
+	Error     string `gorm:"type:text"`
+	Attempts  int    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
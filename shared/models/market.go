@@ -1,21 +1,52 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 )
 
+// MarketStatus is the trading state of a listed market
+type MarketStatus string
+
+const (
+    MARKET_OPEN        MarketStatus = "OPEN"        // Continuous trading
+    MARKET_HALTED      MarketStatus = "HALTED"      // Nothing is accepted, not even cancels
+    MARKET_CANCEL_ONLY MarketStatus = "CANCEL_ONLY" // Orders can be cancelled but not placed or amended
+    MARKET_POST_ONLY   MarketStatus = "POST_ONLY"   // Only orders that rest without trading are accepted
+    MARKET_AUCTION     MarketStatus = "AUCTION"     // Orders are collected without matching
+)
+
 type Market struct {
     ID                 string          `gorm:"type:varchar(20);primaryKey"` // BTCUSDT
     BaseAsset          string          `gorm:"type:varchar(10);not null"`   // BTC
     QuoteAsset         string          `gorm:"type:varchar(10);not null"`   // USDT
+    Name               string          `gorm:"type:varchar(50)"`            // Bitcoin
     MinQuantity        decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0.00000001"`
     MinPrice           decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0.00000001"`
     PricePrecision     int             `gorm:"not null;default:8"`
     QuantityPrecision  int             `gorm:"not null;default:8"`
+    MaxQuantity        decimal.Decimal `gorm:"type:decimal(30,8);not null;default:0"` // 0 = no limit
+    MinNotional        decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0"` // Smallest price × quantity
     IsActive           bool            `gorm:"not null;default:true"`
     
+    // Circuit breaker: the price may move at most PriceBand within PriceBandWindowSeconds,
+    // an order that would trade further halts the market for HaltCooldownSeconds. Trading
+    // then resumes through a call auction of ReopeningAuctionSeconds.
+    PriceBand               decimal.Decimal `gorm:"type:decimal(10,4);not null;default:0"` // 0.1 = ±10%, 0 = no circuit breaker
+    PriceBandWindowSeconds  int             `gorm:"not null;default:300"`
+    HaltCooldownSeconds     int             `gorm:"not null;default:300"`
+    ReopeningAuctionSeconds int             `gorm:"not null;default:60"` // 0 = reopen straight into continuous trading
+    
+    // Fees for tier 0, as a fraction of what each side of a trade receives. Fees
+    // holds the rates of higher tiers.
+    MakerFee           decimal.Decimal `gorm:"type:decimal(10,6);not null;default:0.001"`
+    TakerFee           decimal.Decimal `gorm:"type:decimal(10,6);not null;default:0.002"`
+    
+    Status             MarketStatus    `gorm:"type:varchar(12);not null;default:'OPEN'"` // Trading state, set by the engine
+    DelistedAt         *time.Time      `gorm:"default:null"`                // Delisted markets are kept for their order history
+    
     // Market Data Fields - Essential for any trading platform
     LastPrice          decimal.Decimal `gorm:"type:decimal(20,8);default:0"`        // Current market price
     BestBidPrice       decimal.Decimal `gorm:"type:decimal(20,8);default:0"`        // Highest buy order price
@@ -42,8 +73,19 @@ type Market struct {
     UpdatedAt          time.Time
     
     // Relationships
-    Orders []Order `gorm:"foreignKey:MarketID"`
-    Trades []Trade `gorm:"foreignKey:MarketID"`
+    Orders []Order     `gorm:"foreignKey:MarketID"`
+    Trades []Trade     `gorm:"foreignKey:MarketID"`
+    Fees   []MarketFee `gorm:"foreignKey:MarketID"` // Rates of tiers above 0
+}
+
+// Ticker is the market's symbol as the engine and clients use it, e.g. BTC/USD
+func (m *Market) Ticker() string {
+    return m.BaseAsset + "/" + m.QuoteAsset
+}
+
+// MarketIDFromTicker converts BTC/USD or BTC_USD to the BTCUSD primary key
+func MarketIDFromTicker(ticker string) string {
+    return strings.NewReplacer("/", "", "_", "").Replace(ticker)
 }
 
 // MarketTicker represents the ticker data typically sent to clients
@@ -7,18 +7,31 @@ import (
 )
 
 type Order struct {
-	ID                uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	UserID            uuid.UUID        `gorm:"type:uuid;not null;index"`
-	MarketID          string           `gorm:"type:varchar(20);not null;index"`
-	Side              OrderSide        `gorm:"type:varchar(4);not null"`
-	Type              OrderType        `gorm:"type:varchar(10);not null"`
-	Quantity          decimal.Decimal  `gorm:"type:decimal(20,8);not null"`
-	Price             *decimal.Decimal `gorm:"type:decimal(20,8)"`
-	FilledQuantity    decimal.Decimal  `gorm:"type:decimal(20,8);default:0"`
-	RemainingQuantity decimal.Decimal  `gorm:"type:decimal(20,8);not null"`
-	Status            OrderStatus      `gorm:"type:varchar(10);default:'PENDING'"`
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	ID                  uuid.UUID           `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID              uuid.UUID           `gorm:"type:uuid;not null;index"`
+	MarketID            string              `gorm:"type:varchar(20);not null;index"`
+	Side                OrderSide           `gorm:"type:varchar(4);not null"`
+	Type                OrderType           `gorm:"type:varchar(20);not null"`
+	PostOnly            PostOnlyMode        `gorm:"type:varchar(7)"`  // Empty unless the order must never take liquidity
+	SelfTradePrevention SelfTradePrevention `gorm:"type:varchar(20)"` // What happens when the order meets the same user's order
+	TimeInForce         TimeInForce         `gorm:"type:varchar(3);not null;default:'GTC'"`
+	ExpiresAt           *time.Time          // Only set for GTD orders
+	Quantity            decimal.Decimal     `gorm:"type:decimal(20,8);not null"`
+	Price               *decimal.Decimal    `gorm:"type:decimal(20,8)"`
+	ProtectionPrice     *decimal.Decimal    `gorm:"type:decimal(20,8)"`           // Worst price a market order may sweep to
+	StopPrice           *decimal.Decimal    `gorm:"type:decimal(20,8)"`           // Last trade price that triggers a stop order
+	TrailingOffset      *decimal.Decimal    `gorm:"type:decimal(20,8)"`           // Fixed distance a trailing stop keeps from the market
+	TrailingPercent     *decimal.Decimal    `gorm:"type:decimal(10,4)"`           // Distance as a percentage of the market price
+	TrailingReference   TrailingReference   `gorm:"type:varchar(10)"`             // Market price a trailing stop follows, empty for the last trade
+	DisplayQuantity     *decimal.Decimal    `gorm:"type:decimal(20,8)"`           // Iceberg slice size, nil shows the whole order
+	VisibleQuantity     decimal.Decimal     `gorm:"type:decimal(20,8);default:0"` // What is left of the current iceberg slice
+	FilledQuantity      decimal.Decimal     `gorm:"type:decimal(20,8);default:0"`
+	RemainingQuantity   decimal.Decimal     `gorm:"type:decimal(20,8);not null"`
+	Status              OrderStatus         `gorm:"type:varchar(10);default:'PENDING'"`
+	StatusReason        string              `gorm:"type:varchar(32)"` // Why the engine cancelled, rejected or repriced the order
+	GroupID             *uuid.UUID          `gorm:"type:uuid;index"`  // OCO / bracket group this order belongs to
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 
 	// Relationships
 	User   User    `gorm:"foreignKey:UserID"`
@@ -36,8 +49,54 @@ const (
 type OrderType string
 
 const (
-	MARKET OrderType = "MARKET"
-	LIMIT  OrderType = "LIMIT"
+	MARKET      OrderType = "MARKET"
+	LIMIT       OrderType = "LIMIT"
+	STOP_MARKET OrderType = "STOP_MARKET" // Becomes a MARKET order once the stop price trades
+	STOP_LIMIT  OrderType = "STOP_LIMIT"  // Becomes a LIMIT order once the stop price trades
+	// Stop whose price follows the market; becomes a MARKET order, or a LIMIT order if it has a price
+	TRAILING_STOP OrderType = "TRAILING_STOP"
+)
+
+// IsStop reports whether orders of this type wait in the engine's trigger book
+// instead of going straight to the orderbook
+func (t OrderType) IsStop() bool {
+	return t == STOP_MARKET || t == STOP_LIMIT || t == TRAILING_STOP
+}
+
+// TrailingReference is the market price a trailing stop ratchets on
+type TrailingReference string
+
+const (
+	TRAIL_LAST_PRICE TrailingReference = "LAST_PRICE" // The last trade price
+	TRAIL_BEST_PRICE TrailingReference = "BEST_PRICE" // The best bid for sell stops, the best ask for buy stops
+)
+
+// PostOnlyMode decides what happens to a post-only order that would cross the book
+type PostOnlyMode string
+
+const (
+	POST_ONLY_REJECT  PostOnlyMode = "REJECT"  // Reject the order outright
+	POST_ONLY_REPRICE PostOnlyMode = "REPRICE" // Move it one tick behind the best opposite price
+)
+
+// SelfTradePrevention decides what happens when an incoming order would trade
+// against a resting order of the same user
+type SelfTradePrevention string
+
+const (
+	STP_CANCEL_NEWEST        SelfTradePrevention = "CANCEL_NEWEST"        // Cancel what is left of the incoming order
+	STP_CANCEL_OLDEST        SelfTradePrevention = "CANCEL_OLDEST"        // Cancel the resting order and keep matching
+	STP_CANCEL_BOTH          SelfTradePrevention = "CANCEL_BOTH"          // Cancel both orders
+	STP_DECREMENT_AND_CANCEL SelfTradePrevention = "DECREMENT_AND_CANCEL" // Cancel the smaller order and reduce the larger by its size
+)
+
+type TimeInForce string
+
+const (
+	GTC TimeInForce = "GTC" // Good till cancelled: rests until filled or cancelled
+	IOC TimeInForce = "IOC" // Immediate or cancel: unfilled remainder is dropped
+	FOK TimeInForce = "FOK" // Fill or kill: filled in full immediately or rejected
+	GTD TimeInForce = "GTD" // Good till date: rests until ExpiresAt
 )
 
 type OrderStatus string
@@ -48,4 +107,5 @@ const (
 	PARTIAL   OrderStatus = "PARTIAL"
 	CANCELLED OrderStatus = "CANCELLED"
 	REJECTED  OrderStatus = "REJECTED"
+	EXPIRED   OrderStatus = "EXPIRED"
 )
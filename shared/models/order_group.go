@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// OrderGroup links a take-profit and a stop-loss order so that a fill or cancel on
+// one leg cancels the other. A bracket group also has a parent entry order. Its
+// legs are placed with the entry's first fill and grow with every later fill, so
+// they always cover what the entry has filled, less a buyer's fee in the base asset,
+// up to the quantities they were placed with.
+type OrderGroup struct {
+	ID                 uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID             uuid.UUID        `gorm:"type:uuid;not null;index"`
+	MarketID           string           `gorm:"type:varchar(20);not null"`
+	Type               OrderGroupType   `gorm:"type:varchar(10);not null"`
+	Status             OrderGroupStatus `gorm:"type:varchar(10);not null;default:'PENDING'"`
+	ParentOrderID      *uuid.UUID       `gorm:"type:uuid"` // Entry order, brackets only
+	TakeProfitOrderID  uuid.UUID        `gorm:"type:uuid;not null"`
+	StopLossOrderID    uuid.UUID        `gorm:"type:uuid;not null"`
+	TakeProfitQuantity decimal.Decimal  `gorm:"type:decimal(20,8);default:0"` // As placed, before a bracket's legs are cut to its entry
+	StopLossQuantity   decimal.Decimal  `gorm:"type:decimal(20,8);default:0"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+type OrderGroupType string
+
+const (
+	OCO     OrderGroupType = "OCO"     // Take-profit and stop-loss placed straight away
+	BRACKET OrderGroupType = "BRACKET" // Take-profit and stop-loss placed once the entry starts filling
+)
+
+type OrderGroupStatus string
+
+const (
+	GROUP_PENDING   OrderGroupStatus = "PENDING"   // Waiting for the bracket entry's first fill
+	GROUP_ACTIVE    OrderGroupStatus = "ACTIVE"    // Both legs are working
+	GROUP_COMPLETED OrderGroupStatus = "COMPLETED" // One leg traded and the other was cancelled
+	GROUP_CANCELLED OrderGroupStatus = "CANCELLED" // Cancelled before any leg traded
+)
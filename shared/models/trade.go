@@ -16,8 +16,8 @@ type Trade struct {
     Price         decimal.Decimal `gorm:"type:decimal(20,8);not null"`
     Quantity      decimal.Decimal `gorm:"type:decimal(20,8);not null"`
     QuoteQuantity decimal.Decimal `gorm:"type:decimal(20,8);not null"`
-	BuyerFee      *decimal.Decimal  `gorm:"type:decimal(20,8);not null"`
-	SellerFee     *decimal.Decimal  `gorm:"type:decimal(20,8);not null"`
+	BuyerFee      *decimal.Decimal  `gorm:"type:decimal(20,8);not null"` // In the base asset, which the buyer receives
+	SellerFee     *decimal.Decimal  `gorm:"type:decimal(20,8);not null"` // In the quote asset, which the seller receives
 	IsBuyerMaker  bool            `gorm:"not null"`
 	CreatedAt    time.Time        `gorm:"index"`
 
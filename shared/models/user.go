@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -15,6 +16,12 @@ type User struct {
     UpdatedAt    time.Time
     DeletedAt    gorm.DeletedAt `gorm:"index"`
     
+    // Fee tier earned with the rolling 30-day quote volume, kept up to date by the
+    // database service
+    FeeTier         int             `gorm:"not null;default:0"`
+    Volume30d       decimal.Decimal `gorm:"type:decimal(30,8);not null;default:0"`
+    VolumeUpdatedAt *time.Time      `gorm:"default:null"`
+    
     
     Orders   []Order   `gorm:"foreignKey:UserID"`
     Balances []Balance `gorm:"foreignKey:UserID"`